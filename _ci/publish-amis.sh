@@ -35,6 +35,10 @@ git checkout "$BRANCH_NAME"
 export AWS_ACCESS_KEY_ID="$PUBLISH_AMI_AWS_ACCESS_KEY_ID"
 export AWS_SECRET_ACCESS_KEY="$PUBLISH_AMI_AWS_SECRET_ACCESS_KEY"
 
+# Build the sign-request command the example AMI installs for the clients of the vault-iam-auth example
+readonly SIGN_REQUEST_BINARY_PATH="/tmp/sign-request"
+(cd "$SCRIPT_DIR/../modules/sign-request" && GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -o "$SIGN_REQUEST_BINARY_PATH" .)
+
 # Build the example AMI. Note that we pass in the example TLS files. WARNING! In a production setting, you should
 # decrypt or fetch secrets like this when the AMI boots versus embedding them statically into the AMI.
 build-packer-artifact \
@@ -43,7 +47,8 @@ build-packer-artifact \
   --output-properties-file "$AMI_PROPERTIES_FILE" \
   --var ca_public_key_path="$SCRIPT_DIR/../examples/vault-consul-ami/tls/ca.crt.pem" \
   --var tls_public_key_path="$SCRIPT_DIR/../examples/vault-consul-ami/tls/vault.crt.pem" \
-  --var tls_private_key_path="$SCRIPT_DIR/../examples/vault-consul-ami/tls/vault.key.pem"
+  --var tls_private_key_path="$SCRIPT_DIR/../examples/vault-consul-ami/tls/vault.key.pem" \
+  --var sign_request_binary_path="$SIGN_REQUEST_BINARY_PATH"
 
 # Copy the AMI to all regions and make it public in each
 source "$AMI_PROPERTIES_FILE"
@@ -187,6 +187,8 @@ data "template_file" "user_data_vault_cluster" {
     consul_cluster_tag_key   = var.consul_cluster_tag_key
     consul_cluster_tag_value = var.consul_cluster_name
     example_role_name        = var.example_role_name
+    example_role_ttl         = var.example_role_ttl
+    example_role_max_ttl     = var.example_role_max_ttl
     # Please note that normally we would never pass a secret this way
     # This is just for test purposes so we can verify that our example instance is authenticating correctly
     example_secret   = var.example_secret
@@ -50,8 +50,23 @@ function retry {
 # These variables are passed in via Terraform template interpolation
 /opt/consul/bin/run-consul --client --cluster-tag-key "${consul_cluster_tag_key}" --cluster-tag-value "${consul_cluster_tag_value}"
 
-# Start the Vault agent
-/opt/vault/bin/run-vault --agent --agent-auth-type iam --agent-auth-role "${example_role_name}"
+# Write a template for the Vault agent to render the example secret into a config file for an app. The agent renders
+# it again whenever the secret changes.
+# Read more at: https://www.vaultproject.io/docs/agent/template
+mkdir -p /opt/vault/templates
+cat > /opt/vault/templates/example-app.conf.ctmpl <<EOF
+{{ with secret "secret/example_gruntwork" }}the_answer = "{{ .Data.the_answer }}"{{ end }}
+EOF
+chown -R vault:vault /opt/vault/templates
+
+# Start the Vault agent. Besides writing its token to a file and rendering the template, it runs a caching proxy on port
+# 8100, which adds the token to the requests it forwards to Vault, with the same TLS certificate as the Vault servers.
+# The proxy only listens on 127.0.0.1, as anyone who can reach it can use the token.
+/opt/vault/bin/run-vault --agent --agent-auth-type iam --agent-auth-role "${example_role_name}" \
+  --agent-template "/opt/vault/templates/example-app.conf.ctmpl:/opt/vault/data/example-app.conf:0640" \
+  --agent-listener-address "127.0.0.1:8100" \
+  --agent-listener-tls-cert-file /opt/vault/tls/vault.crt.pem \
+  --agent-listener-tls-key-file /opt/vault/tls/vault.key.pem
 
 # Retry and wait for the Vault Agent to write the token out to a file.  This could be
 # because the Vault server is still booting and unsealing, or because run-consul
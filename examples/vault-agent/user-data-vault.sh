@@ -105,22 +105,25 @@ retry \
   "/opt/vault/bin/vault secrets enable -version=1 -path=secret kv" \
   "Trying to enable key-value secrets engine"
 
-# Creates a policy that allows writing and reading from an "example_" prefix at "secret" backend
+# Creates a policy that only allows reading from an "example_" prefix at "secret" backend, as all the Vault agent does
+# with its token is read the example secret
 /opt/vault/bin/vault policy write "example-policy" -<<EOF
 path "secret/example_*" {
-  capabilities = ["create", "read"]
+  capabilities = ["read"]
 }
 EOF
 
 # Creates an authentication role
 # The Vault Role name & AWS IAM Role ARN are being passed by terraform
 # This example will allow AWS resources with this IAM Role to authenticate and assume this Vault Role
+# The Vault agent renews its token before the ttl runs out, and logs in again once it reaches the max_ttl
 # Read more at: https://www.vaultproject.io/api/auth/aws/index.html#create-role
 /opt/vault/bin/vault write \
   auth/aws/role/${example_role_name}\
   auth_type=iam \
   policies=example-policy \
-  max_ttl=24h \
+  ttl=${example_role_ttl} \
+  max_ttl=${example_role_max_ttl} \
   bound_iam_principal_arn=${aws_iam_role_arn}
 
 # ==========================================================================
@@ -130,4 +133,18 @@ EOF
 # Writes some secret, this secret is being written by terraform for test purposes
 # Please note that normally we would never pass a secret this way as it is not secure
 # This is just so we can have a test verifying that our example instance is authenticating correctly
-/opt/vault/bin/vault write secret/example_gruntwork the_answer=${example_secret}
+# The ttl tells the Vault agent on the auth client how often to read the secret again to render its template
+/opt/vault/bin/vault write secret/example_gruntwork the_answer=${example_secret} ttl=1m
+
+# Creates a policy and a token that can update the example secret, and keeps the token where only root can read it.
+# The token of the Vault agent can't update the secret, so the automated tests read this one over SSH to change the
+# secret and check that the agent renders it again.
+# Please note that normally whoever manages the secret would log in on their own, rather than have a token left on the
+# server
+/opt/vault/bin/vault policy write "example-writer-policy" -<<EOF
+path "secret/example_gruntwork" {
+  capabilities = ["update"]
+}
+EOF
+
+(umask 077 && /opt/vault/bin/vault token create -policy=example-writer-policy -ttl=24h -field=token > /opt/vault/data/example-writer-token)
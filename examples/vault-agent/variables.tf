@@ -38,6 +38,18 @@ variable "example_role_name" {
   default     = "example-role"
 }
 
+variable "example_role_ttl" {
+  description = "The TTL of the tokens Vault issues to the agent when it logs in as the vault role. The agent renews its token before it expires, and logs in again once it can no longer renew it."
+  type        = string
+  default     = "24h"
+}
+
+variable "example_role_max_ttl" {
+  description = "The maximum TTL the agent can renew its token up to"
+  type        = string
+  default     = "24h"
+}
+
 variable "vault_cluster_name" {
   description = "What to name the Vault server cluster and all of its associated resources"
   type        = string
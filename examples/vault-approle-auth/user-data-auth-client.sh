@@ -0,0 +1,29 @@
+#!/bin/bash
+# This script is meant to be run in the User Data of each EC2 Instance while it's booting. The script uses the
+# run-consul script to configure and start Consul in client mode. Note that this script assumes it's running in an AMI
+# built from the Packer template in examples/vault-consul-ami/vault-consul.json.
+# It then starts Vault agent, which authenticates to the Vault server with the AppRole auth method once a trusted
+# orchestrator delivers the role ID and a response-wrapped secret ID to this instance. After login, Vault agent writes
+# the authentication token to a file location, and runs a caching proxy that adds the token to the requests your
+# applications send to it.
+
+set -e
+
+# Send the log output from this script to user-data.log, syslog, and the console
+# From: https://alestic.com/2010/12/ec2-user-data-output/
+exec > >(tee /var/log/user-data.log|logger -t user-data -s 2>/dev/console) 2>&1
+
+# These variables are passed in via Terraform template interpolation
+/opt/consul/bin/run-consul --client --cluster-tag-key "${consul_cluster_tag_key}" --cluster-tag-value "${consul_cluster_tag_value}"
+
+# Start the Vault agent. It keeps trying to log in until the orchestrator writes the role ID and the wrapped secret ID to
+# these files, and deletes the secret ID file once it has read it. Besides writing its token to a file, it runs a
+# caching proxy on port 8100, with the same TLS certificate as the Vault servers. The proxy only listens on 127.0.0.1,
+# as anyone who can reach it can use the token.
+/opt/vault/bin/run-vault --agent --agent-auth-type approle --agent-auth-role "${example_role_name}" \
+  --agent-approle-role-id-file /opt/vault/data/role-id \
+  --agent-approle-secret-id-file /opt/vault/data/secret-id \
+  --agent-approle-wrapped-secret-id \
+  --agent-listener-address "127.0.0.1:8100" \
+  --agent-listener-tls-cert-file /opt/vault/tls/vault.crt.pem \
+  --agent-listener-tls-key-file /opt/vault/tls/vault.key.pem
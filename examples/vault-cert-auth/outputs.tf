@@ -0,0 +1,109 @@
+output "auth_client_public_ip" {
+  value = aws_instance.example_auth_to_vault.public_ip
+}
+
+output "auth_client_instance_id" {
+  value = aws_instance.example_auth_to_vault.id
+}
+
+output "auth_role_name" {
+  value = var.example_role_name
+}
+
+output "client_ca_cert_pem" {
+  value = tls_self_signed_cert.client_ca.cert_pem
+}
+
+output "auth_client_cert_pem" {
+  value = tls_locally_signed_cert.client["auth_client"].cert_pem
+}
+
+output "auth_client_private_key_pem" {
+  value     = tls_private_key.client["auth_client"].private_key_pem
+  sensitive = true
+}
+
+output "asg_name_vault_cluster" {
+  value = module.vault_cluster.asg_name
+}
+
+output "launch_config_name_vault_cluster" {
+  value = module.vault_cluster.launch_config_name
+}
+
+output "iam_role_arn_vault_cluster" {
+  value = module.vault_cluster.iam_role_arn
+}
+
+output "iam_role_id_vault_cluster" {
+  value = module.vault_cluster.iam_role_id
+}
+
+output "security_group_id_vault_cluster" {
+  value = module.vault_cluster.security_group_id
+}
+
+output "asg_name_consul_cluster" {
+  value = module.consul_cluster.asg_name
+}
+
+output "launch_config_name_consul_cluster" {
+  value = module.consul_cluster.launch_config_name
+}
+
+output "iam_role_arn_consul_cluster" {
+  value = module.consul_cluster.iam_role_arn
+}
+
+output "iam_role_id_consul_cluster" {
+  value = module.consul_cluster.iam_role_id
+}
+
+output "security_group_id_consul_cluster" {
+  value = module.consul_cluster.security_group_id
+}
+
+output "aws_region" {
+  value = data.aws_region.current.name
+}
+
+output "vault_servers_cluster_tag_key" {
+  value = module.vault_cluster.cluster_tag_key
+}
+
+output "vault_servers_cluster_tag_value" {
+  value = module.vault_cluster.cluster_tag_value
+}
+
+output "ssh_key_name" {
+  value = var.ssh_key_name
+}
+
+output "vault_cluster_size" {
+  value = var.vault_cluster_size
+}
+
+output "launch_config_name_servers" {
+  value = module.consul_cluster.launch_config_name
+}
+
+output "iam_role_arn_servers" {
+  value = module.consul_cluster.iam_role_arn
+}
+
+output "iam_role_id_servers" {
+  value = module.consul_cluster.iam_role_id
+}
+
+output "security_group_id_servers" {
+  value = module.consul_cluster.security_group_id
+}
+
+output "consul_cluster_cluster_tag_key" {
+  value = module.consul_cluster.cluster_tag_key
+}
+
+output "consul_cluster_cluster_tag_value" {
+  value = module.consul_cluster.cluster_tag_value
+}
+
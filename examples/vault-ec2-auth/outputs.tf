@@ -6,6 +6,10 @@ output "auth_client_instance_id" {
   value = aws_instance.example_auth_to_vault.id
 }
 
+output "auth_role_name" {
+  value = var.example_role_name
+}
+
 output "asg_name_vault_cluster" {
   value = module.vault_cluster.asg_name
 }
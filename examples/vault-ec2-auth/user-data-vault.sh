@@ -95,6 +95,14 @@ retry \
   "/opt/vault/bin/vault auth enable aws" \
   "Trying to enable aws auth"
 
+# By default, the tokens Vault issues at login only include the account ID and auth type in their metadata
+# We add the fields that tell which AMI and instance logged in, so they show up in the audit log and token lookups
+# Read more at: https://www.vaultproject.io/api/auth/aws#configure-identity-integration
+# This is an http request, and sometimes fails, hence we retry
+retry \
+  "/opt/vault/bin/vault write auth/aws/config/identity ec2_metadata=account_id,auth_type,ami_id,instance_id,region" \
+  "Trying to configure the identity integration of aws auth"
+
 # Enable the kv secrets engine at path `secret`, since we are using Vault version >= 1.1.0
 retry \
   "/opt/vault/bin/vault secrets enable -version=1 -path=secret kv" \
@@ -10,6 +10,10 @@ output "auth_role_arn" {
   value = aws_iam_role.example_instance_role.arn
 }
 
+output "auth_role_name" {
+  value = var.example_role_name
+}
+
 output "asg_name_vault_cluster" {
   value = module.vault_cluster.asg_name
 }
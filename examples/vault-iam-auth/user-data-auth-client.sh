@@ -2,7 +2,7 @@
 # This script is meant to be run in the User Data of each EC2 Instance while it's booting. The script uses the
 # run-consul script to configure and start Consul in client mode. Note that this script assumes it's running in an AMI
 # built from the Packer template in examples/vault-consul-ami/vault-consul.json.
-# It then uses a python script to create a signed request to the AWS STS API and sends this encrypted request
+# It then uses the sign-request command to create a signed request to the AWS STS API and sends this signed request
 # to the Vault server when authenticating. After login, it reads a secret and exposes it in a simple web server for
 # test purposes.
 
@@ -19,12 +19,13 @@ function log {
  >&2 echo -e "$timestamp $message"
 }
 
-# A retry function that attempts to run a command a number of times and returns the output
+# A retry function that attempts to run a command a number of times and returns the output. It tries for 10 minutes, as
+# the Vault Role this client logs in as only exists once the vault-config folder of this example has been applied.
 function retry {
   local -r cmd="$1"
   local -r description="$2"
 
-  for i in $(seq 1 30); do
+  for i in $(seq 1 60); do
     log "$description"
 
     # The boolean operations with the exit status are there to temporarily circumvent the "set -e" at the
@@ -42,7 +43,7 @@ function retry {
     sleep 10
   done;
 
-  log "$description failed after 30 attempts."
+  log "$description failed after 60 attempts."
   exit $exit_status
 }
 
@@ -51,10 +52,10 @@ function retry {
 
 # Creating a signed request to AWS Security Token Service (STS) API with header of server ID "vault.service.consul"
 # This request is to the method GetCallerIdentity of STS, which answers the question "who am I?"
-# This python script creates the STS request, gets the necessary AWS credentials and signs the request with them
-# Using python here instead of doing this in bash to take advantage of python's AWS SDK boto3, which facilitates this work a lot
-# You can find this script at /examples/vault-consul-ami/auth/sign-request.py
-signed_request=$(python /opt/vault/scripts/sign-request.py vault.service.consul)
+# The sign-request command the AMI installs creates the STS request, gets the necessary AWS credentials and signs the
+# request with them, with the AWS SDK for Go
+# You can find its code at /modules/sign-request
+signed_request=$(/opt/vault/bin/sign-request vault.service.consul)
 
 iam_request_url=$(echo $signed_request | jq -r .iam_request_url)
 iam_request_body=$(echo $signed_request | jq -r .iam_request_body)
@@ -75,8 +76,8 @@ EOF
 
 # We send this signed request to the Vault server
 # And the Vault server will execute this request to validate this origin with AWS
-# Retry in case the vault server is still booting and unsealing
-# Or in case run-consul running on the background didn't finish yet
+# Retry in case the vault server is still booting and unsealing, in case the Vault Role hasn't been created from the
+# vault-config folder yet, or in case run-consul running on the background didn't finish yet
 login_output=$(retry \
   "curl --fail --request POST --data '$data' https://vault.service.consul:8200/v1/auth/aws/login" \
   "Trying to login to vault")
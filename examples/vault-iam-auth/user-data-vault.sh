@@ -14,9 +14,19 @@ exec > >(tee /var/log/user-data.log|logger -t user-data -s 2>/dev/console) 2>&1
 readonly VAULT_TLS_CERT_FILE="/opt/vault/tls/vault.crt.pem"
 readonly VAULT_TLS_KEY_FILE="/opt/vault/tls/vault.key.pem"
 
+# run-vault reads the token to enable the audit device with from this file, and deletes it once it has
+readonly VAULT_AUDIT_TOKEN_FILE="/opt/vault/data/audit-token"
+
 # The cluster_tag variables below are filled in via Terraform interpolation
 /opt/consul/bin/run-consul --client --cluster-tag-key "${consul_cluster_tag_key}" --cluster-tag-value "${consul_cluster_tag_value}"
-/opt/vault/bin/run-vault --tls-cert-file "$VAULT_TLS_CERT_FILE"  --tls-key-file "$VAULT_TLS_KEY_FILE"
+
+# Enable a file audit device, which logs every request and response to /opt/vault/log/vault-audit.log. run-vault
+# enables it once Vault is unsealed and there's a token in $VAULT_AUDIT_TOKEN_FILE, which we write below. We leave the
+# token accessors in the audit log unhashed, so the automated tests can find the requests made with their tokens.
+/opt/vault/bin/run-vault --tls-cert-file "$VAULT_TLS_CERT_FILE"  --tls-key-file "$VAULT_TLS_KEY_FILE" \
+  --enable-audit-device file \
+  --audit-hmac-accessor false \
+  --audit-token-file "$VAULT_AUDIT_TOKEN_FILE"
 
 # Log the given message. All logs are written to stderr with a timestamp.
 function log {
@@ -89,6 +99,9 @@ echo "$server_output" | head -n 3 | awk '{ print $4; }' | xargs -l /opt/vault/bi
 # Exports the client token environment variable necessary for running the following vault commands
 export VAULT_TOKEN=$(echo "$server_output" | head -n 7 | tail -n 1 | awk '{ print $4; }')
 
+# Hand the token to run-vault, which is waiting in the background to enable the audit device with it
+(umask 077 && echo -n "$VAULT_TOKEN" > "$VAULT_AUDIT_TOKEN_FILE")
+
 
 # ==========================================================================
 # BEGIN AWS IAM AUTH EXAMPLE
@@ -100,12 +113,21 @@ retry \
   "/opt/vault/bin/vault auth enable aws" \
   "Trying to enable aws auth"
 
+# By default, the tokens Vault issues at login only include the account ID and auth type in their metadata
+# We add the fields that tell which IAM role logged in, so they show up in the audit log and token lookups
+# Read more at: https://www.vaultproject.io/api/auth/aws#configure-identity-integration
+# This is an http request, and sometimes fails, hence we retry
+retry \
+  "/opt/vault/bin/vault write auth/aws/config/identity iam_metadata=account_id,auth_type,canonical_arn,client_arn,inferred_entity_type" \
+  "Trying to configure the identity integration of aws auth"
+
 # Enable the kv secrets engine at path `secret`, since we are using Vault version >= 1.1.0
 retry \
   "/opt/vault/bin/vault secrets enable -version=1 -path=secret kv" \
   "Trying to enable key-value secrets engine"
 
 # Creates a policy that allows writing and reading from an "example_" prefix at "secret" backend
+# The vault-config folder of this example declares the same policy and role, so keep the two in sync
 /opt/vault/bin/vault policy write "example-policy" -<<EOF
 path "secret/example_*" {
   capabilities = ["create", "read"]
@@ -34,6 +34,53 @@ resource "tls_self_signed_cert" "ca" {
   }
 }
 
+# ---------------------------------------------------------------------------------------------------------------------
+# OPTIONALLY CREATE AN INTERMEDIATE CA CERTIFICATE SIGNED USING THE CA CERTIFICATE
+# If var.intermediate_ca_common_name is set, the TLS certificate is signed by this intermediate CA instead of the root CA,
+# so the root CA private key is only ever used once.
+# ---------------------------------------------------------------------------------------------------------------------
+
+resource "tls_private_key" "intermediate_ca" {
+  count = var.intermediate_ca_common_name == null ? 0 : 1
+
+  algorithm   = var.private_key_algorithm
+  ecdsa_curve = var.private_key_ecdsa_curve
+  rsa_bits    = var.private_key_rsa_bits
+}
+
+resource "tls_cert_request" "intermediate_ca" {
+  count = var.intermediate_ca_common_name == null ? 0 : 1
+
+  key_algorithm   = tls_private_key.intermediate_ca[0].algorithm
+  private_key_pem = tls_private_key.intermediate_ca[0].private_key_pem
+
+  subject {
+    common_name  = var.intermediate_ca_common_name
+    organization = var.organization_name
+  }
+}
+
+resource "tls_locally_signed_cert" "intermediate_ca" {
+  count = var.intermediate_ca_common_name == null ? 0 : 1
+
+  cert_request_pem  = tls_cert_request.intermediate_ca[0].cert_request_pem
+  is_ca_certificate = true
+
+  ca_key_algorithm   = tls_private_key.ca.algorithm
+  ca_private_key_pem = tls_private_key.ca.private_key_pem
+  ca_cert_pem        = tls_self_signed_cert.ca.cert_pem
+
+  validity_period_hours = var.validity_period_hours
+  allowed_uses          = var.ca_allowed_uses
+}
+
+locals {
+  # The CA that signs the TLS certificate: the intermediate CA, if there is one, or the root CA otherwise
+  signing_ca_key_algorithm   = concat(tls_private_key.intermediate_ca.*.algorithm, [tls_private_key.ca.algorithm])[0]
+  signing_ca_private_key_pem = concat(tls_private_key.intermediate_ca.*.private_key_pem, [tls_private_key.ca.private_key_pem])[0]
+  signing_ca_cert_pem        = concat(tls_locally_signed_cert.intermediate_ca.*.cert_pem, [tls_self_signed_cert.ca.cert_pem])[0]
+}
+
 # ---------------------------------------------------------------------------------------------------------------------
 # CREATE A TLS CERTIFICATE SIGNED USING THE CA CERTIFICATE
 # ---------------------------------------------------------------------------------------------------------------------
@@ -65,9 +112,9 @@ resource "tls_cert_request" "cert" {
 resource "tls_locally_signed_cert" "cert" {
   cert_request_pem = tls_cert_request.cert.cert_request_pem
 
-  ca_key_algorithm   = tls_private_key.ca.algorithm
-  ca_private_key_pem = tls_private_key.ca.private_key_pem
-  ca_cert_pem        = tls_self_signed_cert.ca.cert_pem
+  ca_key_algorithm   = local.signing_ca_key_algorithm
+  ca_private_key_pem = local.signing_ca_private_key_pem
+  ca_cert_pem        = local.signing_ca_cert_pem
 
   validity_period_hours = var.validity_period_hours
   allowed_uses          = var.allowed_uses
@@ -78,3 +125,20 @@ resource "tls_locally_signed_cert" "cert" {
   }
 }
 
+# ---------------------------------------------------------------------------------------------------------------------
+# OPTIONALLY WRITE THE CERTIFICATE CHAIN
+# The TLS certificate followed by the intermediate CA certificate, if there is one. This is the file a server such as
+# Vault should serve, so clients that only trust the root CA can verify the TLS certificate.
+# ---------------------------------------------------------------------------------------------------------------------
+
+resource "null_resource" "chain" {
+  count = var.chain_file_path == null ? 0 : 1
+
+  triggers = {
+    cert_pem = tls_locally_signed_cert.cert.cert_pem
+  }
+
+  provisioner "local-exec" {
+    command = "echo '${join("", concat([tls_locally_signed_cert.cert.cert_pem], tls_locally_signed_cert.intermediate_ca.*.cert_pem))}' > '${var.chain_file_path}' && chmod ${var.permissions} '${var.chain_file_path}' && chown ${var.owner} '${var.chain_file_path}'"
+  }
+}
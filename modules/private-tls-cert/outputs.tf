@@ -10,3 +10,6 @@ output "private_key_file_path" {
   value = var.private_key_file_path
 }
 
+output "chain_file_path" {
+  value = var.chain_file_path
+}
@@ -58,6 +58,18 @@ variable "validity_period_hours" {
 # These parameters have reasonable defaults.
 # ---------------------------------------------------------------------------------------------------------------------
 
+variable "intermediate_ca_common_name" {
+  description = "If set, create an intermediate CA with this common name, signed by the root CA, and use it to sign the certificate (e.g. acme.co intermediate cert). Set var.chain_file_path too, so servers can serve the intermediate CA certificate along with their own."
+  type        = string
+  default     = null
+}
+
+variable "chain_file_path" {
+  description = "If set, write the PEM-encoded certificate, followed by the intermediate CA certificate if var.intermediate_ca_common_name is set, to this path (e.g. /etc/tls/vault-chain.crt.pem)."
+  type        = string
+  default     = null
+}
+
 variable "ca_allowed_uses" {
   description = "List of keywords from RFC5280 describing a use that is permitted for the CA certificate. For more info and the list of keywords, see https://www.terraform.io/docs/providers/tls/r/self_signed_cert.html#allowed_uses."
   type        = list(string)
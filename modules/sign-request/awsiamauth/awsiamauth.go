@@ -0,0 +1,118 @@
+// Package awsiamauth builds the login payload for the iam auth type of Vault's AWS auth method: an sts:GetCallerIdentity
+// request, signed with AWS credentials from the standard sources (environment variables, the shared credentials and
+// config files, or the EC2 instance profile), that Vault replays to AWS to find out who is logging in. The sign-request
+// command prints it for shell scripts, such as the User Data of the clients in the vault-iam-auth example.
+package awsiamauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/hashicorp/vault/api"
+)
+
+// ServerIdHeader is the header Vault checks against the iam_server_id_header_value of the AWS auth method, to stop a
+// signed request meant for one Vault server from being replayed to log in to another
+const ServerIdHeader = "X-Vault-AWS-IAM-Server-ID"
+
+// DefaultMountPath is the path the AWS auth method is enabled at, unless it's enabled with -path
+const DefaultMountPath = "auth/aws"
+
+// DefaultRegion is the region requests to the global STS endpoint are signed for. Vault sends the login requests to
+// this endpoint, unless the AWS auth method is configured with another sts_endpoint.
+const DefaultRegion = "us-east-1"
+
+// Options configures how the sts:GetCallerIdentity request is built and signed
+type Options struct {
+	ServerId    string                   // The value of the X-Vault-AWS-IAM-Server-ID header. Leave empty to not send it.
+	Region      string                   // The region to sign the request for. Defaults to DefaultRegion.
+	StsEndpoint string                   // The STS endpoint to send the request to, e.g. a regional one. Defaults to the global endpoint.
+	Credentials *credentials.Credentials // The credentials to sign the request with. Defaults to the standard AWS credential sources.
+}
+
+// LoginData is the signed sts:GetCallerIdentity request, in the form the AWS auth method's login endpoint takes it.
+// Its JSON encoding is what the sign-request command prints.
+type LoginData struct {
+	Method  string `json:"iam_http_request_method"`
+	URL     string `json:"iam_request_url"`     // Base64 encoded
+	Body    string `json:"iam_request_body"`    // Base64 encoded
+	Headers string `json:"iam_request_headers"` // Base64 encoded JSON map of header name to values
+}
+
+// LoginParams returns the parameters to write to the login endpoint of the AWS auth method to log in as the given
+// Vault role (not the AWS IAM role).
+func (data *LoginData) LoginParams(role string) map[string]interface{} {
+	return map[string]interface{}{
+		"role":                    role,
+		"iam_http_request_method": data.Method,
+		"iam_request_url":         data.URL,
+		"iam_request_body":        data.Body,
+		"iam_request_headers":     data.Headers,
+	}
+}
+
+// GenerateLoginData builds an sts:GetCallerIdentity request and signs it with the AWS credentials in the given options.
+// The request isn't sent: Vault sends it when the client logs in.
+func GenerateLoginData(options Options) (*LoginData, error) {
+	config := aws.NewConfig().WithRegion(DefaultRegion)
+	if options.Region != "" {
+		config = config.WithRegion(options.Region)
+	}
+	if options.StsEndpoint != "" {
+		config = config.WithEndpoint(options.StsEndpoint)
+	}
+	if options.Credentials != nil {
+		config = config.WithCredentials(options.Credentials)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *config, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AWS session: %v", err)
+	}
+
+	request, _ := sts.New(sess).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+
+	// The header has to be set before the request is signed, so it's covered by the signature
+	if options.ServerId != "" {
+		request.HTTPRequest.Header.Set(ServerIdHeader, options.ServerId)
+	}
+
+	if err := request.Sign(); err != nil {
+		return nil, fmt.Errorf("Failed to sign sts:GetCallerIdentity request: %v", err)
+	}
+
+	body, err := ioutil.ReadAll(request.HTTPRequest.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body of sts:GetCallerIdentity request: %v", err)
+	}
+
+	headers, err := json.Marshal(request.HTTPRequest.Header)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode headers of sts:GetCallerIdentity request: %v", err)
+	}
+
+	return &LoginData{
+		Method:  request.HTTPRequest.Method,
+		URL:     base64.StdEncoding.EncodeToString([]byte(request.HTTPRequest.URL.String())),
+		Body:    base64.StdEncoding.EncodeToString(body),
+		Headers: base64.StdEncoding.EncodeToString(headers),
+	}, nil
+}
+
+// Login logs in to the AWS auth method enabled at the given mount path (e.g. DefaultMountPath) as the given Vault role,
+// with an sts:GetCallerIdentity request signed with the given options. The token in the returned secret isn't set on
+// the client.
+func Login(client *api.Client, mountPath string, role string, options Options) (*api.Secret, error) {
+	data, err := GenerateLoginData(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Logical().Write(fmt.Sprintf("%s/login", mountPath), data.LoginParams(role))
+}
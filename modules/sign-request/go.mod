@@ -0,0 +1,11 @@
+module github.com/gruntwork-io/terraform-aws-vault/modules/sign-request
+
+go 1.13
+
+require (
+	github.com/aws/aws-sdk-go v1.38.28
+	github.com/hashicorp/go-multierror v1.1.0 // indirect
+	github.com/hashicorp/vault/api v1.0.4
+	github.com/stretchr/testify v1.6.1
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
+)
@@ -0,0 +1,63 @@
+// Command sign-request prints the login payload for the iam auth type of Vault's AWS auth method: an
+// sts:GetCallerIdentity request signed with the AWS credentials from the standard sources, with the
+// X-Vault-AWS-IAM-Server-ID header set to the given value. It's built on the awsiamauth package, so it doesn't need
+// Python or boto, and the vault-consul-ami example installs it in /opt/vault/bin for the clients of the vault-iam-auth
+// example.
+//
+// Usage: sign-request [--region REGION] [--sts-endpoint URL] SERVER_ID
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gruntwork-io/terraform-aws-vault/modules/sign-request/awsiamauth"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Print the signed request for the server ID in the given arguments and return the exit code
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	options := awsiamauth.Options{}
+
+	flagSet := flag.NewFlagSet("sign-request", flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	flagSet.StringVar(&options.Region, "region", awsiamauth.DefaultRegion, "The region to sign the request for")
+	flagSet.StringVar(&options.StsEndpoint, "sts-endpoint", "", "The STS endpoint Vault sends the request to. Defaults to the global endpoint.")
+	flagSet.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: sign-request [OPTIONS] SERVER_ID\n\n")
+		fmt.Fprintf(stderr, "Print a signed sts:GetCallerIdentity request to log in to Vault with the AWS auth method. SERVER_ID is\n")
+		fmt.Fprintf(stderr, "the value of the %s header, e.g. vault.service.consul.\n\nOptions:\n", awsiamauth.ServerIdHeader)
+		flagSet.PrintDefaults()
+	}
+
+	if err := flagSet.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		return 2
+	}
+	options.ServerId = flagSet.Arg(0)
+
+	data, err := awsiamauth.GenerateLoginData(options)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if err := json.NewEncoder(stdout).Encode(data); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The path the AppRole auth method is enabled at in the vault-approle-auth example
+const APPROLE_AUTH_MOUNT_PATH = "auth/approle"
+
+// The vault-approle-auth example creates a token for a trusted orchestrator, which reads the role ID of the AppRole and
+// issues secret IDs for it, and leaves it in this file on the Vault node. The test plays the part of the orchestrator.
+const APPROLE_ORCHESTRATOR_TOKEN_PATH = "/opt/vault/data/example-orchestrator-token"
+
+// The files the Vault agent in the vault-approle-auth example reads the role ID and the wrapped secret ID from
+const APPROLE_ROLE_ID_FILE = "/opt/vault/data/role-id"
+const APPROLE_SECRET_ID_FILE = "/opt/vault/data/secret-id"
+
+// How long the wrapped secret ID is valid for, i.e. how long the orchestrator has to deliver it. This is also the
+// max_wrapping_ttl the policy of the orchestrator allows.
+const APPROLE_SECRET_ID_WRAP_TTL = 5 * time.Minute
+
+// The agent backs off between login attempts while it has no role ID and secret ID to log in with, for up to five
+// minutes at a time
+const APPROLE_AGENT_LOGIN_TIMEOUT = 6 * time.Minute
+
+const VAULT_ERROR_INVALID_WRAPPING_TOKEN = "wrapping token is not valid or does not exist"
+
+// Check the AppRole login of the Vault agent on the given client host, against the Vault node at the given host:
+//
+//  1. The orchestrator token reads the role ID of the AppRole and issues a response-wrapped secret ID for it, but can't
+//     read the example secret itself, nor issue a secret ID that isn't wrapped or is wrapped for too long.
+//  2. Once the test delivers the role ID and the wrapped secret ID to the client host, the agent unwraps the secret ID,
+//     logs in as the AppRole and writes a token with the policy of the role to its sink.
+//  3. The agent deleted the secret ID file and used up the wrapping token.
+//  4. A client with no token can read the example secret through the caching proxy of the agent.
+func testAppRoleAgentLogin(t *testing.T, vaultHost ssh.Host, clientHost ssh.Host, tlsCert TlsCert, roleName string, secretPath string, expectedSecret string) {
+	client := createVaultClientWithCert(t, net.JoinHostPort(vaultHost.Hostname, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+	client.SetToken(readAppRoleOrchestratorToken(t, vaultHost))
+
+	_, err := client.Logical().Read(secretPath)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the orchestrator token to be unable to read %s", secretPath)
+
+	_, err = requestSecretIdE(client, roleName, 0)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the orchestrator token to be unable to issue a secret ID that isn't wrapped")
+
+	_, err = requestSecretIdE(client, roleName, 2*APPROLE_SECRET_ID_WRAP_TTL)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the orchestrator token to be unable to issue a secret ID wrapped for more than %s", APPROLE_SECRET_ID_WRAP_TTL)
+
+	roleId := readAppRoleId(t, client, roleName)
+	wrappingToken := issueWrappedSecretId(t, client, roleName)
+
+	deliverAppRoleCredentials(t, clientHost, roleId, wrappingToken)
+
+	token := waitForAgentLogin(t, clientHost)
+	secret, err := lookupToken(client, token)
+	require.NoError(t, err, "Expected the token the Vault agent on %s logged in with to be valid", clientHost.Hostname)
+
+	policies, err := secret.TokenPolicies()
+	require.NoError(t, err)
+	assert.Contains(t, policies, AWS_AUTH_EXAMPLE_POLICY, "Expected the token of the Vault agent to have the policy of the AppRole")
+
+	metadata, err := secret.TokenMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, roleName, metadata["role_name"], "Expected the Vault agent to have logged in as the AppRole")
+
+	_, err = ssh.CheckSshCommandE(t, clientHost, fmt.Sprintf("sudo test ! -e %s", APPROLE_SECRET_ID_FILE))
+	assert.NoError(t, err, "Expected the Vault agent on %s to delete %s once it read the secret ID", clientHost.Hostname, APPROLE_SECRET_ID_FILE)
+
+	client.ClearToken()
+	_, err = client.Logical().Unwrap(wrappingToken)
+	assertVaultError(t, err, http.StatusBadRequest, VAULT_ERROR_INVALID_WRAPPING_TOKEN, "Expected the Vault agent on %s to have unwrapped the secret ID", clientHost.Hostname)
+
+	testVaultAgentListener(t, clientHost, tlsCert, secretPath, expectedSecret)
+}
+
+// Read the orchestrator token the vault-approle-auth example leaves on the given Vault node. Only root can read it.
+func readAppRoleOrchestratorToken(t *testing.T, host ssh.Host) string {
+	output, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", APPROLE_ORCHESTRATOR_TOKEN_PATH))
+	require.NoError(t, err, "Failed to read the orchestrator token from %s on %s", APPROLE_ORCHESTRATOR_TOKEN_PATH, host.Hostname)
+
+	token := strings.TrimSpace(output)
+	require.NotEmpty(t, token, "Expected the Vault node %s to have an orchestrator token in %s", host.Hostname, APPROLE_ORCHESTRATOR_TOKEN_PATH)
+	return token
+}
+
+// Read the role ID of the given AppRole
+func readAppRoleId(t *testing.T, client *api.Client, roleName string) string {
+	path := fmt.Sprintf("%s/role/%s/role-id", APPROLE_AUTH_MOUNT_PATH, roleName)
+
+	secret, err := client.Logical().Read(path)
+	require.NoError(t, err, "Failed to read the role ID of the AppRole %s", roleName)
+	require.NotNil(t, secret, "Expected the AppRole %s to exist", roleName)
+
+	roleId, ok := secret.Data["role_id"].(string)
+	require.True(t, ok && roleId != "", "Expected %s to return a role ID, but got %v", path, secret.Data)
+	return roleId
+}
+
+// Issue a secret ID for the given AppRole, wrapped in a single-use token that's valid for APPROLE_SECRET_ID_WRAP_TTL,
+// and return the wrapping token. The secret ID itself never leaves Vault until the agent unwraps it.
+func issueWrappedSecretId(t *testing.T, client *api.Client, roleName string) string {
+	secret, err := requestSecretIdE(client, roleName, APPROLE_SECRET_ID_WRAP_TTL)
+	require.NoError(t, err, "Failed to issue a wrapped secret ID for the AppRole %s", roleName)
+	require.NotNil(t, secret, "Expected Vault to return a wrapped secret ID for the AppRole %s", roleName)
+	require.NotNil(t, secret.WrapInfo, "Expected Vault to wrap the secret ID for the AppRole %s", roleName)
+	assert.Empty(t, secret.Data, "Expected Vault to return the secret ID for the AppRole %s wrapped, rather than in the response", roleName)
+
+	// The agent only accepts wrapping tokens created by this path, so another secret can't be passed off as a secret ID
+	assert.Equal(t, appRoleSecretIdPath(roleName), secret.WrapInfo.CreationPath)
+	return secret.WrapInfo.Token
+}
+
+// Request a secret ID for the given AppRole, wrapped in a token that's valid for the given TTL, or not wrapped at all if
+// the TTL is zero
+func requestSecretIdE(client *api.Client, roleName string, wrapTtl time.Duration) (*api.Secret, error) {
+	if wrapTtl > 0 {
+		client.SetWrappingLookupFunc(func(operation, requestPath string) string {
+			return wrapTtl.String()
+		})
+		defer client.SetWrappingLookupFunc(nil)
+	}
+
+	return client.Logical().Write(appRoleSecretIdPath(roleName), nil)
+}
+
+func appRoleSecretIdPath(roleName string) string {
+	return fmt.Sprintf("%s/role/%s/secret-id", APPROLE_AUTH_MOUNT_PATH, roleName)
+}
+
+// Deliver the given role ID and wrapping token to the Vault agent on the given host. The secret ID goes last, as the
+// agent expects the role ID to be there by the time it finds a secret ID. Like scrapeVaultMetricsE, each file is copied
+// to a file only the SSH user can read, rather than put on the command line, then moved into place for the vault user.
+func deliverAppRoleCredentials(t *testing.T, host ssh.Host, roleId string, wrappingToken string) {
+	logger.Logf(t, "Delivering the role ID and the wrapped secret ID of the AppRole to the Vault agent on %s", host.Hostname)
+
+	for _, file := range []struct{ path, contents string }{{APPROLE_ROLE_ID_FILE, roleId}, {APPROLE_SECRET_ID_FILE, wrappingToken}} {
+		tmpPath := fmt.Sprintf("/tmp/%s-%s", filepath.Base(file.path), random.UniqueId())
+		err := ssh.ScpFileToE(t, host, 0600, tmpPath, file.contents)
+		require.NoError(t, err, "Failed to copy %s to %s", file.path, host.Hostname)
+
+		command := fmt.Sprintf("sudo install -o vault -g vault -m 600 %s %s; exit_status=$?; rm -f %s; exit $exit_status", tmpPath, file.path, tmpPath)
+		_, err = ssh.CheckSshCommandE(t, host, command)
+		require.NoError(t, err, "Failed to write %s on %s", file.path, host.Hostname)
+	}
+}
+
+// Wait for the Vault agent on the given host to log in and write its token to its sink, and return the token
+func waitForAgentLogin(t *testing.T, host ssh.Host) string {
+	maxRetries := int(APPROLE_AGENT_LOGIN_TIMEOUT / VAULT_AGENT_SINK_POLL_INTERVAL)
+	description := fmt.Sprintf("Waiting for the Vault agent on %s to log in and write a token to %s", host.Hostname, VAULT_AGENT_SINK_PATH)
+
+	token, err := retry.DoWithRetryE(t, description, maxRetries, VAULT_AGENT_SINK_POLL_INTERVAL, func() (string, error) {
+		token, err := readAgentSinkTokenE(t, host)
+		if err != nil {
+			return "", err
+		}
+		if token == "" {
+			return "", fmt.Errorf("Sink has no token yet")
+		}
+		return token, nil
+	})
+	require.NoError(t, err, "Expected the Vault agent on %s to log in within %s of getting its credentials", host.Hostname, APPROLE_AGENT_LOGIN_TIMEOUT)
+	return token
+}
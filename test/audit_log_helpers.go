@@ -0,0 +1,154 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The file the vault-iam-auth example has run-vault enable a file audit device with
+const VAULT_AUDIT_LOG_PATH = "/opt/vault/log/vault-audit.log"
+
+// The accessor of the token the test reads the example secret with in the validate stage, which the log stage looks
+// for in the audit log
+const SAVED_AUDIT_ACCESSOR = "AuditAccessor"
+
+// Vault hashes secrets and tokens in the audit log with HMAC-SHA256 and prefixes the hashes with this
+const VAULT_AUDIT_HMAC_PREFIX = "hmac-sha256:"
+
+// The entry types in the audit log: Vault logs each request when it comes in, and again along with its response
+const AUDIT_ENTRY_TYPE_REQUEST = "request"
+const AUDIT_ENTRY_TYPE_RESPONSE = "response"
+
+// AuditLogEntry is a line of the JSON audit log of Vault. Only the fields the tests check are parsed.
+type AuditLogEntry struct {
+	Time     string            `json:"time"`
+	Type     string            `json:"type"`
+	Auth     *AuditLogAuth     `json:"auth"`
+	Request  *AuditLogRequest  `json:"request"`
+	Response *AuditLogResponse `json:"response"`
+	Error    string            `json:"error"`
+}
+
+// AuditLogAuth is the token a request was made with
+type AuditLogAuth struct {
+	ClientToken string            `json:"client_token"`
+	Accessor    string            `json:"accessor"`
+	DisplayName string            `json:"display_name"`
+	Policies    []string          `json:"policies"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// AuditLogRequest is the request an entry is for
+type AuditLogRequest struct {
+	ID                  string                 `json:"id"`
+	Operation           string                 `json:"operation"`
+	Path                string                 `json:"path"`
+	ClientToken         string                 `json:"client_token"`
+	ClientTokenAccessor string                 `json:"client_token_accessor"`
+	RemoteAddress       string                 `json:"remote_address"`
+	Data                map[string]interface{} `json:"data"`
+}
+
+// AuditLogResponse is the response to the request of a response entry
+type AuditLogResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// Parse the given audit log, with one JSON entry per line
+func parseAuditLog(contents string) ([]AuditLogEntry, error) {
+	entries := []AuditLogEntry{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	// Entries with large responses can be longer than the default limit of a line
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry := AuditLogEntry{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("Invalid audit log entry on line %d: %v", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Find the audit log entries of the given type for the given operation on the given path, made with the token with the
+// given accessor
+func findAuditLogEntries(entries []AuditLogEntry, entryType string, operation string, path string, accessor string) []AuditLogEntry {
+	found := []AuditLogEntry{}
+	for _, entry := range entries {
+		if entry.Type != entryType || entry.Request == nil || entry.Auth == nil {
+			continue
+		}
+		if entry.Request.Operation == operation && entry.Request.Path == path && entry.Auth.Accessor == accessor {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// Save the accessor of the token the test read the example secret with, for testAuditLog to look for in the log stage
+func saveAuditAccessor(t *testing.T, testFolder string, accessor string) {
+	test_structure.SaveTestData(t, test_structure.FormatTestDataPath(testFolder, SAVED_AUDIT_ACCESSOR), accessor)
+}
+
+// Download the audit log from the given Vault node to the given local folder, and check that the reads of the given
+// secret with the token saved with saveAuditAccessor show up in it:
+//
+//  1. Vault logged both the request and the response, with the accessor of the token, which the example leaves
+//     unhashed.
+//  2. The token itself and the value of the secret in the response are hashed, and the value of the secret doesn't
+//     show up anywhere in the log.
+//
+// The audit log is always downloaded, but the checks are skipped if the validate stage, which saves the accessor,
+// didn't run.
+func testAuditLog(t *testing.T, testFolder string, host ssh.Host, localDestDir string, secretPath string, expectedSecret string) {
+	contents, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", VAULT_AUDIT_LOG_PATH))
+	require.NoError(t, err, "Failed to read the audit log %s on %s", VAULT_AUDIT_LOG_PATH, host.Hostname)
+	vaulttest.WriteLogFile(t, contents, filepath.Join(localDestDir, fmt.Sprintf("vault-server-%s-audit.log", host.Hostname)))
+
+	accessorPath := test_structure.FormatTestDataPath(testFolder, SAVED_AUDIT_ACCESSOR)
+	if !test_structure.IsTestDataPresent(t, accessorPath) {
+		logger.Logf(t, "No token accessor was saved by the validate stage, so not checking the audit log")
+		return
+	}
+	var accessor string
+	test_structure.LoadTestData(t, accessorPath, &accessor)
+
+	entries, err := parseAuditLog(contents)
+	require.NoError(t, err, "Failed to parse the audit log of %s", host.Hostname)
+
+	requests := findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_REQUEST, "read", secretPath, accessor)
+	assert.NotEmpty(t, requests, "Expected the audit log of %s to have the request to read %s with the token with accessor %s", host.Hostname, secretPath, accessor)
+
+	responses := findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_RESPONSE, "read", secretPath, accessor)
+	require.NotEmpty(t, responses, "Expected the audit log of %s to have the response to the read of %s with the token with accessor %s", host.Hostname, secretPath, accessor)
+
+	for _, response := range responses {
+		assert.True(t, strings.HasPrefix(response.Auth.ClientToken, VAULT_AUDIT_HMAC_PREFIX), "Expected the token in the audit log to be hashed, but got %q", response.Auth.ClientToken)
+		require.NotNil(t, response.Response, "Expected the audit log entry of the response to include the response")
+
+		secret := fmt.Sprint(response.Response.Data["the_answer"])
+		assert.True(t, strings.HasPrefix(secret, VAULT_AUDIT_HMAC_PREFIX), "Expected the secret in the audit log to be hashed, but got %q", secret)
+	}
+
+	assert.NotContains(t, contents, fmt.Sprintf(`"the_answer":%q`, expectedSecret), "Expected the value of the secret to only show up hashed in the audit log")
+}
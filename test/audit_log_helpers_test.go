@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The entries Vault 1.6 logs for a read of the example secret, along with a login, the way the file audit device
+// writes them with hmac_accessor=false
+const exampleAuditLog = `{"time":"2021-05-04T10:00:00.000Z","type":"request","auth":{"token_type":"default"},"request":{"id":"1","operation":"update","mount_type":"aws","path":"auth/aws/login","data":{"role":"hmac-sha256:aaaa"},"remote_address":"10.0.0.20"}}
+{"time":"2021-05-04T10:00:00.100Z","type":"response","auth":{"client_token":"hmac-sha256:bbbb","accessor":"dAWvTWNAp5H8Wwza3DOE7YGn","display_name":"aws-vault-auth-role","policies":["default","example-policy"],"token_type":"service"},"request":{"id":"1","operation":"update","path":"auth/aws/login","remote_address":"10.0.0.20"},"response":{"auth":{"client_token":"hmac-sha256:bbbb","accessor":"dAWvTWNAp5H8Wwza3DOE7YGn"}}}
+
+{"time":"2021-05-04T10:00:01.000Z","type":"request","auth":{"client_token":"hmac-sha256:bbbb","accessor":"dAWvTWNAp5H8Wwza3DOE7YGn","policies":["default","example-policy"],"metadata":{"auth_type":"iam"}},"request":{"id":"2","operation":"read","mount_type":"kv","client_token":"hmac-sha256:bbbb","client_token_accessor":"dAWvTWNAp5H8Wwza3DOE7YGn","path":"secret/example_gruntwork","remote_address":"10.0.0.20"}}
+{"time":"2021-05-04T10:00:01.100Z","type":"response","auth":{"client_token":"hmac-sha256:bbbb","accessor":"dAWvTWNAp5H8Wwza3DOE7YGn","policies":["default","example-policy"],"metadata":{"auth_type":"iam"}},"request":{"id":"2","operation":"read","path":"secret/example_gruntwork"},"response":{"data":{"the_answer":"hmac-sha256:cccc"}}}
+{"time":"2021-05-04T10:00:02.000Z","type":"response","auth":{"client_token":"hmac-sha256:dddd","accessor":"kLz6y3W1bV8yT7nUq0tE2rXa"},"request":{"id":"3","operation":"read","path":"secret/example_gruntwork"},"response":{"data":{"the_answer":"hmac-sha256:cccc"}}}
+`
+
+func TestParseAuditLog(t *testing.T) {
+	t.Parallel()
+
+	entries, err := parseAuditLog(exampleAuditLog)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+
+	login := entries[1]
+	assert.Equal(t, AUDIT_ENTRY_TYPE_RESPONSE, login.Type)
+	assert.Equal(t, "auth/aws/login", login.Request.Path)
+	assert.Equal(t, "dAWvTWNAp5H8Wwza3DOE7YGn", login.Auth.Accessor)
+	assert.Equal(t, []string{"default", "example-policy"}, login.Auth.Policies)
+
+	read := entries[3]
+	assert.Equal(t, "iam", read.Auth.Metadata["auth_type"])
+	assert.Equal(t, "hmac-sha256:cccc", read.Response.Data["the_answer"])
+
+	_, err = parseAuditLog(exampleAuditLog + "{\"type\":\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 7")
+}
+
+func TestFindAuditLogEntries(t *testing.T) {
+	t.Parallel()
+
+	entries, err := parseAuditLog(exampleAuditLog)
+	require.NoError(t, err)
+
+	requests := findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_REQUEST, "read", EXAMPLE_SECRET_PATH, "dAWvTWNAp5H8Wwza3DOE7YGn")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "2", requests[0].Request.ID)
+
+	responses := findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_RESPONSE, "read", EXAMPLE_SECRET_PATH, "dAWvTWNAp5H8Wwza3DOE7YGn")
+	require.Len(t, responses, 1)
+	assert.Equal(t, "2", responses[0].Request.ID)
+
+	assert.Empty(t, findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_RESPONSE, "read", EXAMPLE_SECRET_PATH, "unknown-accessor"))
+	assert.Empty(t, findAuditLogEntries(entries, AUDIT_ENTRY_TYPE_RESPONSE, "update", EXAMPLE_SECRET_PATH, "dAWvTWNAp5H8Wwza3DOE7YGn"))
+}
@@ -0,0 +1,329 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/gruntwork-io/terraform-aws-vault/modules/sign-request/awsiamauth"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultbootstrap"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The policy and max_ttl the vault-ec2-auth and vault-iam-auth examples give their Vault role
+const AWS_AUTH_EXAMPLE_POLICY = "example-policy"
+const AWS_AUTH_ROLE_MAX_TTL = 500 * time.Hour
+
+// The header value the client in the vault-iam-auth example signs its login requests with
+const AWS_AUTH_IAM_SERVER_ID = "vault.service.consul"
+
+// The vault-iam-auth example declares the policy and Vault role its User Data creates in this folder. The auth method
+// files take the name of the Vault role and the ARN of the IAM role the client has as variables.
+const IAM_AUTH_BOOTSTRAP_DIR = "vault-config"
+const IAM_AUTH_BOOTSTRAP_VAR_ROLE_NAME = "example_role_name"
+const IAM_AUTH_BOOTSTRAP_VAR_ROLE_ARN = "example_role_arn"
+
+// The User Data of the vault-iam-auth example initializes Vault itself, and the output of vault operator init, with the
+// root token, ends up in its log
+const IAM_AUTH_USER_DATA_LOG_PATH = "/var/log/user-data.log"
+
+// A path outside of the secret/example_* prefix the example policy covers
+const SECRET_PATH_OUTSIDE_POLICY = "secret/other_gruntwork"
+
+// Vault refuses logins the AWS auth method rejects with a 400 and the reason, and requests the policies of a token
+// don't allow with a 403
+const VAULT_ERROR_PERMISSION_DENIED = "permission denied"
+const VAULT_ERROR_ROLE_NOT_FOUND = "entry for role"
+const VAULT_ERROR_IAM_PRINCIPAL_NOT_BOUND = "does not belong to the role"
+
+// Read the EC2 instance identity document from the metadata of an instance, signed by AWS in PKCS7 format. This is
+// the identity the ec2 auth type logs in with.
+const getPkcs7FromMetadataCommand = "curl --silent --show-error --fail http://169.254.169.254/latest/dynamic/instance-identity/pkcs7 | tr -d '\\n'"
+const getInstanceIdFromMetadataCommand = "curl --silent --show-error --fail http://169.254.169.254/latest/meta-data/instance-id"
+
+// Read the temporary AWS credentials of the IAM role of an instance from its metadata. These are the credentials the
+// iam auth type signs the sts:GetCallerIdentity request with on the instance.
+const getInstanceProfileCredentialsCommand = `role=$(curl --silent --show-error --fail http://169.254.169.254/latest/meta-data/iam/security-credentials/) && curl --silent --show-error --fail "http://169.254.169.254/latest/meta-data/iam/security-credentials/$role"`
+
+// The temporary credentials in the instance metadata, as documented at
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/iam-roles-for-amazon-ec2.html#instance-metadata-security-credentials
+type instanceProfileCredentials struct {
+	Code            string
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+}
+
+func parseInstanceProfileCredentials(output string) (*credentials.Credentials, error) {
+	parsed := instanceProfileCredentials{}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		return nil, fmt.Errorf("Failed to parse instance profile credentials: %v", err)
+	}
+	if parsed.Code != "Success" || parsed.AccessKeyId == "" || parsed.SecretAccessKey == "" {
+		return nil, fmt.Errorf("Instance metadata returned no usable credentials (code %q)", parsed.Code)
+	}
+	return credentials.NewStaticCredentials(parsed.AccessKeyId, parsed.SecretAccessKey, parsed.Token), nil
+}
+
+// Get the temporary credentials of the IAM role of the instance at the given host, so the test can sign login requests
+// as that instance
+func getInstanceProfileCredentials(t *testing.T, host ssh.Host) *credentials.Credentials {
+	output, err := ssh.CheckSshCommandE(t, host, getInstanceProfileCredentialsCommand)
+	require.NoError(t, err, "Failed to read the instance profile credentials of %s from its metadata", host.Hostname)
+
+	creds, err := parseInstanceProfileCredentials(output)
+	require.NoError(t, err, "Failed to read the instance profile credentials of %s", host.Hostname)
+	return creds
+}
+
+// Log in with the ec2 auth type as the given role, with the PKCS7 signed identity document of an instance. The nonce
+// is needed to log in again with the same identity.
+func loginWithEc2Identity(client *api.Client, roleName string, pkcs7 string, nonce string) (*api.Secret, error) {
+	return client.Logical().Write(fmt.Sprintf("%s/login", awsiamauth.DefaultMountPath), map[string]interface{}{
+		"role":  roleName,
+		"pkcs7": pkcs7,
+		"nonce": nonce,
+	})
+}
+
+// Log in to the Vault node at the given host with the ec2 auth type, using the identity of the node itself: the role
+// in the vault-ec2-auth example only lets in instances running the AMI under test, which the nodes do too. Check the
+// token it gets back and that it can read the given secret. The client instance in the example already logged in with
+// its own identity, without a nonce, so Vault would only let the test log in with that identity with the nonce it
+// generated then.
+func testEc2AuthLogin(t *testing.T, host ssh.Host, tlsCert TlsCert, roleName string, amiId string, awsRegion string, secretPath string, expectedSecret string) {
+	pkcs7 := getPkcs7Identity(t, host)
+
+	instanceId, err := ssh.CheckSshCommandE(t, host, getInstanceIdFromMetadataCommand)
+	require.NoError(t, err, "Failed to read the instance ID of %s from its metadata", host.Hostname)
+
+	client := createVaultClientWithCert(t, net.JoinHostPort(host.Hostname, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+	nonce := random.UniqueId()
+
+	secret, err := loginWithEc2Identity(client, roleName, pkcs7, nonce)
+	require.NoError(t, err, "Expected the PKCS7 identity of %s to log in as role %s", host.Hostname, roleName)
+	require.NotNil(t, secret)
+	require.NotNil(t, secret.Auth, "Expected the ec2 login response from %s to include a token", host.Hostname)
+
+	checkAwsAuthToken(t, client, secret, map[string]string{
+		"auth_type":   "ec2",
+		"account_id":  aws.GetAccountId(t),
+		"ami_id":      amiId,
+		"instance_id": strings.TrimSpace(instanceId),
+		"region":      awsRegion,
+	})
+	checkSecretReadableWithToken(t, client, secretPath, expectedSecret)
+	checkTokenLimitedToPolicy(t, client, secretPath, expectedSecret)
+
+	// With the nonce, the same identity can log in again
+	_, err = loginWithEc2Identity(client, roleName, pkcs7, nonce)
+	assert.NoError(t, err, "Expected the PKCS7 identity of %s to log in again with the nonce of its first login", host.Hostname)
+}
+
+// Check that the Vault node at the given host doesn't let the PKCS7 identity of the node log in as a role that doesn't
+// exist
+func testEc2AuthRejectsInvalidLogins(t *testing.T, host ssh.Host, tlsCert TlsCert, roleName string) {
+	client := createVaultClientWithCert(t, net.JoinHostPort(host.Hostname, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+	wrongRoleName := fmt.Sprintf("%s-missing", roleName)
+
+	_, err := loginWithEc2Identity(client, wrongRoleName, getPkcs7Identity(t, host), random.UniqueId())
+	assertVaultError(t, err, http.StatusBadRequest, VAULT_ERROR_ROLE_NOT_FOUND, "Expected an ec2 login as role %s, which doesn't exist, to be rejected", wrongRoleName)
+}
+
+// Read the PKCS7 identity document of the instance at the given host from its metadata
+func getPkcs7Identity(t *testing.T, host ssh.Host) string {
+	pkcs7, err := ssh.CheckSshCommandE(t, host, getPkcs7FromMetadataCommand)
+	require.NoError(t, err, "Failed to read the PKCS7 identity document of %s from its metadata", host.Hostname)
+
+	pkcs7 = strings.TrimSpace(pkcs7)
+	require.NotEmpty(t, pkcs7, "Expected %s to have a PKCS7 identity document", host.Hostname)
+	return pkcs7
+}
+
+// Check that applying the vault-config folder of the vault-iam-auth example deployed from the given folder to the given
+// Vault node changes nothing, as its User Data already created the policy and Vault role the folder declares. This
+// uses the root token the User Data logs when it initializes Vault, and waits for the User Data to write the example
+// secret at the given path, which it does once it created the policy and the role.
+func testIamAuthBootstrapDir(t *testing.T, examplesDir string, host ssh.Host, tlsCert TlsCert, roleName string, roleArn string, secretPath string) {
+	description := fmt.Sprintf("Reading the root token from %s on %s", IAM_AUTH_USER_DATA_LOG_PATH, host.Hostname)
+	rootToken := retry.DoWithRetry(t, description, 30, 10*time.Second, func() (string, error) {
+		output, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", IAM_AUTH_USER_DATA_LOG_PATH))
+		if err != nil {
+			return "", err
+		}
+		// Don't log the output, which has the unseal keys and the root token
+		response, err := vaulttest.ParseInitResponseE(output)
+		if err != nil {
+			return "", fmt.Errorf("Did not find the output of vault operator init in %s on %s yet", IAM_AUTH_USER_DATA_LOG_PATH, host.Hostname)
+		}
+		return response.RootToken, nil
+	})
+
+	client := createVaultClientWithCert(t, net.JoinHostPort(host.Hostname, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+	client.SetToken(rootToken)
+
+	description = fmt.Sprintf("Waiting for the User Data of %s to write %s", host.Hostname, secretPath)
+	retry.DoWithRetry(t, description, 30, 10*time.Second, func() (string, error) {
+		secret, err := client.Logical().Read(secretPath)
+		if err != nil {
+			return "", err
+		}
+		if secret == nil {
+			return "", fmt.Errorf("%s doesn't exist yet", secretPath)
+		}
+		return "", nil
+	})
+
+	dir := filepath.Join(examplesDir, IAM_AUTH_BOOTSTRAP_DIR)
+	plan := vaultbootstrap.ApplyDirWithVars(t, client, dir, map[string]string{
+		IAM_AUTH_BOOTSTRAP_VAR_ROLE_NAME: roleName,
+		IAM_AUTH_BOOTSTRAP_VAR_ROLE_ARN:  roleArn,
+	})
+	assert.False(t, plan.HasChanges(), "Expected %s to match the policy, auth method and Vault role the User Data created", dir)
+	assert.Equal(t, 3, plan.Count(vaultbootstrap.NoChange), "Expected %s to declare the policy, the auth method and the Vault role", dir)
+}
+
+// Log in to the Vault node at the given host with the iam auth type, signing the sts:GetCallerIdentity request with
+// the credentials of the IAM role of the client instance in the vault-iam-auth example, the same way the client does.
+// Check the token it gets back and that it can read the given secret, and return the accessor of the token.
+func testIamAuthLogin(t *testing.T, host string, clientHost ssh.Host, tlsCert TlsCert, roleName string, roleArn string, secretPath string, expectedSecret string) string {
+	creds := getInstanceProfileCredentials(t, clientHost)
+	client := createVaultClientWithCert(t, net.JoinHostPort(host, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+
+	secret, err := awsiamauth.Login(client, awsiamauth.DefaultMountPath, roleName, awsiamauth.Options{
+		ServerId:    AWS_AUTH_IAM_SERVER_ID,
+		Credentials: creds,
+	})
+	require.NoError(t, err, "Expected a request signed with the credentials of %s to log in as role %s", roleArn, roleName)
+	require.NotNil(t, secret)
+	require.NotNil(t, secret.Auth, "Expected the iam login response from %s to include a token", host)
+
+	checkAwsAuthToken(t, client, secret, map[string]string{
+		"auth_type":     "iam",
+		"account_id":    aws.GetAccountId(t),
+		"canonical_arn": roleArn,
+	})
+	checkSecretReadableWithToken(t, client, secretPath, expectedSecret)
+	checkTokenLimitedToPolicy(t, client, secretPath, expectedSecret)
+	return secret.Auth.Accessor
+}
+
+// Check that the Vault node at the given host doesn't let in requests signed with the credentials of an instance with
+// another IAM role than the one the Vault role is bound to (e.g. a Vault node, which has the IAM role of the cluster),
+// nor requests signed with the right credentials that log in as a role that doesn't exist
+func testIamAuthRejectsInvalidLogins(t *testing.T, host string, clientHost ssh.Host, otherHost ssh.Host, tlsCert TlsCert, roleName string) {
+	client := createVaultClientWithCert(t, net.JoinHostPort(host, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+
+	_, err := awsiamauth.Login(client, awsiamauth.DefaultMountPath, roleName, awsiamauth.Options{
+		ServerId:    AWS_AUTH_IAM_SERVER_ID,
+		Credentials: getInstanceProfileCredentials(t, otherHost),
+	})
+	assertVaultError(t, err, http.StatusBadRequest, VAULT_ERROR_IAM_PRINCIPAL_NOT_BOUND, "Expected a login as role %s with the IAM role of %s to be rejected", roleName, otherHost.Hostname)
+
+	wrongRoleName := fmt.Sprintf("%s-missing", roleName)
+	_, err = awsiamauth.Login(client, awsiamauth.DefaultMountPath, wrongRoleName, awsiamauth.Options{
+		ServerId:    AWS_AUTH_IAM_SERVER_ID,
+		Credentials: getInstanceProfileCredentials(t, clientHost),
+	})
+	assertVaultError(t, err, http.StatusBadRequest, VAULT_ERROR_ROLE_NOT_FOUND, "Expected an iam login as role %s, which doesn't exist, to be rejected", wrongRoleName)
+}
+
+// Check that the token in the given login response has the policies, TTL and metadata the examples give it, both in
+// the response and as Vault reports it when the token looks itself up. The examples configure the identity
+// integration of the AWS auth method, so the metadata includes which instance or IAM role logged in. Sets the token on
+// the client.
+func checkAwsAuthToken(t *testing.T, client *api.Client, loginSecret *api.Secret, expectedMetadata map[string]string) {
+	client.SetToken(loginSecret.Auth.ClientToken)
+
+	tokenSecret, err := client.Auth().Token().LookupSelf()
+	require.NoError(t, err, "Expected the token from the login to be able to look itself up")
+
+	for description, secret := range map[string]*api.Secret{"login response": loginSecret, "token lookup": tokenSecret} {
+		policies, err := secret.TokenPolicies()
+		if assert.NoError(t, err, "Failed to read the policies in the %s", description) {
+			assert.Contains(t, policies, AWS_AUTH_EXAMPLE_POLICY, "Expected the token in the %s to have the policy of the role", description)
+		}
+
+		ttl, err := secret.TokenTTL()
+		if assert.NoError(t, err, "Failed to read the TTL in the %s", description) {
+			// The default TTL is longer than the max_ttl of the role, so the token gets the max_ttl. The lookup
+			// happens a little later, so it reports a little less.
+			assert.True(t, ttl <= AWS_AUTH_ROLE_MAX_TTL && ttl > AWS_AUTH_ROLE_MAX_TTL-time.Minute, "Expected the token in the %s to have a TTL of %s, the max_ttl of the role, but got %s", description, AWS_AUTH_ROLE_MAX_TTL, ttl)
+		}
+
+		renewable, err := secret.TokenIsRenewable()
+		if assert.NoError(t, err, "Failed to read whether the token in the %s is renewable", description) {
+			assert.True(t, renewable, "Expected the token in the %s to be renewable", description)
+		}
+
+		metadata, err := secret.TokenMetadata()
+		if assert.NoError(t, err, "Failed to read the metadata in the %s", description) {
+			for key, expectedValue := range expectedMetadata {
+				assert.Equal(t, expectedValue, metadata[key], "Unexpected value of %s in the metadata of the token in the %s", key, description)
+			}
+		}
+	}
+}
+
+// Check that the token set on the client can read the given secret and that it has the given value
+func checkSecretReadableWithToken(t *testing.T, client *api.Client, secretPath string, expectedSecret string) {
+	data, err := client.Logical().Read(secretPath)
+	require.NoError(t, err, "Expected the token from the login to be able to read %s", secretPath)
+	require.NotNil(t, data, "Expected to find the secret %s", secretPath)
+	assert.Equal(t, expectedSecret, fmt.Sprint(data.Data["the_answer"]), "Unexpected value of the secret %s", secretPath)
+}
+
+// Check that the token set on the client only gets what the example policy allows: it can't read outside the
+// secret/example_* prefix, and, as the policy allows create and read, but not update, it can't overwrite the given
+// secret
+func checkTokenLimitedToPolicy(t *testing.T, client *api.Client, secretPath string, expectedSecret string) {
+	_, err := client.Logical().Read(SECRET_PATH_OUTSIDE_POLICY)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the token to be denied reading %s", SECRET_PATH_OUTSIDE_POLICY)
+
+	_, err = client.Logical().Write(secretPath, map[string]interface{}{"the_answer": "forged"})
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the token to be denied overwriting %s", secretPath)
+
+	checkSecretReadableWithToken(t, client, secretPath, expectedSecret)
+}
+
+// Assert that the given error is an error response from Vault with the given status code and message
+func assertVaultError(t *testing.T, err error, expectedStatusCode int, expectedMessage string, msgAndArgs ...interface{}) {
+	assert.NoError(t, checkVaultError(err, expectedStatusCode, expectedMessage), msgAndArgs...)
+}
+
+func checkVaultError(err error, expectedStatusCode int, expectedMessage string) error {
+	if err == nil {
+		return fmt.Errorf("Expected Vault to respond with a %d error containing %q, but the request succeeded", expectedStatusCode, expectedMessage)
+	}
+
+	var responseErr *api.ResponseError
+	if !errors.As(err, &responseErr) {
+		return fmt.Errorf("Expected Vault to respond with a %d error containing %q, but the request failed with: %v", expectedStatusCode, expectedMessage, err)
+	}
+
+	if responseErr.StatusCode != expectedStatusCode {
+		return fmt.Errorf("Expected Vault to respond with a %d error containing %q, but got a %d error: %v", expectedStatusCode, expectedMessage, responseErr.StatusCode, responseErr.Errors)
+	}
+
+	for _, message := range responseErr.Errors {
+		if strings.Contains(message, expectedMessage) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Expected Vault to respond with a %d error containing %q, but got: %v", expectedStatusCode, expectedMessage, responseErr.Errors)
+}
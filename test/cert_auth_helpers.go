@@ -0,0 +1,184 @@
+package test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const TLS_CLIENT_CERT_COMMON_NAME = "Vault Module Test Client"
+
+// The path the cert auth method is enabled at in the vault-cert-auth example
+const CERT_AUTH_MOUNT_PATH = "auth/cert"
+
+// The client cert the vault-cert-auth example issues for its auth client, from the CA Vault trusts for client certs
+const OUTPUT_AUTH_CLIENT_CERT = "auth_client_cert_pem"
+const OUTPUT_AUTH_CLIENT_PRIVATE_KEY = "auth_client_private_key_pem"
+
+// Issue a client cert from the given CA
+func issueTlsClientCertFromCA(t *testing.T, ca *tlscert.CA) *tlscert.Cert {
+	cert, err := ca.IssueCert(tlscert.CertOptions{
+		CommonName:   TLS_CLIENT_CERT_COMMON_NAME,
+		Organization: TLS_CERT_ORGANIZATION_NAME,
+		Validity:     time.Hour,
+		ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err, "Couldn't issue a TLS client cert")
+	return cert
+}
+
+// Load the client cert the vault-cert-auth example deployed with the given Terraform options issued for its auth client
+func loadAuthClientCert(t *testing.T, terraformOptions *terraform.Options) *tlscert.Cert {
+	certPEM := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_CLIENT_CERT)
+	keyPEM := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_CLIENT_PRIVATE_KEY)
+	return parseTlsCertPEM(t, []byte(certPEM), []byte(keyPEM))
+}
+
+// Load the given TLS cert and its private key, e.g. to check it can't be used as a client cert
+func loadTlsCertWithKey(t *testing.T, tlsCert TlsCert) *tlscert.Cert {
+	certPEM, err := ioutil.ReadFile(tlsCert.ChainPath)
+	require.NoError(t, err, "Couldn't read the chain of the TLS cert")
+
+	keyPEM, err := ioutil.ReadFile(tlsCert.PrivateKeyPath)
+	require.NoError(t, err, "Couldn't read the private key of the TLS cert")
+
+	return parseTlsCertPEM(t, certPEM, keyPEM)
+}
+
+// Parse a TLS cert, followed by the intermediate CA certs that signed it, and its private key from the given PEM data
+func parseTlsCertPEM(t *testing.T, certPEM []byte, keyPEM []byte) *tlscert.Cert {
+	certs, err := tlscert.ParseCertsPEM(certPEM)
+	require.NoError(t, err, "Couldn't parse the TLS cert")
+
+	key, err := tlscert.ParseKeyPEM(keyPEM)
+	require.NoError(t, err, "Couldn't parse the private key of the TLS cert")
+
+	return &tlscert.Cert{Cert: certs[0], Key: key, Chain: certs[1:]}
+}
+
+// Create a Vault client for the Vault node at the given host:port that verifies the node's cert against the CA of the
+// given TLS cert and, if clientCert isn't nil, presents clientCert. The test cert isn't valid for the public IPs of the
+// nodes, so the client checks it against vault.service.consul instead.
+func createVaultClientWithCert(t *testing.T, address string, tlsCert TlsCert, clientCert *tlscert.Cert) *api.Client {
+	return newVaultClient(t, createVaultConfigWithCert(t, address, tlsCert, clientCert))
+}
+
+// Create the config of the Vault client createVaultClientWithCert creates, for callers that need to tweak it further
+func createVaultConfigWithCert(t *testing.T, address string, tlsCert TlsCert, clientCert *tlscert.Cert) *api.Config {
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("https://%s", address)
+	config.MaxRetries = 0
+
+	roots := x509.NewCertPool()
+	roots.AddCert(loadTlsCertCA(t, tlsCert).Cert)
+
+	clientTLSConfig := config.HttpClient.Transport.(*http.Transport).TLSClientConfig
+	clientTLSConfig.RootCAs = roots
+	clientTLSConfig.ServerName = DefaultTlsCertOptions.DNSNames[0]
+
+	if clientCert != nil {
+		keyPEM, err := tlscert.EncodeKeyPEM(clientCert.Key)
+		require.NoError(t, err)
+
+		keyPair, err := tls.X509KeyPair(clientCert.ChainPEM(), keyPEM)
+		require.NoError(t, err)
+
+		clientTLSConfig.Certificates = []tls.Certificate{keyPair}
+	}
+
+	return config
+}
+
+// Create a Vault client with the given config
+func newVaultClient(t *testing.T, config *api.Config) *api.Client {
+	client, err := api.NewClient(config)
+	require.NoError(t, err, "Failed to create Vault client")
+
+	// Start from a clean slate, rather than whatever VAULT_TOKEN the environment running the tests has
+	client.ClearToken()
+
+	return client
+}
+
+// Log in with the cert auth method as the given role, using the client cert the given client presents
+func loginWithCert(client *api.Client, roleName string) (*api.Secret, error) {
+	return client.Logical().Write(fmt.Sprintf("%s/login", CERT_AUTH_MOUNT_PATH), map[string]interface{}{
+		"name": roleName,
+	})
+}
+
+// Check that a client presenting the given client cert can log in to the Vault node at the given host as the given
+// role, and that the token it gets back can read the given secret. The cert of the Vault node must be signed by the CA
+// of the given TLS cert.
+func testCertAuthLogin(t *testing.T, host string, tlsCert TlsCert, clientCert *tlscert.Cert, roleName string, secretPath string, expectedSecret string) {
+	address := net.JoinHostPort(host, strconv.Itoa(vaultApiPort))
+	client := createVaultClientWithCert(t, address, tlsCert, clientCert)
+
+	secret, err := loginWithCert(client, roleName)
+	require.NoError(t, err, "Expected a client with a valid cert to be able to log in to %s", host)
+	require.NotNil(t, secret)
+	require.NotNil(t, secret.Auth, "Expected the login response from %s to include a token", host)
+
+	assert.Contains(t, secret.Auth.Policies, "example-policy")
+	assert.Equal(t, clientCert.Cert.Subject.CommonName, secret.Auth.Metadata["common_name"])
+
+	client.SetToken(secret.Auth.ClientToken)
+
+	data, err := client.Logical().Read(secretPath)
+	require.NoError(t, err)
+	require.NotNil(t, data, "Expected to find the secret %s", secretPath)
+	assert.Equal(t, expectedSecret, fmt.Sprint(data.Data["the_answer"]))
+}
+
+// Check that the Vault node at the given host rejects clients that don't present a cert, as well as clients that
+// present a cert from a CA it doesn't trust, before they even get to log in. Vault only trusts the CA for client certs,
+// so that includes the given TLS cert, which Vault itself serves.
+func testCertAuthRejectsInvalidClients(t *testing.T, host string, tlsCert TlsCert, roleName string) {
+	address := net.JoinHostPort(host, strconv.Itoa(vaultApiPort))
+
+	otherCA, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Untrusted CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	clients := map[string]*api.Client{
+		"no client cert":            createVaultClientWithCert(t, address, tlsCert, nil),
+		"client cert from other CA": createVaultClientWithCert(t, address, tlsCert, issueTlsClientCertFromCA(t, otherCA)),
+		"the server cert":           createVaultClientWithCert(t, address, tlsCert, loadTlsCertWithKey(t, tlsCert)),
+	}
+
+	for description, client := range clients {
+		_, err := loginWithCert(client, roleName)
+		if assert.Error(t, err, "Expected a client with %s to be rejected by %s", description, host) {
+			logger.Logf(t, "Client with %s was rejected by %s: %v", description, host, err)
+			assert.True(t, isTlsClientCertError(err), "Expected a client with %s to be rejected in the TLS handshake, but got: %v", description, err)
+		}
+	}
+}
+
+// Vault rejects clients without a valid cert in the TLS handshake. The client only sees this as an alert, which, with
+// TLS 1.3, arrives after its side of the handshake is done, so the error can come from the first read instead.
+func isTlsClientCertError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, alert := range []string{"tls: certificate required", "tls: bad certificate", "tls: unknown certificate authority"} {
+		if strings.Contains(err.Error(), alert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Start a local HTTPS server that serves the given TLS cert and, like Vault with --tls-require-client-cert, only accepts
+// clients with a cert signed by the given CA. Its login endpoint responds with the common name of the client cert.
+func startFakeCertAuthServer(t *testing.T, tlsCert TlsCert, clientCA *tlscert.CA) *httptest.Server {
+	keyPair, err := tls.LoadX509KeyPair(tlsCert.ChainPath, tlsCert.PrivateKeyPath)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.Cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/"+CERT_AUTH_MOUNT_PATH+"/login" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token": "s.test",
+				"policies":     []string{"default", "example-policy"},
+				"metadata":     map[string]string{"common_name": r.TLS.PeerCertificates[0].Subject.CommonName},
+			},
+		})
+	}))
+	// The server logs every rejected handshake, which is the point of the test
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	return server
+}
+
+func TestCertAuthClients(t *testing.T) {
+	t.Parallel()
+
+	tlsCert := generateSelfSignedTlsCert(t)
+	defer cleanupTlsCertFiles(tlsCert)
+
+	clientCA, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Client CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	server := startFakeCertAuthServer(t, tlsCert, clientCA)
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	otherCA, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Untrusted CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	validClient := createVaultClientWithCert(t, address, tlsCert, issueTlsClientCertFromCA(t, clientCA))
+	secret, err := loginWithCert(validClient, "example-role")
+	require.NoError(t, err)
+	require.NotNil(t, secret.Auth)
+	assert.Equal(t, "s.test", secret.Auth.ClientToken)
+	assert.Equal(t, TLS_CLIENT_CERT_COMMON_NAME, secret.Auth.Metadata["common_name"])
+
+	invalidClients := map[string]*tlscert.Cert{
+		"no client cert":            nil,
+		"client cert from other CA": issueTlsClientCertFromCA(t, otherCA),
+		"the server cert":           loadTlsCertWithKey(t, tlsCert),
+	}
+
+	for description, clientCert := range invalidClients {
+		_, err := loginWithCert(createVaultClientWithCert(t, address, tlsCert, clientCert), "example-role")
+		require.Error(t, err, description)
+		assert.True(t, isTlsClientCertError(err), "Expected a TLS client cert error for %s, but got: %v", description, err)
+	}
+}
+
+func TestIsTlsClientCertError(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, isTlsClientCertError(nil))
+	assert.False(t, isTlsClientCertError(errors.New("connection refused")))
+	assert.True(t, isTlsClientCertError(errors.New("remote error: tls: certificate required")))
+	assert.True(t, isTlsClientCertError(errors.New("remote error: tls: bad certificate")))
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/gruntwork-io/terratest/modules/logger"
+)
+
+const UPDATE_CERTIFICATE_STORE_SCRIPT_PATH = "modules/update-certificate-store/update-certificate-store"
+
+// CertificateStoreLayout describes where an OS family keeps its certificate store, and how the tool that rebuilds the
+// CA bundle works, so we can fake it under a temp root folder
+type CertificateStoreLayout struct {
+	// The command update-certificate-store looks for to detect this OS family
+	Tool string
+
+	// The folder update-certificate-store copies the CA into, and the environment variable that overrides it
+	AnchorsDir    string
+	AnchorsDirEnv string
+
+	// The folder the distro ships its own CA certs in
+	DistroCertsDir string
+
+	// The bundle the tool writes, and the path Go's crypto/x509 loads the system roots from on a real server. On Amazon
+	// Linux the latter is a symlink to the former.
+	BundlePath   string
+	GoBundlePath string
+
+	// The body of the stub script standing in for the tool. It gets the fake root in $FAKE_ROOT.
+	StubScript string
+}
+
+// The real certificate store tools rebuild the bundle by concatenating the distro CA certs with the ones added
+// locally. update-ca-certificates only picks up files ending in .crt.
+var certificateStoreLayouts = map[string]CertificateStoreLayout{
+	"ubuntu": {
+		Tool:           "update-ca-certificates",
+		AnchorsDir:     "/usr/local/share/ca-certificates",
+		AnchorsDirEnv:  "UPDATE_CA_CERTS_PATH",
+		DistroCertsDir: "/usr/share/ca-certificates/mozilla",
+		BundlePath:     "/etc/ssl/certs/ca-certificates.crt",
+		GoBundlePath:   "/etc/ssl/certs/ca-certificates.crt",
+		StubScript: `echo update-ca-certificates "$@" >> "$STUB_LOG_DIR/commands.log"
+cat "$FAKE_ROOT"/usr/share/ca-certificates/mozilla/*.crt "$FAKE_ROOT"/usr/local/share/ca-certificates/*.crt > "$FAKE_ROOT/etc/ssl/certs/ca-certificates.crt"`,
+	},
+	"amazon-linux": {
+		Tool:           "update-ca-trust",
+		AnchorsDir:     "/etc/pki/ca-trust/source/anchors",
+		AnchorsDirEnv:  "UPDATE_CA_TRUST_PATH",
+		DistroCertsDir: "/usr/share/pki/ca-trust-source/anchors",
+		BundlePath:     "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+		GoBundlePath:   "/etc/pki/tls/certs/ca-bundle.crt",
+		StubScript: `echo update-ca-trust "$@" >> "$STUB_LOG_DIR/commands.log"
+if [[ "$1" == "extract" ]]; then
+  cat "$FAKE_ROOT"/usr/share/pki/ca-trust-source/anchors/* "$FAKE_ROOT"/etc/pki/ca-trust/source/anchors/* > "$FAKE_ROOT/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"
+fi`,
+	},
+}
+
+// The real tools update-certificate-store needs. Only these and the stub for the certificate store tool are on the
+// PATH, so the script can't find the certificate store tools of the machine running the tests.
+var updateCertificateStoreRealTools = []string{"basename", "cat", "cp", "date"}
+
+// CertificateStoreResult is what running the update-certificate-store script against a fake root produced
+type CertificateStoreResult struct {
+	RootDir  string
+	Layout   CertificateStoreLayout
+	Commands []string
+	Output   string
+}
+
+// Path returns the absolute path inside the fake root of the given path on the server
+func (result CertificateStoreResult) Path(serverPath string) string {
+	return filepath.Join(result.RootDir, serverPath)
+}
+
+// The environment variable that tells the test binary it was started by VerifyWithSystemCertPool, and the ones that
+// pass the DNS name and the certs to verify to it
+const ENV_SYSTEM_CERT_POOL_HELPER = "VAULT_TEST_SYSTEM_CERT_POOL_HELPER"
+const ENV_SYSTEM_CERT_POOL_DNS_NAME = "VAULT_TEST_SYSTEM_CERT_POOL_DNS_NAME"
+const ENV_SYSTEM_CERT_POOL_CERTS_DIR = "VAULT_TEST_SYSTEM_CERT_POOL_CERTS_DIR"
+
+// VerifyWithSystemCertPool verifies each of the given certs for the given DNS name against the system cert pool of a
+// new process, with SSL_CERT_FILE pointed at the CA bundle in the fake root, the same way Go's crypto/x509 loads the
+// system roots on a real server of this OS family. Returns an error for each cert, nil if it's trusted. It runs the
+// test binary again with only TestHelperProcessSystemCertPool selected, as the system cert pool is only ever loaded
+// once per process.
+func (result CertificateStoreResult) VerifyWithSystemCertPool(t *testing.T, dnsName string, certs ...*x509.Certificate) []error {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping the system cert pool check, as crypto/x509 only reads SSL_CERT_FILE on Linux")
+	}
+
+	certsDir, err := ioutil.TempDir("", "system-cert-pool")
+	if err != nil {
+		t.Fatalf("Couldn't create temp folder: %v", err)
+	}
+	defer os.RemoveAll(certsDir)
+
+	for i, cert := range certs {
+		if err := ioutil.WriteFile(filepath.Join(certsDir, fmt.Sprintf("%d.pem", i)), tlscert.EncodeCertsPEM(cert), 0644); err != nil {
+			t.Fatalf("Couldn't write cert: %v", err)
+		}
+	}
+
+	// An empty SSL_CERT_DIR keeps the CA certs of the machine running the tests out of the pool
+	emptyCertDir := filepath.Join(certsDir, "empty")
+	if err := os.Mkdir(emptyCertDir, 0755); err != nil {
+		t.Fatalf("Couldn't create folder: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcessSystemCertPool$")
+	cmd.Env = append(os.Environ(),
+		ENV_SYSTEM_CERT_POOL_HELPER+"=1",
+		ENV_SYSTEM_CERT_POOL_DNS_NAME+"="+dnsName,
+		ENV_SYSTEM_CERT_POOL_CERTS_DIR+"="+certsDir,
+		"SSL_CERT_FILE="+result.Path(result.Layout.GoBundlePath),
+		"SSL_CERT_DIR="+emptyCertDir,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Couldn't verify the certs against the system cert pool: %v\n%s", err, output)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(certs) {
+		t.Fatalf("Expected a line per cert from the system cert pool helper, but got:\n%s", output)
+	}
+
+	errs := []error{}
+	for _, line := range lines {
+		if line == systemCertPoolTrusted {
+			errs = append(errs, nil)
+		} else {
+			errs = append(errs, errors.New(line))
+		}
+	}
+	return errs
+}
+
+// What the system cert pool helper prints for a trusted cert. For any other, it prints why it isn't trusted.
+const systemCertPoolTrusted = "trusted"
+
+// Run in the process VerifyWithSystemCertPool starts: verify each cert in the certs folder against the system cert
+// pool, printing a line per cert
+func verifyCertsWithSystemCertPool(certsDir string, dnsName string) error {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		contents, err := ioutil.ReadFile(filepath.Join(certsDir, fmt.Sprintf("%d.pem", i)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		certs, err := tlscert.ParseCertsPEM(contents)
+		if err != nil {
+			return err
+		}
+
+		if _, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, DNSName: dnsName}); err != nil {
+			fmt.Println(strings.Replace(err.Error(), "\n", " ", -1))
+		} else {
+			fmt.Println(systemCertPoolTrusted)
+		}
+	}
+}
+
+// Run the update-certificate-store script with the given arguments against a fake root folder laid out like the
+// certificate store of the given OS family, with the distro CA certs in distroCAs already trusted. Fails the test if
+// the script fails. The caller is responsible for deleting RootDir.
+func runUpdateCertificateStoreOffline(t *testing.T, osFamily string, distroCAs [][]byte, args ...string) CertificateStoreResult {
+	layout, ok := certificateStoreLayouts[osFamily]
+	if !ok {
+		t.Fatalf("Unknown OS family %s", osFamily)
+	}
+
+	rootDir, err := ioutil.TempDir("", "certificate-store")
+	if err != nil {
+		t.Fatalf("Couldn't create temp folder: %v", err)
+	}
+	result := CertificateStoreResult{RootDir: rootDir, Layout: layout}
+
+	for _, dir := range []string{layout.AnchorsDir, layout.DistroCertsDir, filepath.Dir(layout.BundlePath), filepath.Dir(layout.GoBundlePath), "stubs"} {
+		if err := os.MkdirAll(result.Path(dir), 0755); err != nil {
+			t.Fatalf("Couldn't create folder: %v", err)
+		}
+	}
+
+	if layout.GoBundlePath != layout.BundlePath {
+		if err := os.Symlink(result.Path(layout.BundlePath), result.Path(layout.GoBundlePath)); err != nil {
+			t.Fatalf("Couldn't link CA bundle: %v", err)
+		}
+	}
+
+	for i, ca := range distroCAs {
+		path := result.Path(filepath.Join(layout.DistroCertsDir, fmt.Sprintf("distro-ca-%d.crt", i)))
+		if err := ioutil.WriteFile(path, ca, 0644); err != nil {
+			t.Fatalf("Couldn't write %s: %v", path, err)
+		}
+	}
+
+	stubDir := result.Path("stubs")
+	writeStubScripts(t, stubDir, map[string]string{layout.Tool: layout.StubScript})
+	linkRealTools(t, stubDir, updateCertificateStoreRealTools)
+
+	cmd := exec.Command("bash", append([]string{filepath.Join(REPO_ROOT, UPDATE_CERTIFICATE_STORE_SCRIPT_PATH)}, args...)...)
+	cmd.Env = []string{
+		fmt.Sprintf("PATH=%s", stubDir),
+		fmt.Sprintf("FAKE_ROOT=%s", rootDir),
+		fmt.Sprintf("STUB_LOG_DIR=%s", rootDir),
+		fmt.Sprintf("%s=%s", layout.AnchorsDirEnv, result.Path(layout.AnchorsDir)),
+	}
+
+	output, err := cmd.CombinedOutput()
+	logger.Logf(t, "Output from update-certificate-store %s:\n%s", strings.Join(args, " "), output)
+
+	result.Output = string(output)
+	result.Commands = readLines(filepath.Join(rootDir, "commands.log"))
+
+	if err != nil {
+		t.Fatalf("update-certificate-store failed: %v\n%s", err, output)
+	}
+
+	return result
+}
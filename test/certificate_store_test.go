@@ -0,0 +1,99 @@
+package test
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateCertificateStore(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		osFamily         string
+		destFileName     string
+		expectedCommands []string
+	}{
+		{"ubuntu", "custom.crt", []string{"update-ca-certificates"}},
+		{"ubuntu", "vault-ca.crt", []string{"update-ca-certificates"}},
+		{"amazon-linux", "custom.crt", []string{"update-ca-trust enable", "update-ca-trust extract"}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.osFamily+"-"+testCase.destFileName, func(t *testing.T) {
+			t.Parallel()
+
+			distroCA := newTestRootCA(t, "Distro Root CA")
+			vaultCA := newTestRootCA(t, "Vault Module Test CA")
+			otherCA := newTestRootCA(t, "Untrusted CA")
+
+			distroCAPEM := tlscert.EncodeCertsPEM(distroCA.Cert)
+			vaultCAPEM := tlscert.EncodeCertsPEM(vaultCA.Cert)
+
+			tmpDir, err := ioutil.TempDir("", "vault-ca")
+			require.NoError(t, err)
+			defer os.RemoveAll(tmpDir)
+
+			caPath := filepath.Join(tmpDir, "ca.crt.pem")
+			require.NoError(t, ioutil.WriteFile(caPath, vaultCAPEM, 0644))
+
+			result := runUpdateCertificateStoreOffline(t, testCase.osFamily, [][]byte{distroCAPEM}, "--cert-file-path", caPath, "--dest-file-name", testCase.destFileName)
+			defer os.RemoveAll(result.RootDir)
+
+			assert.Equal(t, testCase.expectedCommands, result.Commands)
+
+			installedCA, err := ioutil.ReadFile(result.Path(filepath.Join(result.Layout.AnchorsDir, testCase.destFileName)))
+			require.NoError(t, err)
+			assert.Equal(t, string(vaultCAPEM), string(installedCA))
+
+			bundle, err := ioutil.ReadFile(result.Path(result.Layout.BundlePath))
+			require.NoError(t, err)
+			assert.Contains(t, string(bundle), string(vaultCAPEM), "Expected the CA to be in the bundle")
+			assert.Contains(t, string(bundle), string(distroCAPEM), "Expected the distro CAs to still be in the bundle")
+
+			errs := result.VerifyWithSystemCertPool(t, "vault.service.consul",
+				issueTestCert(t, vaultCA, "vault.service.consul"),
+				issueTestCert(t, distroCA, "vault.service.consul"),
+				issueTestCert(t, otherCA, "vault.service.consul"))
+
+			assert.NoError(t, errs[0], "Expected a leaf signed by the Vault CA to be trusted by the system cert pool")
+			assert.NoError(t, errs[1], "Expected a leaf signed by a distro CA to still be trusted by the system cert pool")
+			assert.Error(t, errs[2], "Expected a leaf signed by an unrelated CA not to be trusted by the system cert pool")
+		})
+	}
+}
+
+// Not a real test: VerifyWithSystemCertPool runs the test binary with only this test selected, in a process whose system
+// cert pool is loaded from the CA bundle in the fake root
+func TestHelperProcessSystemCertPool(t *testing.T) {
+	if os.Getenv(ENV_SYSTEM_CERT_POOL_HELPER) != "1" {
+		return
+	}
+
+	if err := verifyCertsWithSystemCertPool(os.Getenv(ENV_SYSTEM_CERT_POOL_CERTS_DIR), os.Getenv(ENV_SYSTEM_CERT_POOL_DNS_NAME)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func newTestRootCA(t *testing.T, commonName string) *tlscert.CA {
+	ca, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: commonName, Validity: time.Hour, Key: tlscert.KeyOptions{Algorithm: tlscert.ECDSA}})
+	require.NoError(t, err)
+	return ca
+}
+
+func issueTestCert(t *testing.T, ca *tlscert.CA, dnsName string) *x509.Certificate {
+	cert, err := ca.IssueCert(tlscert.CertOptions{CommonName: dnsName, DNSNames: []string{dnsName}, Validity: time.Hour, Key: tlscert.KeyOptions{Algorithm: tlscert.ECDSA}})
+	require.NoError(t, err)
+	return cert.Cert
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultbootstrap"
+	"github.com/hashicorp/vault/api"
+)
+
+const envVarVaultAddr = "VAULT_ADDR"
+const envVarVaultCaCert = "VAULT_CACERT"
+
+// The flags of the bootstrap command, which talks to the Vault API rather than SSHing to the nodes, so it doesn't take
+// the flags the other commands find the cluster with
+type bootstrapFlags struct {
+	dir           string
+	vars          stringSliceFlag
+	dryRun        bool
+	vaultAddr     string
+	caCert        string
+	tlsServerName string
+	token         string
+	json          bool
+}
+
+func (flags *bootstrapFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&flags.dir, "dir", "", "The directory with the policies/*.hcl and auth/*.yaml files to apply")
+	flagSet.Var(&flags.vars, "var", "A variable to fill in the auth method files with, as NAME=VALUE. Can be passed more than once.")
+	flagSet.BoolVar(&flags.dryRun, "dry-run", false, "Only print what would change, without applying it")
+	flagSet.StringVar(&flags.vaultAddr, "vault-addr", os.Getenv(envVarVaultAddr), "The address of the Vault API, e.g. https://vault.example.com:8200. Defaults to $"+envVarVaultAddr+".")
+	flagSet.StringVar(&flags.caCert, "ca-cert", os.Getenv(envVarVaultCaCert), "The CA certificate to verify the TLS certificate of Vault with. Defaults to $"+envVarVaultCaCert+".")
+	flagSet.StringVar(&flags.tlsServerName, "tls-server-name", "", "The name to verify the TLS certificate of Vault against, e.g. vault.service.consul when connecting to a node by IP")
+	flagSet.StringVar(&flags.token, "token", os.Getenv(envVarVaultToken), "A Vault token that can manage policies, auth methods and their roles. Defaults to $"+envVarVaultToken+".")
+	flagSet.BoolVar(&flags.json, "json", false, "Print the plan as JSON")
+}
+
+// The variables passed with --var, by name
+func (flags *bootstrapFlags) variables() (map[string]string, error) {
+	vars := map[string]string{}
+	for _, variable := range flags.vars {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("--var must be NAME=VALUE, got %q", variable)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+// Create a Vault client from the flags
+func (flags *bootstrapFlags) vaultClient() (*api.Client, error) {
+	if flags.vaultAddr == "" {
+		return nil, fmt.Errorf("--vault-addr is required, unless $%s is set", envVarVaultAddr)
+	}
+	if flags.token == "" {
+		return nil, fmt.Errorf("--token is required, unless $%s is set", envVarVaultToken)
+	}
+
+	config := api.DefaultConfig()
+	config.Address = flags.vaultAddr
+	if err := config.ConfigureTLS(&api.TLSConfig{CACert: flags.caCert, TLSServerName: flags.tlsServerName}); err != nil {
+		return nil, fmt.Errorf("Couldn't configure TLS: %v", err)
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(flags.token)
+	return client, nil
+}
+
+func runBootstrap(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	flags := &bootstrapFlags{}
+	flags.register(flagSet)
+	flagSet.SetOutput(ctx.stderr)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flags.dir == "" {
+		return errors.New("--dir is required")
+	}
+	ctx.json = flags.json
+
+	vars, err := flags.variables()
+	if err != nil {
+		return err
+	}
+
+	config, err := vaultbootstrap.LoadDirWithVars(flags.dir, vars)
+	if err != nil {
+		return err
+	}
+
+	client, err := flags.vaultClient()
+	if err != nil {
+		return err
+	}
+
+	plan, err := vaultbootstrap.NewPlan(client, config)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.print(plan, plan.Write); err != nil {
+		return err
+	}
+	if flags.dryRun || !plan.HasChanges() {
+		return nil
+	}
+
+	if err := plan.Apply(client); err != nil {
+		return err
+	}
+	if !ctx.json {
+		fmt.Fprintln(ctx.stdout, "Applied.")
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+)
+
+// Selects the current leader in --node
+const nodeLeader = "leader"
+
+// The status of a single node, as printed by the status, unseal and rolling-restart commands
+type nodeStatus struct {
+	Node       string `json:"node"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// A flag that can be set more than once, e.g. --unseal-key
+type stringSliceFlag []string
+
+func (values *stringSliceFlag) String() string {
+	return strings.Join(*values, ",")
+}
+
+func (values *stringSliceFlag) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+// The flags for the unseal keys, which can either be passed one by one or in a file with one key per line
+type unsealKeyFlags struct {
+	keys     stringSliceFlag
+	keysFile string
+}
+
+func (flags *unsealKeyFlags) unsealKeys() ([]string, error) {
+	if flags.keysFile == "" {
+		return flags.keys, nil
+	}
+	if len(flags.keys) > 0 {
+		return nil, errors.New("Only one of --unseal-key and --unseal-keys-file can be set")
+	}
+
+	file, err := os.Open(flags.keysFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the unseal keys: %v", err)
+	}
+	defer file.Close()
+
+	keys := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// Get the status of each of the given nodes. Nodes we can't get the status of are reported as unreachable, rather than
+// failing the command, as that's exactly what an operator checking the status of the cluster wants to know.
+func getNodeStatuses(ctx *context, nodes []ssh.Host) []nodeStatus {
+	statuses := []nodeStatus{}
+	for _, node := range nodes {
+		status, err := vaulttest.GetNodeStatusE(ctx.t, node)
+		if err != nil {
+			statuses = append(statuses, nodeStatus{Node: node.Hostname, Status: "unreachable", Error: err.Error()})
+			continue
+		}
+		statuses = append(statuses, nodeStatus{Node: node.Hostname, Status: status.String(), StatusCode: int(status)})
+	}
+	return statuses
+}
+
+func printNodeStatuses(ctx *context, statuses []nodeStatus) error {
+	return ctx.print(statuses, func(w io.Writer) {
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "NODE\tSTATUS\tCODE")
+		for _, status := range statuses {
+			code := strconv.Itoa(status.StatusCode)
+			if status.Error != "" {
+				code = status.Error
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\n", status.Node, status.Status, code)
+		}
+		table.Flush()
+	})
+}
+
+// Find the node the given --node flag refers to: the current leader, the index of the node in the nodes sorted by IP
+// address, as 'status' lists them, or its IP address
+func selectNode(ctx *context, nodes []ssh.Host, selector string) (ssh.Host, error) {
+	if selector != nodeLeader {
+		return selectNodeByName(nodes, selector)
+	}
+
+	for _, status := range getNodeStatuses(ctx, nodes) {
+		if status.StatusCode == int(vaulttest.Leader) {
+			return selectNodeByName(nodes, status.Node)
+		}
+	}
+	return ssh.Host{}, errors.New("None of the nodes is the leader")
+}
+
+func selectNodeByName(nodes []ssh.Host, selector string) (ssh.Host, error) {
+	if len(nodes) == 0 {
+		return ssh.Host{}, errors.New("Didn't find any nodes in the Vault ASG")
+	}
+
+	// The ASG returns its instances in no particular order, so sort them for an index to always pick the same node
+	nodes = append([]ssh.Host{}, nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Hostname < nodes[j].Hostname })
+
+	if selector == "" {
+		return nodes[0], nil
+	}
+
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 || index >= len(nodes) {
+			return ssh.Host{}, fmt.Errorf("There is no node %d, the Vault ASG has %d nodes", index, len(nodes))
+		}
+		return nodes[index], nil
+	}
+
+	for _, node := range nodes {
+		if node.Hostname == selector {
+			return node, nil
+		}
+	}
+	return ssh.Host{}, fmt.Errorf("Didn't find node %s in the Vault ASG", selector)
+}
+
+func runStatus(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	return printNodeStatuses(ctx, getNodeStatuses(ctx, vaulttest.FindNodes(ctx.t, ctx.options)))
+}
+
+func runInit(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	selector := flagSet.String("node", "", "The node to run 'vault operator init' on: its index in the nodes sorted by IP address or its IP address. Defaults to the first node.")
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	node, err := selectNodeByName(vaulttest.FindNodes(ctx.t, ctx.options), *selector)
+	if err != nil {
+		return err
+	}
+
+	// Check once, rather than with AssertStatus, which retries for minutes before giving up on a node that was already
+	// initialized
+	if _, err := vaulttest.CheckStatusE(ctx.t, node, vaulttest.Uninitialized); err != nil {
+		return fmt.Errorf("Not initializing Vault on %s, as it isn't running uninitialized: %v", node.Hostname, err)
+	}
+
+	response, err := vaulttest.InitializeNodeE(ctx.t, node)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize Vault on %s: %v", node.Hostname, err)
+	}
+
+	return ctx.print(response, func(w io.Writer) {
+		for i, unsealKey := range response.UnsealKeys {
+			fmt.Fprintf(w, "Unseal Key %d: %s\n", i+1, unsealKey)
+		}
+		fmt.Fprintf(w, "\nInitial Root Token: %s\n", response.RootToken)
+	})
+}
+
+func runUnseal(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	keyFlags := &unsealKeyFlags{}
+	flagSet.Var(&keyFlags.keys, "unseal-key", "An unseal key. Pass once for each key needed to reach the threshold.")
+	flagSet.StringVar(&keyFlags.keysFile, "unseal-keys-file", "", "A file with one unseal key per line")
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	unsealKeys, err := keyFlags.unsealKeys()
+	if err != nil {
+		return err
+	}
+	if len(unsealKeys) == 0 {
+		return errors.New("One of --unseal-key or --unseal-keys-file is required")
+	}
+
+	nodes := vaulttest.FindNodes(ctx.t, ctx.options)
+	for i, status := range getNodeStatuses(ctx, nodes) {
+		if status.StatusCode == int(vaulttest.Sealed) {
+			vaulttest.UnsealNode(ctx.t, nodes[i], unsealKeys)
+			vaulttest.AssertUnsealed(ctx.t, nodes[i])
+		}
+	}
+
+	return printNodeStatuses(ctx, getNodeStatuses(ctx, nodes))
+}
+
+func runStepDown(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	token := flagSet.String("token", os.Getenv(envVarVaultToken), "A Vault token that can update sys/step-down. Defaults to $"+envVarVaultToken+".")
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if *token == "" {
+		return fmt.Errorf("--token is required, unless $%s is set", envVarVaultToken)
+	}
+
+	nodes := vaulttest.FindNodes(ctx.t, ctx.options)
+	oldLeader, err := selectNode(ctx, nodes, nodeLeader)
+	if err != nil {
+		return err
+	}
+
+	if err := vaulttest.StepDownE(ctx.t, oldLeader, *token); err != nil {
+		return fmt.Errorf("Failed to step down the leader %s: %v", oldLeader.Hostname, err)
+	}
+
+	newLeader, err := retry.DoWithRetryE(ctx.t, "Waiting for a new leader", 30, 2*time.Second, func() (string, error) {
+		leader, err := selectNode(ctx, nodes, nodeLeader)
+		if err != nil {
+			return "", err
+		}
+		if leader.Hostname == oldLeader.Hostname {
+			return "", fmt.Errorf("%s is still the leader", oldLeader.Hostname)
+		}
+		return leader.Hostname, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result := map[string]string{"old_leader": oldLeader.Hostname, "new_leader": newLeader}
+	return ctx.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "%s stepped down, %s is the new leader\n", oldLeader.Hostname, newLeader)
+	})
+}
+
+func runRollingRestart(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	keyFlags := &unsealKeyFlags{}
+	flagSet.Var(&keyFlags.keys, "unseal-key", "An unseal key to unseal each node with after it restarts. Leave out if the cluster auto unseals.")
+	flagSet.StringVar(&keyFlags.keysFile, "unseal-keys-file", "", "A file with one unseal key per line")
+	token := flagSet.String("token", os.Getenv(envVarVaultToken), "A Vault token that can update sys/step-down, to step down the leader before restarting it. Defaults to $"+envVarVaultToken+".")
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	unsealKeys, err := keyFlags.unsealKeys()
+	if err != nil {
+		return err
+	}
+
+	vaulttest.RollingRestart(ctx.t, vaulttest.RollingRestartOptions{
+		ClusterOptions: ctx.options,
+		UnsealKeys:     unsealKeys,
+		Token:          *token,
+	})
+
+	return printNodeStatuses(ctx, getNodeStatuses(ctx, vaulttest.FindNodes(ctx.t, ctx.options)))
+}
+
+func runLogs(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	selector := flagSet.String("node", "", "Only print the logs of this node: leader, its index in the nodes sorted by IP address or its IP address. Defaults to all nodes.")
+	lines := flagSet.Int("lines", 100, "The number of lines to print from the end of the logs of each node. Set to 0 to print all of them.")
+	if _, err := ctx.parseFlags(flagSet, args); err != nil {
+		return err
+	}
+
+	nodes := vaulttest.FindNodes(ctx.t, ctx.options)
+	if *selector != "" {
+		node, err := selectNode(ctx, nodes, *selector)
+		if err != nil {
+			return err
+		}
+		nodes = []ssh.Host{node}
+	}
+
+	type nodeLogs struct {
+		Node string `json:"node"`
+		Logs string `json:"logs"`
+	}
+
+	allLogs := []nodeLogs{}
+	for _, node := range nodes {
+		logs, err := vaulttest.FetchVaultLogsE(ctx.t, node, *lines)
+		if err != nil {
+			return fmt.Errorf("Failed to read the Vault logs on %s: %v", node.Hostname, err)
+		}
+		allLogs = append(allLogs, nodeLogs{Node: node.Hostname, Logs: logs})
+	}
+
+	return ctx.print(allLogs, func(w io.Writer) {
+		for _, logs := range allLogs {
+			fmt.Fprintf(w, "==> %s <==\n%s\n\n", logs.Node, logs.Logs)
+		}
+	})
+}
+
+func runSsh(ctx *context, args []string) error {
+	flagSet := ctx.newFlagSet()
+	selector := flagSet.String("node", nodeLeader, "The node to SSH to: leader, its index in the nodes sorted by IP address or its IP address")
+	command, err := ctx.parseFlags(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	node, err := selectNode(ctx, vaulttest.FindNodes(ctx.t, ctx.options), *selector)
+	if err != nil {
+		return err
+	}
+
+	if len(command) > 0 {
+		output, err := ssh.CheckSshCommandE(ctx.t, node, strings.Join(command, " "))
+		if err != nil {
+			return fmt.Errorf("Failed to run the command on %s: %v", node.Hostname, err)
+		}
+
+		result := map[string]string{"node": node.Hostname, "output": output}
+		return ctx.print(result, func(w io.Writer) {
+			fmt.Fprintln(w, output)
+		})
+	}
+
+	// Terratest can only run commands, so hand an interactive session off to the ssh binary
+	shell := exec.Command("ssh", sshArgs(ctx.flags, node)...)
+	shell.Stdin = os.Stdin
+	shell.Stdout = ctx.stdout
+	shell.Stderr = ctx.stderr
+	return shell.Run()
+}
+
+// The arguments for the ssh binary to open a shell on the given node with the same user and key as the other commands
+func sshArgs(flags *clusterFlags, node ssh.Host) []string {
+	args := []string{"-l", node.SshUserName}
+	if flags.sshKeyFile != "" {
+		args = append(args, "-i", flags.sshKeyFile)
+	}
+	return append(args, node.Hostname)
+}
@@ -0,0 +1,257 @@
+// Command vault-cluster-ctl operates Vault clusters deployed with the vault-cluster module. It finds the nodes of a
+// cluster from the Terraform outputs of the code that deployed it, or from the name of its Auto Scaling Group, and
+// uses the same helpers as the automated tests in this repo (see the vaulttest package) to check their status,
+// initialize and unseal them, step down the leader, restart them one at a time, read their logs and SSH to them.
+//
+// Run 'vault-cluster-ctl help' for usage.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+)
+
+const name = "vault-cluster-ctl"
+
+const envVarAwsRegion = "AWS_DEFAULT_REGION"
+const envVarVaultToken = "VAULT_TOKEN"
+
+// A subcommand, e.g. status. Its run function is called with the flags and arguments after the subcommand's name.
+type command struct {
+	usage       string
+	description string
+	run         func(ctx *context, args []string) error
+}
+
+var commands = map[string]command{
+	"status":          {"status", "Print the status of each node: leader, standby, sealed or uninitialized", runStatus},
+	"init":            {"init [--node NODE]", "Initialize Vault and print the unseal keys and root token", runInit},
+	"unseal":          {"unseal (--unseal-key KEY ... | --unseal-keys-file FILE)", "Unseal each sealed node", runUnseal},
+	"step-down":       {"step-down [--token TOKEN]", "Force the leader to step down and wait for a new one to be elected", runStepDown},
+	"rolling-restart": {"rolling-restart [--unseal-key KEY ... | --unseal-keys-file FILE] [--token TOKEN]", "Restart Vault on each node, one at a time, standbys first", runRollingRestart},
+	"logs":            {"logs [--node NODE] [--lines N]", "Print the Vault logs from journalctl on each node", runLogs},
+	"ssh":             {"ssh [--node NODE] [COMMAND...]", "Run a command on a node over SSH, or open a shell on it", runSsh},
+	"bootstrap":       {"bootstrap --dir DIR [--dry-run] [--vault-addr ADDR] [--token TOKEN]", "Apply the policies, auth methods and roles declared in a directory through the Vault API", runBootstrap},
+}
+
+// The state each subcommand runs with
+type context struct {
+	command command
+	t       *cliT
+	stdout  io.Writer
+	stderr  io.Writer
+	json    bool
+	flags   *clusterFlags
+	options vaulttest.ClusterOptions
+}
+
+// The flags every subcommand accepts to find the cluster and SSH to its nodes
+type clusterFlags struct {
+	terraformDir  string
+	asgNameOutput string
+	asgName       string
+	awsRegion     string
+	privateIps    bool
+	sshUser       string
+	sshKeyFile    string
+	sshAgent      bool
+	json          bool
+	verbose       bool
+}
+
+func (flags *clusterFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&flags.terraformDir, "terraform-dir", "", "Read the name of the Vault ASG from the outputs of the Terraform code in this folder")
+	flagSet.StringVar(&flags.asgNameOutput, "asg-name-output", vaulttest.DefaultAsgNameOutput, "The Terraform output with the name of the Vault ASG")
+	flagSet.StringVar(&flags.asgName, "asg-name", "", "The name of the Vault ASG. Use instead of --terraform-dir.")
+	flagSet.StringVar(&flags.awsRegion, "aws-region", os.Getenv(envVarAwsRegion), "The AWS region the cluster is in. Defaults to $"+envVarAwsRegion+".")
+	flagSet.BoolVar(&flags.privateIps, "private-ips", false, "Connect to the nodes on their private IP addresses, e.g. over a VPN")
+	flagSet.StringVar(&flags.sshUser, "ssh-user", "ubuntu", "The user to SSH to the nodes as")
+	flagSet.StringVar(&flags.sshKeyFile, "ssh-key-file", "", "The private key to SSH to the nodes with")
+	flagSet.BoolVar(&flags.sshAgent, "ssh-agent", false, "SSH to the nodes with the keys in the local SSH agent")
+	flagSet.BoolVar(&flags.json, "json", false, "Print the output as JSON")
+	flagSet.BoolVar(&flags.verbose, "verbose", false, "Log what the command is doing to stderr")
+}
+
+// Build the options the vaulttest helpers need from the flags
+func (flags *clusterFlags) clusterOptions() (vaulttest.ClusterOptions, error) {
+	options := vaulttest.ClusterOptions{
+		AsgName:       flags.asgName,
+		AsgNameOutput: flags.asgNameOutput,
+		AwsRegion:     flags.awsRegion,
+		UsePrivateIps: flags.privateIps,
+		SshUserName:   flags.sshUser,
+		SshAgent:      flags.sshAgent,
+	}
+
+	if flags.asgName == "" && flags.terraformDir == "" {
+		return options, errors.New("One of --asg-name or --terraform-dir is required")
+	}
+	if flags.asgName != "" && flags.terraformDir != "" {
+		return options, errors.New("Only one of --asg-name and --terraform-dir can be set")
+	}
+	if flags.terraformDir != "" {
+		options.TerraformOptions = &terraform.Options{TerraformDir: flags.terraformDir}
+	}
+
+	if flags.awsRegion == "" {
+		return options, fmt.Errorf("--aws-region is required, unless $%s is set", envVarAwsRegion)
+	}
+
+	if flags.sshKeyFile == "" && !flags.sshAgent {
+		return options, errors.New("One of --ssh-key-file or --ssh-agent is required")
+	}
+	if flags.sshKeyFile != "" {
+		privateKey, err := ioutil.ReadFile(flags.sshKeyFile)
+		if err != nil {
+			return options, fmt.Errorf("Couldn't read the SSH key: %v", err)
+		}
+		options.KeyPair = &aws.Ec2Keypair{
+			KeyPair: &ssh.KeyPair{PrivateKey: string(privateKey)},
+			Region:  flags.awsRegion,
+		}
+	}
+
+	return options, nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run the subcommand in the given arguments and return the exit code
+func run(args []string, stdout io.Writer, stderr io.Writer) (exitCode int) {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	t := &cliT{name: fmt.Sprintf("%s %s", name, args[0]), stderr: stderr}
+	ctx := &context{command: cmd, t: t, stdout: stdout, stderr: stderr, flags: &clusterFlags{}}
+
+	// The vaulttest helpers fail the way tests do. cliT turns that into a panic, which ends the command here.
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errFailNow {
+				panic(r)
+			}
+			exitCode = 1
+		}
+	}()
+
+	if err := cmd.run(ctx, args[1:]); err != nil {
+		// The flag package already printed the usage of the command
+		if err == flag.ErrHelp {
+			return 0
+		}
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if t.failed {
+		return 1
+	}
+	return 0
+}
+
+// Parse the flags of a subcommand, along with the flags every subcommand accepts, and set up the context for it.
+// Returns the arguments after the flags.
+func (ctx *context) parseFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	ctx.flags.register(flagSet)
+	flagSet.SetOutput(ctx.stderr)
+
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+
+	options, err := ctx.flags.clusterOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.options = options
+	ctx.json = ctx.flags.json
+
+	// Terratest logs to stdout by default, which would mix with the output of the command
+	if ctx.flags.verbose {
+		logger.Default = logger.New(stderrLogger{stderr: ctx.stderr})
+	} else {
+		logger.Default = logger.Discard
+	}
+
+	return flagSet.Args(), nil
+}
+
+// Create the flag set for the subcommand the context runs, with a usage message that describes it
+func (ctx *context) newFlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(ctx.t.Name(), flag.ContinueOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(ctx.stderr, "Usage: %s %s\n\n%s.\n\nOptions:\n", name, ctx.command.usage, ctx.command.description)
+		flagSet.PrintDefaults()
+	}
+	return flagSet
+}
+
+// Print the given value as JSON if --json is set, or call printText to print it for humans otherwise
+func (ctx *context) print(value interface{}, printText func(w io.Writer)) error {
+	if !ctx.json {
+		printText(ctx.stdout)
+		return nil
+	}
+
+	encoder := json.NewEncoder(ctx.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s COMMAND [OPTIONS]\n\n", name)
+	fmt.Fprintf(w, "Operate a Vault cluster deployed with the vault-cluster module.\n\n")
+	fmt.Fprintf(w, "Commands:\n\n")
+
+	names := []string{}
+	for commandName := range commands {
+		names = append(names, commandName)
+	}
+	sort.Strings(names)
+
+	for _, commandName := range names {
+		fmt.Fprintf(w, "  %-18s %s\n", commandName, commands[commandName].description)
+	}
+
+	fmt.Fprintf(w, "\nEvery command but bootstrap finds the cluster with --terraform-dir or --asg-name, and SSHs to the\n")
+	fmt.Fprintf(w, "nodes with --ssh-key-file or --ssh-agent. bootstrap talks to the Vault API at --vault-addr instead.\n")
+	fmt.Fprintf(w, "Use --json to get output for scripts. Run '%s COMMAND --help' for the options of each command.\n\n", name)
+	fmt.Fprintf(w, "Example: %s status --terraform-dir examples/root-example --ssh-key-file ~/.ssh/vault.pem\n", name)
+}
+
+// stderrLogger logs what the vaulttest and Terratest helpers are doing to stderr, rather than stdout
+type stderrLogger struct {
+	stderr io.Writer
+}
+
+func (l stderrLogger) Logf(t terratesting.TestingT, format string, args ...interface{}) {
+	logger.DoLog(t, 3, l.stderr, strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunUsage(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "rolling-restart")
+
+	stderr.Reset()
+	assert.Equal(t, 0, run([]string{"help"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: vault-cluster-ctl COMMAND")
+
+	stderr.Reset()
+	assert.Equal(t, 2, run([]string{"reboot"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `Unknown command "reboot"`)
+
+	stderr.Reset()
+	assert.Equal(t, 0, run([]string{"logs", "--help"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: vault-cluster-ctl logs [--node NODE] [--lines N]")
+	assert.Contains(t, stderr.String(), "-ssh-key-file")
+	assert.NotContains(t, stderr.String(), "Error:")
+
+	assert.Empty(t, stdout.String())
+}
+
+// Helpers that fail the way tests do must end the command with a non-zero exit code, rather than crash it
+func TestRunFailNow(t *testing.T) {
+	commands["fail"] = command{usage: "fail", description: "Fail", run: func(ctx *context, args []string) error {
+		ctx.t.Fatalf("Failed to %s", "fail")
+		return nil
+	}}
+	defer delete(commands, "fail")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"fail"}, &stdout, &stderr))
+	assert.Equal(t, "Failed to fail\n", stderr.String())
+}
+
+func TestClusterFlags(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	keyFile := filepath.Join(tmpDir, "vault.pem")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("private key"), 0600))
+
+	options, err := (&clusterFlags{asgName: "vault-asg", awsRegion: "us-east-1", sshUser: "ubuntu", sshKeyFile: keyFile}).clusterOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "vault-asg", options.AsgName)
+	assert.Nil(t, options.TerraformOptions)
+	assert.Equal(t, "private key", options.KeyPair.KeyPair.PrivateKey)
+	assert.Equal(t, ssh.Host{Hostname: "10.0.0.1", SshUserName: "ubuntu", SshKeyPair: options.KeyPair.KeyPair}, options.Host("10.0.0.1"))
+
+	options, err = (&clusterFlags{terraformDir: "examples/root-example", asgNameOutput: "vault_asg", awsRegion: "us-east-1", sshUser: "ec2-user", sshAgent: true}).clusterOptions()
+	require.NoError(t, err)
+	assert.Equal(t, "examples/root-example", options.TerraformOptions.TerraformDir)
+	assert.Equal(t, "vault_asg", options.AsgNameOutput)
+	assert.Nil(t, options.KeyPair)
+	assert.True(t, options.Host("10.0.0.1").SshAgent)
+
+	invalidFlags := map[string]clusterFlags{
+		"One of --asg-name or --terraform-dir is required":      {awsRegion: "us-east-1", sshAgent: true},
+		"Only one of --asg-name and --terraform-dir can be set": {asgName: "vault-asg", terraformDir: ".", awsRegion: "us-east-1", sshAgent: true},
+		"--aws-region is required":                              {asgName: "vault-asg", sshAgent: true},
+		"One of --ssh-key-file or --ssh-agent is required":      {asgName: "vault-asg", awsRegion: "us-east-1"},
+		"Couldn't read the SSH key":                             {asgName: "vault-asg", awsRegion: "us-east-1", sshKeyFile: filepath.Join(tmpDir, "missing.pem")},
+	}
+
+	for expectedError, flags := range invalidFlags {
+		_, err := flags.clusterOptions()
+		if assert.Error(t, err, expectedError) {
+			assert.Contains(t, err.Error(), expectedError)
+		}
+	}
+}
+
+func TestSelectNodeByName(t *testing.T) {
+	t.Parallel()
+
+	// In the order the ASG might return them in: an index picks the node in the sorted order
+	nodes := []ssh.Host{{Hostname: "10.0.0.3"}, {Hostname: "10.0.0.1"}, {Hostname: "10.0.0.2"}}
+
+	for selector, expected := range map[string]string{"": "10.0.0.1", "0": "10.0.0.1", "2": "10.0.0.3", "10.0.0.2": "10.0.0.2"} {
+		node, err := selectNodeByName(nodes, selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, expected, node.Hostname, selector)
+	}
+
+	for _, selector := range []string{"3", "-1", "10.0.0.4"} {
+		_, err := selectNodeByName(nodes, selector)
+		assert.Error(t, err, selector)
+	}
+
+	_, err := selectNodeByName(nil, "")
+	assert.Error(t, err)
+
+	// The caller's slice is left as it is
+	assert.Equal(t, "10.0.0.3", nodes[0].Hostname)
+}
+
+func TestUnsealKeyFlags(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	keysFile := filepath.Join(tmpDir, "unseal-keys")
+	require.NoError(t, ioutil.WriteFile(keysFile, []byte("key1\n\n  key2\nkey3\n"), 0600))
+
+	keys, err := (&unsealKeyFlags{keysFile: keysFile}).unsealKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key2", "key3"}, keys)
+
+	keys, err = (&unsealKeyFlags{keys: stringSliceFlag{"key1", "key2"}}).unsealKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key2"}, keys)
+
+	_, err = (&unsealKeyFlags{keys: stringSliceFlag{"key1"}, keysFile: keysFile}).unsealKeys()
+	assert.Error(t, err)
+
+	_, err = (&unsealKeyFlags{keysFile: filepath.Join(tmpDir, "missing")}).unsealKeys()
+	assert.Error(t, err)
+}
+
+func TestPrintNodeStatuses(t *testing.T) {
+	t.Parallel()
+
+	statuses := []nodeStatus{
+		{Node: "10.0.0.1", Status: "leader", StatusCode: 200},
+		{Node: "10.0.0.2", Status: "sealed", StatusCode: 503},
+		{Node: "10.0.0.3", Status: "unreachable", Error: "connection refused"},
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, printNodeStatuses(&context{stdout: &text}, statuses))
+	assert.Equal(t, "NODE      STATUS       CODE\n10.0.0.1  leader       200\n10.0.0.2  sealed       503\n10.0.0.3  unreachable  connection refused\n", text.String())
+
+	var jsonOutput bytes.Buffer
+	require.NoError(t, printNodeStatuses(&context{stdout: &jsonOutput, json: true}, statuses))
+
+	var parsed []map[string]interface{}
+	require.NoError(t, json.Unmarshal(jsonOutput.Bytes(), &parsed))
+	require.Len(t, parsed, 3)
+	assert.Equal(t, map[string]interface{}{"node": "10.0.0.1", "status": "leader", "status_code": float64(200)}, parsed[0])
+	assert.Equal(t, map[string]interface{}{"node": "10.0.0.3", "status": "unreachable", "error": "connection refused"}, parsed[2])
+}
+
+func TestBootstrapFlags(t *testing.T) {
+	t.Parallel()
+
+	client, err := (&bootstrapFlags{vaultAddr: "https://10.0.0.1:8200", token: "s.token", tlsServerName: "vault.service.consul"}).vaultClient()
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:8200", client.Address())
+	assert.Equal(t, "s.token", client.Token())
+
+	invalidFlags := map[string]bootstrapFlags{
+		"--vault-addr is required": {token: "s.token"},
+		"--token is required":      {vaultAddr: "https://10.0.0.1:8200"},
+		"Couldn't configure TLS":   {vaultAddr: "https://10.0.0.1:8200", token: "s.token", caCert: "missing-ca.crt.pem"},
+	}
+
+	for expectedError, flags := range invalidFlags {
+		_, err := flags.vaultClient()
+		if assert.Error(t, err, expectedError) {
+			assert.Contains(t, err.Error(), expectedError)
+		}
+	}
+
+	vars, err := (&bootstrapFlags{vars: stringSliceFlag{"role_name=example-role", "role_arn=arn:aws:iam::123456789012:role/a=b"}}).variables()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"role_name": "example-role", "role_arn": "arn:aws:iam::123456789012:role/a=b"}, vars)
+
+	_, err = (&bootstrapFlags{vars: stringSliceFlag{"role_name"}}).variables()
+	assert.Error(t, err)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"bootstrap", "--dry-run"}, &stdout, &stderr))
+	assert.Equal(t, "Error: --dir is required\n", stderr.String())
+
+	// bootstrap doesn't take the flags the other commands find the cluster with
+	stderr.Reset()
+	assert.Equal(t, 0, run([]string{"bootstrap", "--help"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "-dry-run")
+	assert.NotContains(t, stderr.String(), "-ssh-key-file")
+}
+
+func TestSshArgs(t *testing.T) {
+	t.Parallel()
+
+	node := ssh.Host{Hostname: "10.0.0.1", SshUserName: "ubuntu"}
+	assert.Equal(t, []string{"-l", "ubuntu", "-i", "vault.pem", "10.0.0.1"}, sshArgs(&clusterFlags{sshKeyFile: "vault.pem"}, node))
+	assert.Equal(t, []string{"-l", "ubuntu", "10.0.0.1"}, sshArgs(&clusterFlags{sshAgent: true}, node))
+}
+
+func createTempDir(t *testing.T) string {
+	tmpDir, err := ioutil.TempDir("", "vault-cluster-ctl")
+	require.NoError(t, err)
+	return tmpDir
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Panicked with by cliT.FailNow and recovered from in run, to end the command the way FailNow ends a test
+var errFailNow = errors.New("command failed")
+
+// cliT implements the TestingT interface the Terratest and vaulttest helpers take, so the CLI can reuse them. Errors
+// are printed to stderr, and FailNow ends the command with a non-zero exit code.
+type cliT struct {
+	name   string
+	stderr io.Writer
+	failed bool
+}
+
+func (t *cliT) Fail() {
+	t.failed = true
+}
+
+func (t *cliT) FailNow() {
+	t.failed = true
+	panic(errFailNow)
+}
+
+func (t *cliT) Fatal(args ...interface{}) {
+	t.Error(args...)
+	t.FailNow()
+}
+
+func (t *cliT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.FailNow()
+}
+
+func (t *cliT) Error(args ...interface{}) {
+	fmt.Fprintln(t.stderr, args...)
+	t.Fail()
+}
+
+func (t *cliT) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(t.stderr, format+"\n", args...)
+	t.Fail()
+}
+
+func (t *cliT) Name() string {
+	return t.name
+}
@@ -3,7 +3,15 @@ module github.com/gruntwork-io/terraform-aws-vault/test
 go 1.13
 
 require (
+	github.com/aws/aws-sdk-go v1.38.28
+	github.com/gruntwork-io/terraform-aws-vault/modules/sign-request v0.0.0
 	github.com/gruntwork-io/terratest v0.37.6
+	github.com/hashicorp/hcl/v2 v2.8.2
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/stretchr/testify v1.6.1
+	github.com/zclconf/go-cty v1.2.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	sigs.k8s.io/yaml v1.2.0
 )
+
+replace github.com/gruntwork-io/terraform-aws-vault/modules/sign-request => ../modules/sign-request
@@ -0,0 +1,215 @@
+package test
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+)
+
+const INSTALL_VAULT_SCRIPT_PATH = "modules/install-vault/install-vault"
+
+// The real tools install-vault needs that we don't stub out. Only these are on the PATH when it runs offline, so the
+// script can't reach the package manager, user database or anything else on the machine running the tests.
+var installVaultRealTools = []string{
+	"basename", "cat", "chmod", "cp", "curl", "date", "dirname", "env", "ln", "mkdir", "mv", "readlink", "seq", "sleep",
+	"unzip", "which",
+}
+
+// Stub binaries for running install-vault offline. Each records how it was called in commands.log so tests can check
+// the users, ownership and capabilities install-vault would have set up on a real server. The harness doesn't run as
+// root or in a user namespace, so those are only ever checked against the recorded calls, never against the files
+// themselves: a chown of the wrong path, or a permission problem only root would hit, isn't caught. id always fails so
+// the vault user looks like it doesn't exist yet.
+var installVaultStubScripts = map[string]string{
+	"sudo":    `exec env "$@"`,
+	"id":      `exit 1`,
+	"useradd": `echo "useradd $*" >> "$STUB_LOG_DIR/commands.log"`,
+	"chown":   `echo "chown $*" >> "$STUB_LOG_DIR/commands.log"`,
+	"setcap":  `echo "setcap $*" >> "$STUB_LOG_DIR/commands.log"`,
+}
+
+// The package managers install-vault knows how to use, keyed by the OS family they stand in for
+var installVaultPackageManagers = map[string]string{
+	"ubuntu":       "apt-get",
+	"amazon-linux": "yum",
+}
+
+// The contents of the vault binary in the fake Vault zip
+const fakeVaultBinary = `#!/bin/bash
+echo "Vault v` + FAKE_VAULT_VERSION + ` ('0000000000000000000000000000000000000000')"
+`
+
+// InstallVaultResult is what running the install-vault script offline produced. The fake root folder is stripped from
+// the paths in the recorded commands, so they look exactly like they would on a real server.
+type InstallVaultResult struct {
+	RootDir  string
+	Commands []string
+	Output   string
+}
+
+// Path returns the absolute path inside the fake root of the given path on the server
+func (result InstallVaultResult) Path(serverPath string) string {
+	return filepath.Join(result.RootDir, serverPath)
+}
+
+// ChownedOwner returns the owner, in user:group form, that the chown calls the stub recorded would have given the
+// given path on a real server, or an empty string if nothing was recorded for it. It doesn't look at the file itself.
+func (result InstallVaultResult) ChownedOwner(serverPath string) string {
+	owner := ""
+	for _, command := range result.Commands {
+		args := strings.Fields(command)
+		if len(args) < 3 || args[0] != "chown" {
+			continue
+		}
+
+		recursive := args[1] == "-R"
+		if recursive {
+			args = args[1:]
+		}
+
+		target := args[2]
+		if target == serverPath || (recursive && strings.HasPrefix(serverPath, target+"/")) {
+			owner = args[1]
+		}
+	}
+	return owner
+}
+
+// SetcapCapabilities returns the capabilities that the setcap calls the stub recorded would have given the given path
+// on a real server, or an empty string if nothing was recorded for it. It doesn't look at the file itself.
+func (result InstallVaultResult) SetcapCapabilities(serverPath string) string {
+	capabilities := ""
+	for _, command := range result.Commands {
+		args := strings.Fields(command)
+		if len(args) == 3 && args[0] == "setcap" && args[2] == serverPath {
+			capabilities = args[1]
+		}
+	}
+	return capabilities
+}
+
+// Run the install-vault script with the given arguments against a throwaway root folder, failing the test if the
+// script fails. See runInstallVaultOfflineE for details.
+func runInstallVaultOffline(t *testing.T, osFamily string, args ...string) InstallVaultResult {
+	result, err := runInstallVaultOfflineE(t, osFamily, args...)
+	if err != nil {
+		t.Fatalf("install-vault failed: %v\n%s", err, result.Output)
+	}
+	return result
+}
+
+// Run the install-vault script with the given arguments against a throwaway root folder. The script only sees stubs
+// for sudo, id, useradd, chown, setcap and the package manager of the given OS family, plus the real tools listed in
+// installVaultRealTools. Vault is installed with --path /opt/vault inside the root folder, from a fake zip passed with
+// --download-url file://... The caller is responsible for deleting RootDir.
+func runInstallVaultOfflineE(t *testing.T, osFamily string, args ...string) (InstallVaultResult, error) {
+	for _, tool := range []string{"curl", "unzip"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("Skipping offline install-vault test, as %s is not installed", tool)
+		}
+	}
+
+	packageManager, ok := installVaultPackageManagers[osFamily]
+	if !ok {
+		t.Fatalf("Unknown OS family %s", osFamily)
+	}
+
+	rootDir, err := ioutil.TempDir("", "install-vault")
+	if err != nil {
+		t.Fatalf("Couldn't create temp folder: %v", err)
+	}
+	result := InstallVaultResult{RootDir: rootDir}
+
+	for _, dir := range []string{"tmp", "usr/local/bin", "stubs"} {
+		if err := os.MkdirAll(filepath.Join(rootDir, dir), 0755); err != nil {
+			t.Fatalf("Couldn't create folder: %v", err)
+		}
+	}
+
+	stubDir := filepath.Join(rootDir, "stubs")
+	stubs := map[string]string{
+		packageManager: fmt.Sprintf(`echo "%s $*" >> "$STUB_LOG_DIR/commands.log"`, packageManager),
+	}
+	for name, body := range installVaultStubScripts {
+		stubs[name] = body
+	}
+	writeStubScripts(t, stubDir, stubs)
+	linkRealTools(t, stubDir, installVaultRealTools)
+
+	packagePath := filepath.Join(rootDir, "vault.zip")
+	writeFakeVaultPackage(t, packagePath)
+
+	scriptArgs := append([]string{
+		"--download-url", "file://" + packagePath,
+		"--path", filepath.Join(rootDir, offlineVaultInstallPath),
+	}, args...)
+
+	// Run with the umask of root on the servers, so the modes of the folders install-vault creates without a chmod are
+	// the same as they would be there, regardless of the umask of the test process
+	cmd := exec.Command("bash", append([]string{"-c", `umask 022 && exec "$BASH" "$0" "$@"`, filepath.Join(REPO_ROOT, INSTALL_VAULT_SCRIPT_PATH)}, scriptArgs...)...)
+	cmd.Env = []string{
+		fmt.Sprintf("PATH=%s%c%s", stubDir, os.PathListSeparator, filepath.Join(rootDir, "usr/local/bin")),
+		fmt.Sprintf("HOME=%s", rootDir),
+		fmt.Sprintf("STUB_LOG_DIR=%s", rootDir),
+		fmt.Sprintf("DOWNLOAD_DIR=%s", filepath.Join(rootDir, "tmp")),
+		fmt.Sprintf("SYSTEM_BIN_DIR=%s", filepath.Join(rootDir, "usr/local/bin")),
+	}
+
+	output, runErr := cmd.CombinedOutput()
+	logger.Logf(t, "Output from install-vault %s:\n%s", strings.Join(scriptArgs, " "), output)
+
+	result.Output = string(output)
+	for _, command := range readLines(filepath.Join(rootDir, "commands.log")) {
+		if command != "" {
+			result.Commands = append(result.Commands, strings.Replace(command, rootDir, "", -1))
+		}
+	}
+
+	return result, runErr
+}
+
+// Symlink each of the given tools from the PATH of the test process into the given folder
+func linkRealTools(t *testing.T, dir string, tools []string) {
+	for _, tool := range tools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			t.Fatalf("Couldn't find %s: %v", tool, err)
+		}
+		if err := os.Symlink(path, filepath.Join(dir, tool)); err != nil {
+			t.Fatalf("Couldn't link %s: %v", tool, err)
+		}
+	}
+}
+
+// Write a zip file laid out like the Vault release packages, with a single executable vault binary at the top level
+func writeFakeVaultPackage(t *testing.T, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Couldn't create %s: %v", path, err)
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+
+	header := &zip.FileHeader{Name: "vault", Method: zip.Deflate}
+	header.SetMode(0755)
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		t.Fatalf("Couldn't add vault to %s: %v", path, err)
+	}
+	if _, err := writer.Write([]byte(fakeVaultBinary)); err != nil {
+		t.Fatalf("Couldn't write vault to %s: %v", path, err)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("Couldn't write %s: %v", path, err)
+	}
+}
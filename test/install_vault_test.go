@@ -0,0 +1,128 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallVault(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		osFamily                string
+		expectedPackageCommands []string
+	}{
+		{"ubuntu", []string{"apt-get update -y", "apt-get install -y awscli curl unzip jq libcap2-bin"}},
+		{"amazon-linux", []string{"yum update -y", "yum install -y awscli curl unzip jq"}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.osFamily, func(t *testing.T) {
+			t.Parallel()
+
+			result := runInstallVaultOffline(t, testCase.osFamily)
+			defer os.RemoveAll(result.RootDir)
+
+			assert.Equal(t, testCase.expectedPackageCommands, filterCommands(result.Commands, installVaultPackageManagers[testCase.osFamily]))
+			assert.Equal(t, []string{"useradd --system vault"}, filterCommands(result.Commands, "useradd"))
+
+			assertInstallLayout(t, result, "vault")
+			assert.Contains(t, result.Output, "Vault install complete!")
+		})
+	}
+}
+
+func TestInstallVaultWithCustomUserAndNoPackageUpdate(t *testing.T) {
+	t.Parallel()
+
+	result := runInstallVaultOffline(t, "ubuntu", "--user", "custom-vault", "--skip-package-update")
+	defer os.RemoveAll(result.RootDir)
+
+	assert.Equal(t, []string{"apt-get install -y awscli curl unzip jq libcap2-bin"}, filterCommands(result.Commands, "apt-get"))
+	assert.Equal(t, []string{"useradd --system custom-vault"}, filterCommands(result.Commands, "useradd"))
+
+	assertInstallLayout(t, result, "custom-vault")
+}
+
+func TestInstallVaultRequiresVersionOrDownloadUrl(t *testing.T) {
+	t.Parallel()
+
+	// The harness always passes --download-url, so blank it out again
+	result, err := runInstallVaultOfflineE(t, "ubuntu", "--download-url", "")
+	defer os.RemoveAll(result.RootDir)
+
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "Either the value for '--version' or '--download-url' must be passed")
+	assert.Empty(t, result.Commands)
+}
+
+// Check the folders and files install-vault creates under /opt/vault and their modes, on disk, and the chown and setcap
+// calls the stubs recorded for them. The ownership and capabilities of the files themselves aren't checked, as the
+// script doesn't run as root.
+func assertInstallLayout(t *testing.T, result InstallVaultResult, user string) {
+	owner := user + ":" + user
+
+	expectedDirs := map[string]os.FileMode{
+		"/opt/vault":         0755,
+		"/opt/vault/bin":     0755,
+		"/opt/vault/config":  0755,
+		"/opt/vault/data":    0755,
+		"/opt/vault/tls":     0755,
+		"/opt/vault/log":     0755,
+		"/opt/vault/scripts": 0755,
+	}
+
+	for dir, expectedMode := range expectedDirs {
+		info, err := os.Stat(result.Path(dir))
+		if !assert.NoError(t, err, "Expected %s to exist", dir) {
+			continue
+		}
+		assert.True(t, info.IsDir(), "Expected %s to be a folder", dir)
+		assert.Equal(t, expectedMode, info.Mode().Perm(), "Unexpected permissions on %s", dir)
+		assert.Equal(t, owner, result.ChownedOwner(dir), "Unexpected owner in the chown calls recorded for %s", dir)
+	}
+
+	vaultBinary, err := ioutil.ReadFile(result.Path("/opt/vault/bin/vault"))
+	require.NoError(t, err)
+	assert.Equal(t, fakeVaultBinary, string(vaultBinary))
+
+	runVault, err := ioutil.ReadFile(result.Path("/opt/vault/bin/run-vault"))
+	require.NoError(t, err)
+	expectedRunVault, err := ioutil.ReadFile(filepath.Join(REPO_ROOT, RUN_VAULT_SCRIPT_PATH))
+	require.NoError(t, err)
+	assert.Equal(t, string(expectedRunVault), string(runVault))
+
+	for _, file := range []string{"/opt/vault/bin/vault", "/opt/vault/bin/run-vault"} {
+		info, err := os.Stat(result.Path(file))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), "Unexpected permissions on %s", file)
+		assert.Equal(t, owner, result.ChownedOwner(file), "Unexpected owner in the chown calls recorded for %s", file)
+	}
+
+	symlinkTarget, err := os.Readlink(result.Path("/usr/local/bin/vault"))
+	require.NoError(t, err)
+	assert.Equal(t, result.Path("/opt/vault/bin/vault"), symlinkTarget)
+
+	assert.Equal(t, "cap_ipc_lock=+ep", result.SetcapCapabilities("/opt/vault/bin/vault"), "Unexpected capabilities in the setcap calls recorded for /opt/vault/bin/vault")
+
+	_, err = os.Stat(result.Path("/tmp/vault"))
+	assert.True(t, os.IsNotExist(err), "Expected the unzipped binary to be moved out of the download folder")
+}
+
+// Return the recorded commands run with the given binary
+func filterCommands(commands []string, binary string) []string {
+	filtered := []string{}
+	for _, command := range commands {
+		if command == binary || strings.HasPrefix(command, binary+" ") {
+			filtered = append(filtered, command)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,290 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The root example runs run-vault with --enable-prometheus-metrics, so each node serves its own metrics on this URL to
+// requests with a token that can read sys/metrics
+const VAULT_PROMETHEUS_METRICS_URL = "https://127.0.0.1:8200/v1/sys/metrics?format=prometheus"
+
+// The retention time the root example passes to run-vault with --prometheus-retention-time
+const VAULT_PROMETHEUS_RETENTION_TIME = "1h"
+
+// Gauges Vault reports on every node: 1 if the node is unsealed or the active node, 0 if not
+const METRIC_CORE_UNSEALED = "vault_core_unsealed"
+const METRIC_CORE_ACTIVE = "vault_core_active"
+
+// The number of requests Vault has handled, from the summary of how long it took to handle them
+const METRIC_CORE_HANDLE_REQUEST_COUNT = "vault_core_handle_request_count"
+
+// How many requests testVaultPrometheusMetrics sends to the leader to check the request counter goes up
+const metricsTestRequestCount = 10
+
+// A path there's no secret at, which Vault still handles, and counts, as a request
+const metricsTestRequestPath = "/v1/secret/metrics-test"
+
+// PrometheusSample is a sample in the Prometheus text format: a metric name, its labels and its value
+type PrometheusSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// PrometheusMetrics are the samples from a scrape, along with the types the # TYPE comments declared for them
+type PrometheusMetrics struct {
+	Types   map[string]string
+	Samples []PrometheusSample
+}
+
+// Find the first sample with the given name that has all the given labels, which may be nil
+func (metrics PrometheusMetrics) Find(name string, labels map[string]string) (PrometheusSample, bool) {
+	for _, sample := range metrics.Samples {
+		if sample.Name != name {
+			continue
+		}
+
+		matches := true
+		for key, value := range labels {
+			if sample.Labels[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return sample, true
+		}
+	}
+	return PrometheusSample{}, false
+}
+
+// Parse metrics in the Prometheus text exposition format:
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func parsePrometheusMetrics(contents string) (PrometheusMetrics, error) {
+	metrics := PrometheusMetrics{Types: map[string]string{}, Samples: []PrometheusSample{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			// Only the TYPE comments mean anything; HELP and any other comments are ignored
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				metrics.Types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parsePrometheusSample(line)
+		if err != nil {
+			return metrics, fmt.Errorf("Invalid sample on line %d: %v", lineNumber, err)
+		}
+		metrics.Samples = append(metrics.Samples, sample)
+	}
+
+	return metrics, scanner.Err()
+}
+
+// Parse a line of the form: name{label="value",...} value [timestamp]
+func parsePrometheusSample(line string) (PrometheusSample, error) {
+	sample := PrometheusSample{Labels: map[string]string{}}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, fmt.Errorf("no value in %q", line)
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, afterLabels, err := parsePrometheusLabels(rest[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = afterLabels
+	}
+
+	// The timestamp after the value is optional, and not used by the tests
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return sample, fmt.Errorf("expected a value and an optional timestamp after %s, but got %q", sample.Name, rest)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value of %s: %v", sample.Name, err)
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// Parse the labels after the opening brace, returning them and what's left of the line after the closing brace
+func parsePrometheusLabels(text string) (map[string]string, string, error) {
+	labels := map[string]string{}
+
+	for {
+		text = strings.TrimLeft(text, " \t")
+		if strings.HasPrefix(text, "}") {
+			return labels, text[1:], nil
+		}
+
+		equals := strings.Index(text, "=")
+		if equals <= 0 || len(text) < equals+2 || text[equals+1] != '"' {
+			return nil, "", fmt.Errorf("expected label=\"value\" in %q", text)
+		}
+		name := strings.TrimSpace(text[:equals])
+		text = text[equals+2:]
+
+		// Label values escape backslashes, double quotes and line feeds with a backslash
+		value := strings.Builder{}
+		closed := false
+		for i := 0; i < len(text); i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			if text[i] == '"' {
+				text = text[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(text[i])
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+
+		text = strings.TrimLeft(text, " \t")
+		if strings.HasPrefix(text, ",") {
+			text = text[1:]
+		} else if !strings.HasPrefix(text, "}") {
+			return nil, "", fmt.Errorf("expected , or } after label %s, but got %q", name, text)
+		}
+	}
+}
+
+// Scrape the Prometheus metrics of the Vault server on the given host, over SSH, with the given token. Like
+// vaulttest.StepDownE, the token is copied to a file only the SSH user can read, and deleted right after, rather than
+// put on the command line.
+func scrapeVaultMetricsE(t *testing.T, host ssh.Host, token string) (PrometheusMetrics, error) {
+	headerPath := fmt.Sprintf("/tmp/vault-metrics-token-%s", random.UniqueId())
+	if err := ssh.ScpFileToE(t, host, 0600, headerPath, fmt.Sprintf("X-Vault-Token: %s\n", token)); err != nil {
+		return PrometheusMetrics{}, err
+	}
+
+	command := fmt.Sprintf("curl --silent --show-error --fail --header @%s '%s'; exit_status=$?; rm -f %s; exit $exit_status", headerPath, VAULT_PROMETHEUS_METRICS_URL, headerPath)
+	output, err := ssh.CheckSshCommandE(t, host, command)
+	if err != nil {
+		return PrometheusMetrics{}, err
+	}
+	return parsePrometheusMetrics(output)
+}
+
+// Scrape the Prometheus metrics of the Vault server on the given host with the given token until the given check
+// passes. Vault only reports some metrics, such as its gauges, every few seconds, so they may not be there on the
+// first scrape.
+func scrapeVaultMetricsUntil(t *testing.T, host ssh.Host, token string, description string, check func(PrometheusMetrics) error) PrometheusMetrics {
+	var metrics PrometheusMetrics
+	retry.DoWithRetry(t, fmt.Sprintf("%s on %s", description, host.Hostname), 12, 5*time.Second, func() (string, error) {
+		scraped, err := scrapeVaultMetricsE(t, host, token)
+		if err != nil {
+			return "", err
+		}
+		if err := check(scraped); err != nil {
+			return "", err
+		}
+		metrics = scraped
+		return "", nil
+	})
+	return metrics
+}
+
+// Check the Prometheus metrics of the given cluster, scraping them with its root token:
+//
+//  1. The metrics can't be read without a token.
+//  2. Each node reports that it's unsealed, and only the leader that it's the active node.
+//  3. The count of requests the leader handled goes up by at least as many requests as we send it.
+func testVaultPrometheusMetrics(t *testing.T, cluster vaulttest.Cluster) {
+	require.NotEmpty(t, cluster.RootToken, "Expected the root token of the cluster to scrape the metrics with")
+
+	statusCode, err := ssh.CheckSshCommandE(t, cluster.Leader, fmt.Sprintf("curl --silent --output /dev/null --write-out '%%{http_code}' '%s'", VAULT_PROMETHEUS_METRICS_URL))
+	require.NoError(t, err, "Failed to request the metrics of the leader %s without a token", cluster.Leader.Hostname)
+	assert.Equal(t, strconv.Itoa(http.StatusForbidden), strings.TrimSpace(statusCode), "Expected the leader %s to refuse to serve its metrics without a token", cluster.Leader.Hostname)
+
+	for _, node := range cluster.Nodes() {
+		expectedActive := 0.0
+		if node.Hostname == cluster.Leader.Hostname {
+			expectedActive = 1.0
+		}
+
+		metrics := scrapeVaultMetricsUntil(t, node, cluster.RootToken, "Waiting for the core gauges", func(metrics PrometheusMetrics) error {
+			for _, name := range []string{METRIC_CORE_UNSEALED, METRIC_CORE_ACTIVE} {
+				if _, found := metrics.Find(name, nil); !found {
+					return fmt.Errorf("No %s metric yet", name)
+				}
+			}
+			return nil
+		})
+
+		unsealed, _ := metrics.Find(METRIC_CORE_UNSEALED, nil)
+		assert.Equal(t, 1.0, unsealed.Value, "Expected %s to be 1 on %s", METRIC_CORE_UNSEALED, node.Hostname)
+
+		active, _ := metrics.Find(METRIC_CORE_ACTIVE, nil)
+		assert.Equal(t, expectedActive, active.Value, "Unexpected %s on %s", METRIC_CORE_ACTIVE, node.Hostname)
+	}
+
+	before, err := scrapeVaultMetricsE(t, cluster.Leader, cluster.RootToken)
+	require.NoError(t, err, "Failed to scrape the metrics of the leader %s", cluster.Leader.Hostname)
+
+	// The count isn't there until the leader has handled a request since it started
+	requestCountBefore := 0.0
+	if sample, found := before.Find(METRIC_CORE_HANDLE_REQUEST_COUNT, nil); found {
+		requestCountBefore = sample.Value
+	}
+
+	logger.Logf(t, "Sending %d requests to the leader %s, which has handled %.0f so far", metricsTestRequestCount, cluster.Leader.Hostname, requestCountBefore)
+	sendRequests := fmt.Sprintf("for i in $(seq %d); do curl --silent --output /dev/null 'https://127.0.0.1:8200%s'; done", metricsTestRequestCount, metricsTestRequestPath)
+	_, err = ssh.CheckSshCommandE(t, cluster.Leader, sendRequests)
+	require.NoError(t, err, "Failed to send requests to the leader %s", cluster.Leader.Hostname)
+
+	expectedRequestCount := requestCountBefore + metricsTestRequestCount
+	scrapeVaultMetricsUntil(t, cluster.Leader, cluster.RootToken, "Waiting for the request count to go up", func(metrics PrometheusMetrics) error {
+		sample, found := metrics.Find(METRIC_CORE_HANDLE_REQUEST_COUNT, nil)
+		if !found {
+			return fmt.Errorf("No %s metric yet", METRIC_CORE_HANDLE_REQUEST_COUNT)
+		}
+		if sample.Value < expectedRequestCount {
+			return fmt.Errorf("Expected %s to be at least %.0f, but got %.0f", METRIC_CORE_HANDLE_REQUEST_COUNT, expectedRequestCount, sample.Value)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An excerpt of what Vault 1.6 serves on /v1/sys/metrics?format=prometheus with disable_hostname set
+const exampleVaultMetrics = `# HELP vault_core_active vault_core_active
+# TYPE vault_core_active gauge
+vault_core_active 1
+# HELP vault_core_handle_request vault_core_handle_request
+# TYPE vault_core_handle_request summary
+vault_core_handle_request{quantile="0.5"} 0.0453
+vault_core_handle_request{quantile="0.9"} NaN
+vault_core_handle_request_sum 12.55
+vault_core_handle_request_count 217
+# HELP vault_core_unsealed vault_core_unsealed
+# TYPE vault_core_unsealed gauge
+vault_core_unsealed 1
+
+# TYPE vault_route_read_secret_ summary
+vault_route_read_secret_{mount_point="secret/",description="a \"quoted\" path\\with\nescapes"} 3 1620122400000
+vault_runtime_alloc_bytes +Inf
+`
+
+func TestParsePrometheusMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics, err := parsePrometheusMetrics(exampleVaultMetrics)
+	require.NoError(t, err)
+	require.Len(t, metrics.Samples, 8)
+
+	assert.Equal(t, "gauge", metrics.Types[METRIC_CORE_UNSEALED])
+	assert.Equal(t, "summary", metrics.Types["vault_core_handle_request"])
+
+	unsealed, found := metrics.Find(METRIC_CORE_UNSEALED, nil)
+	require.True(t, found)
+	assert.Equal(t, 1.0, unsealed.Value)
+
+	count, found := metrics.Find(METRIC_CORE_HANDLE_REQUEST_COUNT, nil)
+	require.True(t, found)
+	assert.Equal(t, 217.0, count.Value)
+
+	median, found := metrics.Find("vault_core_handle_request", map[string]string{"quantile": "0.5"})
+	require.True(t, found)
+	assert.Equal(t, 0.0453, median.Value)
+
+	p90, found := metrics.Find("vault_core_handle_request", map[string]string{"quantile": "0.9"})
+	require.True(t, found)
+	assert.True(t, math.IsNaN(p90.Value))
+
+	reads, found := metrics.Find("vault_route_read_secret_", map[string]string{"mount_point": "secret/"})
+	require.True(t, found)
+	assert.Equal(t, 3.0, reads.Value)
+	assert.Equal(t, "a \"quoted\" path\\with\nescapes", reads.Labels["description"])
+
+	alloc, found := metrics.Find("vault_runtime_alloc_bytes", nil)
+	require.True(t, found)
+	assert.True(t, math.IsInf(alloc.Value, 1))
+
+	_, found = metrics.Find("vault_core_handle_request", map[string]string{"quantile": "0.99"})
+	assert.False(t, found)
+}
+
+func TestParsePrometheusMetricsRejectsInvalidSamples(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		line          string
+		expectedError string
+	}{
+		{"NoValue", "vault_core_unsealed", "no value"},
+		{"InvalidValue", "vault_core_unsealed yes", "invalid value of vault_core_unsealed"},
+		{"UnterminatedLabels", `vault_core_handle_request{quantile="0.5" 1`, "expected , or }"},
+		{"UnterminatedLabelValue", `vault_core_handle_request{quantile="0.5} 1`, "unterminated value of label quantile"},
+		{"UnquotedLabelValue", `vault_core_handle_request{quantile=0.5} 1`, `expected label="value"`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parsePrometheusMetrics("# TYPE vault_core_unsealed gauge\n" + testCase.line + "\n")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "line 2")
+			assert.Contains(t, err.Error(), testCase.expectedError)
+		})
+	}
+}
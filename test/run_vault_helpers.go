@@ -0,0 +1,200 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+)
+
+const RUN_VAULT_SCRIPT_PATH = "modules/run-vault/run-vault"
+
+// The private IP the fake EC2 instance metadata endpoint returns for local-ipv4
+const FAKE_INSTANCE_IP_ADDRESS = "10.0.0.10"
+
+// The version the fake vault binary reports for 'vault -v'
+const FAKE_VAULT_VERSION = "1.6.1"
+
+// The install path we lay out in the temp folder, mirroring what install-vault creates on a real server
+const offlineVaultInstallPath = "/opt/vault"
+
+// The token the offline runs find in the default --audit-token-file, as if an operator had put it there after
+// initializing Vault
+const FAKE_AUDIT_TOKEN = "s.fake-audit-token"
+
+// The fake vault binary reports its version, reports that Vault is unsealed and that no audit devices are enabled, and
+// records the arguments of every other command it's run with
+const fakeVaultBinaryScript = `case "$1" in
+  -v) echo "Vault v%s ('0000000000000000000000000000000000000000')" ;;
+  status) exit 0 ;;
+  *)
+    echo "VAULT_TOKEN=$VAULT_TOKEN $@" >> "$STUB_LOG_DIR/vault.log"
+    if [[ "$1 $2" == "audit list" ]]; then
+      exit 2
+    fi
+    ;;
+esac`
+
+// Stub binaries put at the front of the PATH when running scripts offline. sudo just runs the command it's given,
+// while systemctl records its arguments so tests can check how Vault would have been started.
+var offlineStubScripts = map[string]string{
+	"sudo":      `exec "$@"`,
+	"systemctl": `echo "$@" >> "$STUB_LOG_DIR/systemctl.log"`,
+	"chown":     `echo "$@" >> "$STUB_LOG_DIR/chown.log"`,
+	"aws":       `exit 0`,
+}
+
+// RunVaultResult is what running the run-vault script offline produced. All paths in the generated files are
+// rewritten to be relative to the fake root, so they look exactly like they would on a real server.
+type RunVaultResult struct {
+	VaultConfig    string
+	SystemdUnit    string
+	SystemctlCalls []string
+	// The commands the fake vault binary ran, other than checking its version and the status of Vault
+	VaultCalls []string
+	// Whether the token in the default --audit-token-file is still there after run-vault finished
+	AuditTokenFileExists bool
+	Output               string
+}
+
+// Run the run-vault script with the given arguments in a temp folder laid out like a real Vault install, with stub
+// systemctl, sudo, chown and aws binaries and a local fake of the EC2 instance metadata endpoint, failing the test if
+// the script fails
+func runRunVaultOffline(t *testing.T, args ...string) RunVaultResult {
+	result, err := runRunVaultOfflineE(t, args...)
+	if err != nil {
+		t.Fatalf("run-vault failed: %v\n%s", err, result.Output)
+	}
+	return result
+}
+
+// Run the run-vault script with the given arguments in a temp folder laid out like a real Vault install, with stub
+// systemctl, sudo, chown and aws binaries and a local fake of the EC2 instance metadata endpoint
+func runRunVaultOfflineE(t *testing.T, args ...string) (RunVaultResult, error) {
+	rootDir, err := ioutil.TempDir("", "run-vault")
+	if err != nil {
+		t.Fatalf("Couldn't create temp folder: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	installDir := filepath.Join(rootDir, offlineVaultInstallPath)
+	for _, dir := range []string{"bin", "config", "data", "log", "tls"} {
+		if err := os.MkdirAll(filepath.Join(installDir, dir), 0755); err != nil {
+			t.Fatalf("Couldn't create folder: %v", err)
+		}
+	}
+
+	scriptPath := filepath.Join(installDir, "bin", "run-vault")
+	if err := files.CopyFile(filepath.Join(REPO_ROOT, RUN_VAULT_SCRIPT_PATH), scriptPath); err != nil {
+		t.Fatalf("Couldn't copy run-vault: %v", err)
+	}
+
+	vaultBinaryPath := filepath.Join(installDir, "bin", "vault")
+	writeExecutable(t, vaultBinaryPath, fmt.Sprintf(fakeVaultBinaryScript, FAKE_VAULT_VERSION))
+
+	auditTokenFile := filepath.Join(installDir, "data", "audit-token")
+	if err := ioutil.WriteFile(auditTokenFile, []byte(FAKE_AUDIT_TOKEN), 0600); err != nil {
+		t.Fatalf("Couldn't write %s: %v", auditTokenFile, err)
+	}
+
+	stubDir := filepath.Join(rootDir, "stubs")
+	writeStubScripts(t, stubDir, offlineStubScripts)
+
+	systemdConfigPath := filepath.Join(rootDir, "etc", "systemd", "system", "vault.service")
+	if err := os.MkdirAll(filepath.Dir(systemdConfigPath), 0755); err != nil {
+		t.Fatalf("Couldn't create folder: %v", err)
+	}
+
+	metadataServer := startFakeInstanceMetadataServer(t)
+	defer metadataServer.Close()
+
+	cmd := exec.Command("bash", append([]string{scriptPath}, args...)...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("PATH=%s%c%s", stubDir, os.PathListSeparator, os.Getenv("PATH")),
+		fmt.Sprintf("STUB_LOG_DIR=%s", rootDir),
+		fmt.Sprintf("SYSTEMD_CONFIG_PATH=%s", systemdConfigPath),
+		fmt.Sprintf("EC2_INSTANCE_METADATA_URL=%s/latest/meta-data", metadataServer.URL),
+		fmt.Sprintf("VAULT_BINARY_PATH=%s", vaultBinaryPath),
+	)
+
+	// This also waits for anything run-vault started in the background, e.g. to enable an audit device, as it shares the
+	// output of run-vault
+	output, runErr := cmd.CombinedOutput()
+	logger.Logf(t, "Output from run-vault %s:\n%s", strings.Join(args, " "), output)
+
+	result := RunVaultResult{
+		VaultConfig:          readFileRelativeToRoot(rootDir, filepath.Join(installDir, "config", "default.hcl")),
+		SystemdUnit:          readFileRelativeToRoot(rootDir, systemdConfigPath),
+		SystemctlCalls:       readLines(filepath.Join(rootDir, "systemctl.log")),
+		VaultCalls:           readLines(filepath.Join(rootDir, "vault.log")),
+		AuditTokenFileExists: files.FileExists(auditTokenFile),
+		Output:               string(output),
+	}
+	for i, call := range result.VaultCalls {
+		result.VaultCalls[i] = strings.Replace(call, rootDir, "", -1)
+	}
+
+	return result, runErr
+}
+
+// Start a local HTTP server that answers the EC2 instance metadata requests made by our scripts
+func startFakeInstanceMetadataServer(t *testing.T) *httptest.Server {
+	metadata := map[string]string{
+		"/latest/meta-data/local-ipv4/": FAKE_INSTANCE_IP_ADDRESS,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := metadata[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, value)
+	}))
+}
+
+// Write each of the given stub scripts as an executable into the given folder
+func writeStubScripts(t *testing.T, stubDir string, stubs map[string]string) {
+	if err := os.MkdirAll(stubDir, 0755); err != nil {
+		t.Fatalf("Couldn't create folder: %v", err)
+	}
+
+	for name, body := range stubs {
+		writeExecutable(t, filepath.Join(stubDir, name), body)
+	}
+}
+
+// Write a bash script with the given body to the given path and make it executable
+func writeExecutable(t *testing.T, path string, body string) {
+	contents := fmt.Sprintf("#!/bin/bash\n%s\n", body)
+	if err := ioutil.WriteFile(path, []byte(contents), 0755); err != nil {
+		t.Fatalf("Couldn't write %s: %v", path, err)
+	}
+}
+
+// Read the file at the given path, replacing the given root folder in its contents so paths look like they would on a
+// real server. Returns an empty string if the file doesn't exist.
+func readFileRelativeToRoot(rootDir string, path string) string {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.Replace(string(bytes), rootDir, "", -1)
+}
+
+// Read the lines of the file at the given path. Returns an empty slice if the file doesn't exist.
+func readLines(path string) []string {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSpace(string(bytes)), "\n")
+}
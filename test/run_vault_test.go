@@ -0,0 +1,338 @@
+package test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run 'go test -run TestRunVault -update-golden-files' to regenerate the golden files after an intended change to
+// the config run-vault generates. Review the diff before committing it!
+var updateGoldenFiles = flag.Bool("update-golden-files", false, "Overwrite the golden files in testdata with the actual output")
+
+const RUN_VAULT_GOLDEN_FILES_DIR = "testdata/run-vault"
+
+var runVaultServerArgs = []string{
+	"--tls-cert-file", "/opt/vault/tls/vault.crt.pem",
+	"--tls-key-file", "/opt/vault/tls/vault.key.pem",
+	"--user", "vault",
+}
+
+var runVaultAgentArgs = []string{
+	"--agent",
+	"--user", "vault",
+}
+
+var customPortsExpectations = vaultconfig.Expectations{
+	TlsCertFile: "/opt/vault/tls/vault.crt.pem",
+	TlsKeyFile:  "/opt/vault/tls/vault.key.pem",
+	Port:        9200,
+	ClusterPort: 9300,
+}
+
+var autoUnsealExpectations = vaultconfig.Expectations{
+	TlsCertFile: "/opt/vault/tls/vault.crt.pem",
+	TlsKeyFile:  "/opt/vault/tls/vault.key.pem",
+	Port:        8200,
+	ClusterPort: 8201,
+	AutoUnseal:  true,
+}
+
+var clientCertExpectations = vaultconfig.Expectations{
+	TlsCertFile:       "/opt/vault/tls/vault.crt.pem",
+	TlsKeyFile:        "/opt/vault/tls/vault.key.pem",
+	Port:              8200,
+	ClusterPort:       8201,
+	RequireClientCert: true,
+	TlsClientCAFile:   "/opt/vault/tls/ca.crt.pem",
+}
+
+var prometheusMetricsExpectations = vaultconfig.Expectations{
+	TlsCertFile:                  "/opt/vault/tls/vault.crt.pem",
+	TlsKeyFile:                   "/opt/vault/tls/vault.key.pem",
+	Port:                         8200,
+	ClusterPort:                  8201,
+	PrometheusRetentionTime:      "30m",
+	UnauthenticatedMetricsAccess: true,
+}
+
+// The flag combinations we check the generated config for. Each has a pair of golden files in
+// testdata/run-vault/<name>.hcl and testdata/run-vault/<name>.service. Server configs are also checked with the
+// vaultconfig package against the given expectations.
+var runVaultTestCases = []struct {
+	name         string
+	args         []string
+	expectations *vaultconfig.Expectations
+}{
+	{"consul-storage", runVaultServerArgs, &vaultconfig.DefaultExpectations},
+	{"custom-ports-and-logging", append([]string{
+		"--port", "9200",
+		"--cluster-port", "9300",
+		"--api-addr", "https://vault.example.com:9200",
+		"--log-level", "debug",
+		"--systemd-stdout", "journal",
+		"--systemd-stderr", "journal",
+	}, runVaultServerArgs...), &customPortsExpectations},
+	{"s3-storage", append([]string{
+		"--enable-s3-backend",
+		"--s3-bucket", "my-vault-bucket",
+		"--s3-bucket-path", "vault",
+		"--s3-bucket-region", "us-east-1",
+	}, runVaultServerArgs...), &vaultconfig.DefaultExpectations},
+	{"dynamodb-storage", append([]string{
+		"--enable-dynamo-backend",
+		"--dynamo-table", "my-vault-table",
+		"--dynamo-region", "us-east-1",
+	}, runVaultServerArgs...), &vaultconfig.DefaultExpectations},
+	{"s3-storage-dynamodb-ha", append([]string{
+		"--enable-s3-backend",
+		"--s3-bucket", "my-vault-bucket",
+		"--s3-bucket-region", "us-east-1",
+		"--enable-dynamo-backend",
+		"--dynamo-table", "my-vault-table",
+		"--dynamo-region", "us-east-1",
+	}, runVaultServerArgs...), &vaultconfig.DefaultExpectations},
+	{"auto-unseal", append([]string{
+		"--enable-auto-unseal",
+		"--auto-unseal-kms-key-id", "alias/my-vault-key",
+		"--auto-unseal-kms-key-region", "us-east-1",
+	}, runVaultServerArgs...), &autoUnsealExpectations},
+	{"auto-unseal-with-endpoint", append([]string{
+		"--enable-auto-unseal",
+		"--auto-unseal-kms-key-id", "alias/my-vault-key",
+		"--auto-unseal-kms-key-region", "us-east-1",
+		"--auto-unseal-endpoint", "https://vpce-0123456789abcdef0.kms.us-east-1.vpce.amazonaws.com",
+	}, runVaultServerArgs...), &autoUnsealExpectations},
+	{"require-client-cert", append([]string{
+		"--tls-require-client-cert",
+		"--tls-client-ca-file", "/opt/vault/tls/ca.crt.pem",
+	}, runVaultServerArgs...), &clientCertExpectations},
+	{"prometheus-metrics", append([]string{
+		"--enable-prometheus-metrics",
+		"--prometheus-retention-time", "30m",
+		"--unauthenticated-metrics-access",
+	}, runVaultServerArgs...), &prometheusMetricsExpectations},
+	{"agent-ec2-auth", append([]string{
+		"--agent-auth-type", "ec2",
+		"--agent-auth-role", "example-role",
+	}, runVaultAgentArgs...), nil},
+	{"agent-iam-auth-with-tls", append([]string{
+		"--agent-auth-type", "iam",
+		"--agent-auth-role", "example-role",
+		"--agent-auth-mount-path", "auth/my-aws",
+		"--agent-vault-address", "vault.example.com",
+		"--agent-vault-port", "9200",
+		"--agent-ca-cert-file", "/opt/vault/tls/ca.crt.pem",
+		"--agent-client-cert-file", "/opt/vault/tls/client.crt.pem",
+		"--agent-client-key-file", "/opt/vault/tls/client.key.pem",
+	}, runVaultAgentArgs...), nil},
+	{"agent-approle", append([]string{
+		"--agent-auth-type", "approle",
+		"--agent-auth-role", "example-role",
+		"--agent-approle-role-id-file", "/opt/vault/data/role-id",
+		"--agent-approle-secret-id-file", "/opt/vault/data/secret-id",
+	}, runVaultAgentArgs...), nil},
+	{"agent-approle-wrapped", append([]string{
+		"--agent-auth-type", "approle",
+		"--agent-auth-role", "example-role",
+		"--agent-auth-mount-path", "auth/on-prem",
+		"--agent-approle-role-id-file", "/opt/vault/data/role-id",
+		"--agent-approle-secret-id-file", "/opt/vault/data/secret-id",
+		"--agent-approle-wrapped-secret-id",
+	}, runVaultAgentArgs...), nil},
+	{"agent-listener", append([]string{"--agent-auth-type", "iam", "--agent-auth-role", "example-role", "--agent-listener-address", "127.0.0.1:8100"}, runVaultAgentArgs...), nil},
+	{"agent-listener-tls", append([]string{
+		"--agent-auth-type", "iam",
+		"--agent-auth-role", "example-role",
+		"--agent-listener-address", "0.0.0.0:8100",
+		"--agent-listener-tls-cert-file", "/opt/vault/tls/vault.crt.pem",
+		"--agent-listener-tls-key-file", "/opt/vault/tls/vault.key.pem",
+	}, runVaultAgentArgs...), nil},
+	{"agent-templates", append([]string{
+		"--agent-auth-type", "iam",
+		"--agent-auth-role", "example-role",
+		"--agent-template", "/opt/vault/templates/app.conf.ctmpl:/opt/app/app.conf",
+		"--agent-template", `/opt/vault/templates/db.ctmpl:/opt/app/db.conf:0640:sh -c "systemctl reload app || echo 'reload failed: retrying later'"`,
+	}, runVaultAgentArgs...), nil},
+	{"agent-cert-auth", append([]string{
+		"--agent-auth-type", "cert",
+		"--agent-auth-role", "example-role",
+		"--agent-ca-cert-file", "/opt/vault/tls/ca.crt.pem",
+		"--agent-client-cert-file", "/opt/vault/tls/vault.crt.pem",
+		"--agent-client-key-file", "/opt/vault/tls/vault.key.pem",
+	}, runVaultAgentArgs...), nil},
+}
+
+func TestRunVaultGeneratedConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range runVaultTestCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			result := runRunVaultOffline(t, testCase.args...)
+
+			assertMatchesGoldenFile(t, filepath.Join(RUN_VAULT_GOLDEN_FILES_DIR, testCase.name+".hcl"), result.VaultConfig)
+			assertMatchesGoldenFile(t, filepath.Join(RUN_VAULT_GOLDEN_FILES_DIR, testCase.name+".service"), result.SystemdUnit)
+			assert.Equal(t, []string{"daemon-reload", "enable vault.service", "restart vault.service"}, result.SystemctlCalls)
+
+			if testCase.expectations != nil {
+				config, err := vaultconfig.Parse([]byte(result.VaultConfig), "default.hcl")
+				require.NoError(t, err)
+				assert.NoError(t, config.Validate(*testCase.expectations))
+			}
+		})
+	}
+}
+
+func TestRunVaultRejectsMissingRequiredFlags(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		args         []string
+		expectedFlag string
+	}{
+		{"NoTlsCert", []string{"--tls-key-file", "/opt/vault/tls/vault.key.pem"}, "--tls-cert-file"},
+		{"S3WithoutBucket", append([]string{"--enable-s3-backend", "--s3-bucket-region", "us-east-1"}, runVaultServerArgs...), "--s3-bucket"},
+		{"DynamoWithoutTable", append([]string{"--enable-dynamo-backend", "--dynamo-region", "us-east-1"}, runVaultServerArgs...), "--dynamo-table"},
+		{"AutoUnsealWithoutKey", append([]string{"--enable-auto-unseal", "--auto-unseal-kms-key-region", "us-east-1"}, runVaultServerArgs...), "--auto-unseal-kms-key-id"},
+		{"AgentWithoutRole", append([]string{"--agent-auth-type", "iam"}, runVaultAgentArgs...), "--agent-auth-role"},
+		{"AgentAppRoleWithoutSecretId", append([]string{"--agent-auth-type", "approle", "--agent-auth-role", "example-role", "--agent-approle-role-id-file", "/opt/vault/data/role-id"}, runVaultAgentArgs...), "--agent-approle-secret-id-file"},
+		{"AgentListenerTlsWithoutKey", append([]string{"--agent-auth-type", "iam", "--agent-auth-role", "example-role", "--agent-listener-address", "0.0.0.0:8100", "--agent-listener-tls-cert-file", "/opt/vault/tls/vault.crt.pem"}, runVaultAgentArgs...), "--agent-listener-tls-key-file"},
+		{"AgentListenerTlsWithoutAddress", append([]string{"--agent-auth-type", "iam", "--agent-auth-role", "example-role", "--agent-listener-tls-cert-file", "/opt/vault/tls/vault.crt.pem", "--agent-listener-tls-key-file", "/opt/vault/tls/vault.key.pem"}, runVaultAgentArgs...), "--agent-listener-address"},
+		{"AgentCertAuthWithoutClientCert", append([]string{"--agent-auth-type", "cert", "--agent-auth-role", "example-role"}, runVaultAgentArgs...), "--agent-client-cert-file"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := runRunVaultOfflineE(t, testCase.args...)
+			require.Error(t, err)
+			assert.Contains(t, result.Output, "The value for '"+testCase.expectedFlag+"' cannot be empty")
+			assert.Empty(t, result.SystemctlCalls)
+		})
+	}
+}
+
+func TestRunVaultRejectsInvalidAgentTemplates(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		template      string
+		expectedError string
+	}{
+		{"NoDestination", "/opt/vault/templates/app.conf.ctmpl", "must be in the format SOURCE:DESTINATION[:PERMS[:COMMAND]]"},
+		{"EmptySource", ":/opt/app/app.conf", "must be in the format SOURCE:DESTINATION[:PERMS[:COMMAND]]"},
+		{"InvalidPerms", "/opt/vault/templates/app.conf.ctmpl:/opt/app/app.conf:rw-r-----", "must be in octal"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := append([]string{"--agent-auth-type", "iam", "--agent-auth-role", "example-role", "--agent-template", testCase.template}, runVaultAgentArgs...)
+			result, err := runRunVaultOfflineE(t, args...)
+			require.Error(t, err)
+			assert.Contains(t, result.Output, testCase.expectedError)
+			assert.Empty(t, result.SystemctlCalls)
+		})
+	}
+}
+
+func TestRunVaultEnablesAuditDevice(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		args                []string
+		expectedEnableCall  string
+		expectedAuditLogDir bool
+	}{
+		{"File", []string{"--enable-audit-device", "file"}, "audit enable file hmac_accessor=true file_path=/opt/vault/log/vault-audit.log", true},
+		{"FileWithRawAccessors", []string{"--enable-audit-device", "file", "--audit-hmac-accessor", "false"}, "audit enable file hmac_accessor=false file_path=/opt/vault/log/vault-audit.log", true},
+		{"Syslog", []string{"--enable-audit-device", "syslog", "--audit-syslog-tag", "vault-audit"}, "audit enable syslog hmac_accessor=true tag=vault-audit", false},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			result := runRunVaultOffline(t, append(testCase.args, runVaultServerArgs...)...)
+
+			// Audit devices are enabled through the API once Vault is up, so they don't change the generated config
+			assertMatchesGoldenFile(t, filepath.Join(RUN_VAULT_GOLDEN_FILES_DIR, "consul-storage.hcl"), result.VaultConfig)
+
+			assert.Equal(t, []string{
+				"VAULT_TOKEN=" + FAKE_AUDIT_TOKEN + " audit list -format=json",
+				"VAULT_TOKEN=" + FAKE_AUDIT_TOKEN + " " + testCase.expectedEnableCall,
+			}, result.VaultCalls)
+			assert.False(t, result.AuditTokenFileExists, "Expected run-vault to delete the audit token file once it read the token")
+			assert.Equal(t, testCase.expectedAuditLogDir, strings.Contains(result.Output, "for the audit log"))
+		})
+	}
+}
+
+func TestRunVaultRejectsInvalidAuditDevices(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{"UnknownType", append([]string{"--enable-audit-device", "socket"}, runVaultServerArgs...), "must be file or syslog"},
+		{"InvalidHmacAccessor", append([]string{"--enable-audit-device", "file", "--audit-hmac-accessor", "no"}, runVaultServerArgs...), "must be true or false"},
+		{"AgentMode", append([]string{"--enable-audit-device", "file", "--agent-auth-type", "iam", "--agent-auth-role", "example-role"}, runVaultAgentArgs...), "can only be enabled on a Vault server"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := runRunVaultOfflineE(t, testCase.args...)
+			require.Error(t, err)
+			assert.Contains(t, result.Output, testCase.expectedError)
+			assert.Empty(t, result.SystemctlCalls)
+			assert.Empty(t, result.VaultCalls)
+		})
+	}
+}
+
+func TestRunVaultRejectsPrometheusMetricsInAgentMode(t *testing.T) {
+	t.Parallel()
+
+	args := append([]string{"--enable-prometheus-metrics", "--agent-auth-type", "iam", "--agent-auth-role", "example-role"}, runVaultAgentArgs...)
+	result, err := runRunVaultOfflineE(t, args...)
+	require.Error(t, err)
+	assert.Contains(t, result.Output, "Prometheus metrics can only be enabled on a Vault server")
+	assert.Empty(t, result.SystemctlCalls)
+}
+
+// Check that the actual contents match the golden file at the given path, or overwrite the golden file if the
+// -update-golden-files flag is set
+func assertMatchesGoldenFile(t *testing.T, goldenFilePath string, actual string) {
+	if *updateGoldenFiles {
+		require.NoError(t, os.MkdirAll(filepath.Dir(goldenFilePath), 0755))
+		require.NoError(t, ioutil.WriteFile(goldenFilePath, []byte(actual), 0644))
+		return
+	}
+
+	expected, err := ioutil.ReadFile(goldenFilePath)
+	require.NoError(t, err, "Missing golden file %s. Run the tests with -update-golden-files to create it.", goldenFilePath)
+	assert.Equal(t, string(expected), actual, "Output does not match golden file %s", goldenFilePath)
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+var terraformOutputSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "output", LabelNames: []string{"name"}},
+	},
+}
+
+// Parse the names of the outputs declared in the .tf files at the top level of the given folder. This lets us check
+// that the outputs our tests read actually exist without having to deploy anything.
+func parseTerraformOutputs(terraformDir string) (map[string]bool, error) {
+	paths, err := filepath.Glob(filepath.Join(terraformDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .tf files found in %s", terraformDir)
+	}
+
+	parser := hclparse.NewParser()
+	outputs := map[string]bool{}
+
+	for _, path := range paths {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		content, _, diags := file.Body.PartialContent(terraformOutputSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			outputs[block.Labels[0]] = true
+		}
+	}
+
+	return outputs, nil
+}
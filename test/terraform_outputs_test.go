@@ -0,0 +1,70 @@
+package test
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The outputs each test scenario (and the vault-examples-helper script) reads from the example it deploys. If you
+// rename an output in one of the examples, or start reading a new one in a test, update this list too.
+var exampleOutputContracts = map[string][]string{
+	".": {
+		OUTPUT_VAULT_CLUSTER_ASG_NAME,
+		VAULT_CLUSTER_PUBLIC_OUTPUT_ELB_DNS_NAME,
+		VAULT_CLUSTER_PUBLIC_OUTPUT_FQDN,
+		"aws_region",
+		"ssh_key_name",
+		"vault_cluster_size",
+		"vault_servers_cluster_tag_key",
+		"vault_servers_cluster_tag_value",
+	},
+	VAULT_CLUSTER_PRIVATE_PATH:          {OUTPUT_VAULT_CLUSTER_ASG_NAME},
+	VAULT_CLUSTER_S3_BACKEND_PATH:       {OUTPUT_VAULT_CLUSTER_ASG_NAME},
+	VAULT_CLUSTER_DYNAMODB_BACKEND_PATH: {OUTPUT_VAULT_CLUSTER_ASG_NAME},
+	VAULT_AUTO_UNSEAL_AUTH_PATH:         {OUTPUT_VAULT_CLUSTER_ASG_NAME},
+	VAULT_EC2_AUTH_PATH:                 {OUTPUT_VAULT_CLUSTER_ASG_NAME, OUTPUT_AUTH_CLIENT_IP, OUTPUT_AUTH_CLIENT_INSTANCE_ID, OUTPUT_AUTH_ROLE_NAME},
+	VAULT_IAM_AUTH_PATH:                 {OUTPUT_VAULT_CLUSTER_ASG_NAME, OUTPUT_AUTH_CLIENT_IP, OUTPUT_AUTH_CLIENT_INSTANCE_ID, OUTPUT_AUTH_ROLE_NAME, OUTPUT_AUTH_ROLE_ARN},
+	VAULT_AGENT_PATH:                    {OUTPUT_VAULT_CLUSTER_ASG_NAME, OUTPUT_AUTH_CLIENT_IP, OUTPUT_AUTH_CLIENT_INSTANCE_ID},
+	VAULT_CERT_AUTH_PATH:                {OUTPUT_VAULT_CLUSTER_ASG_NAME, OUTPUT_AUTH_CLIENT_IP, OUTPUT_AUTH_CLIENT_INSTANCE_ID, OUTPUT_AUTH_ROLE_NAME, OUTPUT_AUTH_CLIENT_CERT, OUTPUT_AUTH_CLIENT_PRIVATE_KEY},
+	VAULT_APPROLE_AUTH_PATH:             {OUTPUT_VAULT_CLUSTER_ASG_NAME, OUTPUT_AUTH_CLIENT_IP, OUTPUT_AUTH_CLIENT_INSTANCE_ID, OUTPUT_AUTH_ROLE_NAME},
+}
+
+func TestExampleOutputContracts(t *testing.T) {
+	t.Parallel()
+
+	for examplePath, expectedOutputs := range exampleOutputContracts {
+		outputs, err := parseTerraformOutputs(filepath.Join(REPO_ROOT, examplePath))
+		require.NoError(t, err, "Failed to parse the outputs of %s", examplePath)
+
+		for _, output := range expectedOutputs {
+			assert.True(t, outputs[output], "The tests read output %s from %s, but it does not declare it", output, examplePath)
+		}
+	}
+}
+
+// Make sure every example that declares outputs has an entry in exampleOutputContracts, so new examples don't slip
+// through without their outputs being checked
+func TestEveryExampleHasOutputContract(t *testing.T) {
+	t.Parallel()
+
+	outputFiles, err := filepath.Glob(filepath.Join(REPO_ROOT, "examples", "*", "outputs.tf"))
+	require.NoError(t, err)
+	require.NotEmpty(t, outputFiles)
+
+	examplePaths := []string{}
+	for _, outputFile := range outputFiles {
+		examplePath, err := filepath.Rel(REPO_ROOT, filepath.Dir(outputFile))
+		require.NoError(t, err)
+		examplePaths = append(examplePaths, filepath.ToSlash(examplePath))
+	}
+	sort.Strings(examplePaths)
+
+	for _, examplePath := range examplePaths {
+		_, hasContract := exampleOutputContracts[examplePath]
+		assert.True(t, hasContract, "Example %s has no entry in exampleOutputContracts", examplePath)
+	}
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// TerraformVariable is a single input variable declared in a Terraform module
+type TerraformVariable struct {
+	Name     string
+	Type     cty.Type
+	Required bool
+}
+
+// TerraformVars is a builder for the input variables we pass to one of the Terraform modules in this repo. Unlike a
+// plain map[string]interface{}, it knows which variables the module actually declares (parsed from its .tf files), so
+// a typo in a variable name or a value of the wrong type fails the test before we ever run 'terraform apply'.
+type TerraformVars struct {
+	terraformDir string
+	declared     map[string]TerraformVariable
+	values       map[string]interface{}
+}
+
+var terraformVariableSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+	},
+}
+
+var terraformVariableBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "type"},
+		{Name: "default"},
+	},
+}
+
+// Create a new TerraformVars builder for the Terraform module in the given folder
+func newTerraformVars(t *testing.T, terraformDir string) *TerraformVars {
+	vars, err := newTerraformVarsE(terraformDir)
+	if err != nil {
+		t.Fatalf("Failed to parse the variables of the Terraform module in %s: %v", terraformDir, err)
+	}
+	return vars
+}
+
+// Create a new TerraformVars builder for the Terraform module in the given folder, returning an error if the module's
+// variables can't be parsed
+func newTerraformVarsE(terraformDir string) (*TerraformVars, error) {
+	declared, err := parseTerraformVariables(terraformDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TerraformVars{
+		terraformDir: terraformDir,
+		declared:     declared,
+		values:       map[string]interface{}{},
+	}, nil
+}
+
+// Parse the variable blocks declared in the .tf files at the top level of the given folder
+func parseTerraformVariables(terraformDir string) (map[string]TerraformVariable, error) {
+	paths, err := filepath.Glob(filepath.Join(terraformDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .tf files found in %s", terraformDir)
+	}
+
+	parser := hclparse.NewParser()
+	variables := map[string]TerraformVariable{}
+
+	for _, path := range paths {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		content, _, diags := file.Body.PartialContent(terraformVariableSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range content.Blocks {
+			variable, err := parseTerraformVariable(block)
+			if err != nil {
+				return nil, err
+			}
+			variables[variable.Name] = variable
+		}
+	}
+
+	return variables, nil
+}
+
+// Parse a single variable block. Variables without a type constraint accept any value, just like in Terraform.
+func parseTerraformVariable(block *hcl.Block) (TerraformVariable, error) {
+	variable := TerraformVariable{
+		Name: block.Labels[0],
+		Type: cty.DynamicPseudoType,
+	}
+
+	content, _, diags := block.Body.PartialContent(terraformVariableBlockSchema)
+	if diags.HasErrors() {
+		return variable, diags
+	}
+
+	if typeAttr, hasType := content.Attributes["type"]; hasType {
+		variableType, diags := typeexpr.TypeConstraint(typeAttr.Expr)
+		if diags.HasErrors() {
+			return variable, diags
+		}
+		variable.Type = variableType
+	}
+
+	_, hasDefault := content.Attributes["default"]
+	variable.Required = !hasDefault
+
+	return variable, nil
+}
+
+// Set the given variable to the given value. Errors, such as unknown variable names or values of the wrong type, are
+// reported when the variables are built.
+func (vars *TerraformVars) Set(name string, value interface{}) *TerraformVars {
+	vars.values[name] = value
+	return vars
+}
+
+// Validate the variables and return them encoded for use as terraform.Options.Vars, failing the test on any error
+func (vars *TerraformVars) Build(t *testing.T) map[string]interface{} {
+	encoded, err := vars.BuildE()
+	if err != nil {
+		t.Fatalf("Invalid variables for the Terraform module in %s: %v", vars.terraformDir, err)
+	}
+	return encoded
+}
+
+// Validate the variables and return them encoded for use as terraform.Options.Vars. Every variable must be declared
+// by the module, every value must match the declared type, and every required variable must be set.
+func (vars *TerraformVars) BuildE() (map[string]interface{}, error) {
+	encoded := map[string]interface{}{}
+	problems := []string{}
+
+	names := []string{}
+	for name := range vars.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		variable, isDeclared := vars.declared[name]
+		if !isDeclared {
+			problems = append(problems, fmt.Sprintf("variable %q is not declared by the module", name))
+			continue
+		}
+
+		value, err := toTerraformValue(vars.values[name], variable.Type)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("variable %q: %v", name, err))
+			continue
+		}
+
+		encoded[name] = encodeTerraformValue(value)
+	}
+
+	missing := []string{}
+	for name, variable := range vars.declared {
+		if _, isSet := vars.values[name]; variable.Required && !isSet {
+			missing = append(missing, fmt.Sprintf("required variable %q is not set", name))
+		}
+	}
+	sort.Strings(missing)
+	problems = append(problems, missing...)
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return encoded, nil
+}
+
+// Convert the given Go value to a value of the given Terraform type. We are stricter than Terraform itself here: a
+// primitive value must have exactly the declared type, so passing 1 for a bool or true for a string is an error
+// rather than something Terraform silently coerces.
+func toTerraformValue(goValue interface{}, variableType cty.Type) (cty.Value, error) {
+	if goValue == nil {
+		return cty.NilVal, fmt.Errorf("value cannot be nil; leave the variable unset to use its default")
+	}
+
+	impliedType, err := gocty.ImpliedType(goValue)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("unsupported Go type %T: %v", goValue, err)
+	}
+
+	value, err := gocty.ToCtyValue(goValue, impliedType)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	if variableType.IsPrimitiveType() && !impliedType.Equals(variableType) {
+		return cty.NilVal, fmt.Errorf("expected a %s, but got %T", variableType.FriendlyName(), goValue)
+	}
+
+	if !impliedType.Equals(variableType) && convert.GetConversion(impliedType, variableType) == nil {
+		return cty.NilVal, fmt.Errorf("expected a %s, but got %T", variableType.FriendlyName(), goValue)
+	}
+
+	return convert.Convert(value, variableType)
+}
+
+// Encode the given value the way Terraform expects it in a -var argument: primitives are passed as their raw string
+// form, while lists, maps and objects are passed as HCL expressions with all strings properly quoted and escaped.
+func encodeTerraformValue(value cty.Value) string {
+	switch {
+	case value.Type() == cty.String:
+		return value.AsString()
+	case value.Type() == cty.Number:
+		return value.AsBigFloat().Text('f', -1)
+	case value.Type() == cty.Bool:
+		if value.True() {
+			return "true"
+		}
+		return "false"
+	default:
+		return string(hclwrite.TokensForValue(value).Bytes())
+	}
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testVariablesTf = `
+variable "name" {
+  type = string
+}
+
+variable "enabled" {
+  type    = bool
+  default = false
+}
+
+variable "size" {
+  type    = number
+  default = 1
+}
+
+variable "names" {
+  type    = list(string)
+  default = []
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+variable "untyped" {
+  default = ""
+}
+`
+
+func writeTestVariablesTf(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "terraform-vars")
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "variables.tf"), []byte(testVariablesTf), 0644))
+	return dir
+}
+
+func TestTerraformVarsEncodesValues(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTestVariablesTf(t)
+	defer os.RemoveAll(dir)
+
+	vars, err := newTerraformVars(t, dir).
+		Set("name", `my "quoted" name`).
+		Set("enabled", true).
+		Set("size", 3).
+		Set("names", []string{"a", `b"c`}).
+		Set("tags", map[string]string{"Name": "vault", "my-tag": "x"}).
+		Set("untyped", 42).
+		BuildE()
+	require.NoError(t, err)
+
+	assert.Equal(t, `my "quoted" name`, vars["name"])
+	assert.Equal(t, "true", vars["enabled"])
+	assert.Equal(t, "3", vars["size"])
+	assert.Equal(t, `["a", "b\"c"]`, vars["names"])
+	assert.Equal(t, "{\n  Name   = \"vault\"\n  my-tag = \"x\"\n}", vars["tags"])
+	assert.Equal(t, "42", vars["untyped"])
+}
+
+func TestTerraformVarsRejectsInvalidValues(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTestVariablesTf(t)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name          string
+		variable      string
+		value         interface{}
+		expectedError string
+	}{
+		{"UnknownName", "nmae", "foo", `variable "nmae" is not declared by the module`},
+		{"IntForBool", "enabled", 1, `variable "enabled": expected a bool, but got int`},
+		{"BoolForString", "name", true, `variable "name": expected a string, but got bool`},
+		{"StringForNumber", "size", "3", `variable "size": expected a number, but got string`},
+		{"StringForList", "names", "a", `variable "names": expected a list of string, but got string`},
+		{"ListForMap", "tags", []string{"a"}, `variable "tags": expected a map of string, but got []string`},
+		{"Nil", "names", nil, `variable "names": value cannot be nil`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := newTerraformVars(t, dir).
+				Set("name", "foo").
+				Set(testCase.variable, testCase.value).
+				BuildE()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testCase.expectedError)
+		})
+	}
+}
+
+func TestTerraformVarsRejectsMissingRequiredVariables(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTestVariablesTf(t)
+	defer os.RemoveAll(dir)
+
+	_, err := newTerraformVars(t, dir).Set("size", 2).BuildE()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `required variable "name" is not set`)
+}
+
+// Make sure the variables each scenario sets are actually declared by the examples they deploy
+func TestTerraformVarsMatchExamples(t *testing.T) {
+	t.Parallel()
+
+	examples := map[string][]string{
+		".":                                 {VAULT_CLUSTER_PUBLIC_VAR_CREATE_DNS_ENTRY, VAULT_CLUSTER_PUBLIC_VAR_HOSTED_ZONE_DOMAIN_NAME, VAULT_CLUSTER_PUBLIC_VAR_VAULT_DOMAIN_NAME, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_CLUSTER_PRIVATE_PATH:          {VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_CLUSTER_S3_BACKEND_PATH:       {VAR_S3_BUCKET_NAME, VAR_FORCE_DESTROY_S3_BUCKET, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_CLUSTER_DYNAMODB_BACKEND_PATH: {VAR_DYNAMO_TABLE_NAME, VAR_S3_BUCKET_NAME, VAR_FORCE_DESTROY_S3_BUCKET},
+		VAULT_AUTO_UNSEAL_AUTH_PATH:         {VAR_VAULT_AUTO_UNSEAL_KMS_KEY_ALIAS, VAR_VAULT_CLUSTER_SIZE, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_EC2_AUTH_PATH:                 {VAR_VAULT_AUTH_SERVER_NAME, VAR_VAULT_SECRET_NAME, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_IAM_AUTH_PATH:                 {VAR_VAULT_AUTH_SERVER_NAME, VAR_VAULT_IAM_AUTH_ROLE, VAR_VAULT_SECRET_NAME, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_AGENT_PATH:                    {VAR_VAULT_AUTH_SERVER_NAME, VAR_VAULT_IAM_AUTH_ROLE, VAR_VAULT_SECRET_NAME, VAR_VAULT_AGENT_ROLE_TTL, VAR_VAULT_AGENT_ROLE_MAX_TTL, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_CERT_AUTH_PATH:                {VAR_VAULT_AUTH_SERVER_NAME, VAR_VAULT_IAM_AUTH_ROLE, VAR_VAULT_SECRET_NAME, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+		VAULT_APPROLE_AUTH_PATH:             {VAR_VAULT_AUTH_SERVER_NAME, VAR_VAULT_IAM_AUTH_ROLE, VAR_VAULT_SECRET_NAME, VAR_CONSUL_CLUSTER_NAME, VAR_CONSUL_CLUSTER_TAG_KEY},
+	}
+
+	for examplePath, variableNames := range examples {
+		vars := newTerraformVars(t, filepath.Join(REPO_ROOT, examplePath))
+		for _, name := range append(variableNames, VAR_AMI_ID, VAR_VAULT_CLUSTER_NAME, VAR_SSH_KEY_NAME) {
+			_, isDeclared := vars.declared[name]
+			assert.True(t, isDeclared, "Expected %s to declare variable %s", examplePath, name)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package test
 
 import (
-	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/logger"
@@ -14,25 +15,61 @@ const AMI_VAR_AWS_REGION = "aws_region"
 const AMI_VAR_CA_PUBLIC_KEY = "ca_public_key_path"
 const AMI_VAR_TLS_PUBLIC_KEY = "tls_public_key_path"
 const AMI_VAR_TLS_PRIVATE_KEY = "tls_private_key_path"
+const AMI_VAR_TLS_CHAIN = "tls_chain_path"
+const AMI_VAR_SIGN_REQUEST_BINARY = "sign_request_binary_path"
 const AMI_VAR_VAULT_DOWNLOAD_URL = "VAULT_DOWNLOAD_URL"
 
 const SAVED_TLS_CERT = "TlsCert"
 
+// The folder of the sign-request command the Packer template installs on the AMIs, relative to the test folder
+const SIGN_REQUEST_PATH = "../modules/sign-request"
+
 // Use Packer to build the AMI in the given packer template, with the given build name, and return the AMI's ID
-func composeAmiOptions(t *testing.T, packerTemplatePath string, packerBuildName string, tlsCert TlsCert, awsRegion string, vaultDownloadUrl string) *packer.Options {
-	return &packer.Options{
+func composeAmiOptions(t *testing.T, packerTemplatePath string, packerBuildName string, tlsCert TlsCert, signRequestBinaryPath string, awsRegion string, vaultDownloadUrl string) *packer.Options {
+	options := &packer.Options{
 		Template: packerTemplatePath,
 		Only:     packerBuildName,
 		Vars: map[string]string{
-			AMI_VAR_AWS_REGION:      awsRegion,
-			AMI_VAR_CA_PUBLIC_KEY:   tlsCert.CAPublicKeyPath,
-			AMI_VAR_TLS_PUBLIC_KEY:  tlsCert.PublicKeyPath,
-			AMI_VAR_TLS_PRIVATE_KEY: tlsCert.PrivateKeyPath,
+			AMI_VAR_AWS_REGION:          awsRegion,
+			AMI_VAR_CA_PUBLIC_KEY:       tlsCert.CAPublicKeyPath,
+			AMI_VAR_TLS_PUBLIC_KEY:      tlsCert.PublicKeyPath,
+			AMI_VAR_TLS_PRIVATE_KEY:     tlsCert.PrivateKeyPath,
+			AMI_VAR_SIGN_REQUEST_BINARY: signRequestBinaryPath,
 		},
 		Env: map[string]string{
 			AMI_VAR_VAULT_DOWNLOAD_URL: vaultDownloadUrl,
 		},
 	}
+
+	// The Packer template installs the chain as Vault's TLS cert, so Vault serves any intermediate CAs too. Without
+	// a chain, it installs the public key instead.
+	if tlsCert.ChainPath != "" {
+		options.Vars[AMI_VAR_TLS_CHAIN] = tlsCert.ChainPath
+	}
+
+	return options
+}
+
+// Build the sign-request command for the AMIs, which are all Linux on x86_64, to a temp file, and return its path
+func buildSignRequestBinary(t *testing.T) string {
+	binaryFile, err := ioutil.TempFile("", "sign-request")
+	if err != nil {
+		t.Fatalf("Couldn't create a temp file for the sign-request binary: %v", err)
+	}
+	binaryFile.Close()
+
+	cmd := exec.Command("go", "build", "-o", binaryFile.Name(), ".")
+	cmd.Dir = SIGN_REQUEST_PATH
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(binaryFile.Name())
+		t.Fatalf("Couldn't build %s: %v\n%s", SIGN_REQUEST_PATH, err, output)
+	}
+
+	logger.Logf(t, "Built %s for the AMIs to %s", SIGN_REQUEST_PATH, binaryFile.Name())
+	return binaryFile.Name()
 }
 
 func saveTlsCert(t *testing.T, testFolder string, tlsCert TlsCert) {
@@ -44,13 +81,3 @@ func loadTlsCert(t *testing.T, testFolder string) TlsCert {
 	test_structure.LoadTestData(t, test_structure.FormatTestDataPath(testFolder, SAVED_TLS_CERT), &tlsCert)
 	return tlsCert
 }
-
-func writeLogFile(t *testing.T, buffer string, destination string) {
-	file, err := os.Create(destination)
-	if err != nil {
-		logger.Logf(t, fmt.Sprintf("Error creating log file on disk: %s", err.Error()))
-	}
-	defer file.Close()
-
-	file.WriteString(buffer)
-}
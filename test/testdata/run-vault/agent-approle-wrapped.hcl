@@ -0,0 +1,24 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+
+
+}
+
+auto_auth {
+  method "approle" {
+    mount_path = "auth/on-prem"
+    config = {
+      role_id_file_path   = "/opt/vault/data/role-id"
+      secret_id_file_path = "/opt/vault/data/secret-id"
+      secret_id_response_wrapping_path = "auth/on-prem/role/example-role/secret-id"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
@@ -0,0 +1,23 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+
+
+}
+
+auto_auth {
+  method "approle" {
+    mount_path = "auth/approle"
+    config = {
+      role_id_file_path   = "/opt/vault/data/role-id"
+      secret_id_file_path = "/opt/vault/data/secret-id"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
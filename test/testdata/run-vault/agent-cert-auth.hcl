@@ -0,0 +1,25 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+  ca_cert = "/opt/vault/tls/ca.crt.pem"
+
+  client_cert = "/opt/vault/tls/vault.crt.pem"
+  client_key = "/opt/vault/tls/vault.key.pem"
+
+}
+
+auto_auth {
+  method "cert" {
+    mount_path = "auth/cert"
+    config = {
+      name = "example-role"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
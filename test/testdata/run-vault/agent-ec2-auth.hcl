@@ -0,0 +1,23 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+
+
+}
+
+auto_auth {
+  method "aws" {
+    mount_path = "auth/aws"
+    config = {
+      type = "ec2"
+      role = "example-role"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
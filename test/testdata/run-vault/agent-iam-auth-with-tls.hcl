@@ -0,0 +1,26 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.example.com:9200"
+  ca_cert = "/opt/vault/tls/ca.crt.pem"
+
+  client_cert = "/opt/vault/tls/client.crt.pem"
+  client_key = "/opt/vault/tls/client.key.pem"
+
+}
+
+auto_auth {
+  method "aws" {
+    mount_path = "auth/my-aws"
+    config = {
+      type = "iam"
+      role = "example-role"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
@@ -0,0 +1,33 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+
+
+}
+
+auto_auth {
+  method "aws" {
+    mount_path = "auth/aws"
+    config = {
+      type = "iam"
+      role = "example-role"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
+cache {
+  use_auto_auth_token = true
+}
+
+listener "tcp" {
+  address       = "0.0.0.0:8100"
+  tls_cert_file = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file  = "/opt/vault/tls/vault.key.pem"
+}
+
@@ -0,0 +1,35 @@
+pid_file   = "/opt/vault/data/vault-pid"
+vault {
+  address = "https://vault.service.consul:8200"
+
+
+}
+
+auto_auth {
+  method "aws" {
+    mount_path = "auth/aws"
+    config = {
+      type = "iam"
+      role = "example-role"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/opt/vault/data/vault-token"
+    }
+  }
+}
+
+template {
+  source      = "/opt/vault/templates/app.conf.ctmpl"
+  destination = "/opt/app/app.conf"
+}
+
+template {
+  source      = "/opt/vault/templates/db.ctmpl"
+  destination = "/opt/app/db.conf"
+  perms       = "0640"
+  command     = "sh -c \"systemctl reload app || echo 'reload failed: retrying later'\""
+}
+
@@ -0,0 +1,25 @@
+ui = true
+seal "awskms" {
+  kms_key_id = "alias/my-vault-key"
+  region     = "us-east-1"
+  
+}
+
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+}
+
+
+storage "consul" {
+  address = "127.0.0.1:8500"
+  path    = "vault/"
+  scheme  = "http"
+  service = "vault"
+}
+# HA settings
+cluster_addr  = "https://10.0.0.10:8201"
+api_addr      = "https://10.0.0.10:8200"
+
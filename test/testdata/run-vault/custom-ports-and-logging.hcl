@@ -0,0 +1,20 @@
+ui = true
+
+listener "tcp" {
+  address         = "0.0.0.0:9200"
+  cluster_address = "0.0.0.0:9300"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+}
+
+
+storage "consul" {
+  address = "127.0.0.1:8500"
+  path    = "vault/"
+  scheme  = "http"
+  service = "vault"
+}
+# HA settings
+cluster_addr  = "https://10.0.0.10:9300"
+api_addr      = "https://vault.example.com:9200"
+
@@ -0,0 +1,27 @@
+ui = true
+
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+}
+
+storage "s3" {
+  bucket = "my-vault-bucket"
+  path   = ""
+  region = "us-east-1"
+}
+
+ha_storage "dynamodb" {
+  ha_enabled = "true"
+  region = "us-east-1"
+  table  = "my-vault-table"
+}
+# HA settings
+cluster_addr  = "https://10.0.0.10:8201"
+api_addr      = "https://10.0.0.10:8200"
+service_registration "consul" {
+  address = "localhost:8500"
+}
+
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlsverify"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const vaultApiPort = 8200
+const vaultElbPort = 443
+
+// How long checkTlsEndpointWithRetry keeps trying the ELB and its Route 53 name
+const tlsEndpointMaxRetries = 30
+const tlsEndpointTimeBetweenRetries = 10 * time.Second
+
+// The names the TLS cert baked into the AMIs must be valid for, so clients on the Vault nodes can talk to Vault
+var requiredTlsCertNames = []string{"vault.service.consul", "127.0.0.1"}
+
+// Dial the API port of each node in the given cluster, as well as the ELB and its Route 53 name if the example has
+// them, and check that each endpoint serves a cert that's trusted by the CA of the given TLS cert. The API ports must
+// also serve a cert that's valid for the names clients on the nodes use and, if the TLS cert was signed by an
+// intermediate CA, that intermediate, as clients only trust the root CA. The ELB passes TCP through to the API port, so
+// the ELB and its Route 53 name must serve the same trusted cert and full chain, but the test cert doesn't include
+// their names, so which names it covers there is only reported on. No test creates the Route 53 record yet, so that
+// branch isn't covered. The cluster ports aren't checked: they're only open to the nodes themselves, and Vault serves
+// its own, internally generated certs there.
+func verifyVaultTlsEndpoints(t *testing.T, cluster vaulttest.Cluster, tlsCert TlsCert, terraformOptions *terraform.Options) []tlsverify.Result {
+	roots, err := tlsverify.LoadCAPool(tlsCert.CAPublicKeyPath)
+	require.NoError(t, err, "Couldn't load the CA of the TLS cert")
+
+	expectedNames := append([]string{}, requiredTlsCertNames...)
+
+	apiEndpoints := []tlsverify.Endpoint{}
+	elbEndpoints := []tlsverify.Endpoint{}
+
+	for _, node := range cluster.Nodes() {
+		apiEndpoints = append(apiEndpoints, tlsverify.Endpoint{
+			Name:    fmt.Sprintf("%s api", node.Hostname),
+			Address: net.JoinHostPort(node.Hostname, strconv.Itoa(vaultApiPort)),
+		})
+	}
+
+	if elbDomainName, err := terraform.OutputE(t, terraformOptions, VAULT_CLUSTER_PUBLIC_OUTPUT_ELB_DNS_NAME); err == nil && elbDomainName != "" {
+		elbEndpoints = append(elbEndpoints, tlsverify.Endpoint{
+			Name:       "elb",
+			Address:    net.JoinHostPort(elbDomainName, strconv.Itoa(vaultElbPort)),
+			ServerName: elbDomainName,
+		})
+	}
+
+	if fqdn, err := terraform.OutputE(t, terraformOptions, VAULT_CLUSTER_PUBLIC_OUTPUT_FQDN); err == nil && fqdn != "" {
+		expectedNames = append(expectedNames, fqdn)
+		elbEndpoints = append(elbEndpoints, tlsverify.Endpoint{
+			Name:       "route53",
+			Address:    net.JoinHostPort(fqdn, strconv.Itoa(vaultElbPort)),
+			ServerName: fqdn,
+		})
+	}
+
+	options := tlsverify.Options{
+		Roots:                 roots,
+		ExpectedNames:         expectedNames,
+		ExpectedIntermediates: loadTlsCertIntermediates(t, tlsCert),
+	}
+
+	results := []tlsverify.Result{}
+
+	for _, endpoint := range apiEndpoints {
+		result := tlsverify.Check(endpoint, options)
+		logger.Logf(t, "TLS endpoint %s", result)
+		results = append(results, result)
+
+		if !assert.True(t, result.Reachable(), "Couldn't complete a TLS handshake with %s: %s", endpoint.Name, result.Error) {
+			continue
+		}
+		assert.True(t, result.ChainValid, "The cert served by %s isn't trusted by the CA: %s", endpoint.Name, result.ChainError)
+		assert.Empty(t, result.MissingIntermediates, "%s doesn't serve the full chain of its cert", endpoint.Name)
+		for _, name := range requiredTlsCertNames {
+			assert.True(t, result.NameCoverage[name], "The cert served by %s isn't valid for %s", endpoint.Name, name)
+		}
+		assert.True(t, result.DaysToExpiry > 0, "The cert served by %s expires in %d days", endpoint.Name, result.DaysToExpiry)
+	}
+
+	for _, endpoint := range elbEndpoints {
+		result := checkTlsEndpointWithRetry(t, endpoint, options)
+		logger.Logf(t, "TLS endpoint %s", result)
+		results = append(results, result)
+
+		if !assert.True(t, result.Reachable(), "Couldn't complete a TLS handshake with %s: %s", endpoint.Name, result.Error) {
+			continue
+		}
+		assert.True(t, result.ChainValid, "The cert served by %s isn't trusted by the CA: %s", endpoint.Name, result.ChainError)
+		assert.Empty(t, result.MissingIntermediates, "%s doesn't serve the full chain of its cert", endpoint.Name)
+		assert.True(t, result.DaysToExpiry > 0, "The cert served by %s expires in %d days", endpoint.Name, result.DaysToExpiry)
+	}
+
+	return results
+}
+
+// Check the given endpoint until the TLS handshake succeeds, as the ELB only forwards to nodes once they pass its health
+// check, and a new Route 53 record may not resolve yet. The last result is returned either way.
+func checkTlsEndpointWithRetry(t *testing.T, endpoint tlsverify.Endpoint, options tlsverify.Options) tlsverify.Result {
+	var result tlsverify.Result
+	description := fmt.Sprintf("Completing a TLS handshake with %s", endpoint.Name)
+
+	retry.DoWithRetryE(t, description, tlsEndpointMaxRetries, tlsEndpointTimeBetweenRetries, func() (string, error) {
+		result = tlsverify.Check(endpoint, options)
+		if !result.Reachable() {
+			return "", errors.New(result.Error)
+		}
+		return "", nil
+	})
+
+	return result
+}
+
+// Load the intermediate CA certs in the chain file of the given TLS cert: everything after the TLS cert itself
+func loadTlsCertIntermediates(t *testing.T, tlsCert TlsCert) []*x509.Certificate {
+	if tlsCert.ChainPath == "" {
+		return nil
+	}
+
+	chainPEM, err := ioutil.ReadFile(tlsCert.ChainPath)
+	require.NoError(t, err, "Couldn't read the chain of the TLS cert")
+
+	certs, err := tlscert.ParseCertsPEM(chainPEM)
+	require.NoError(t, err, "Couldn't parse the chain of the TLS cert")
+
+	return certs[1:]
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlsverify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The TLS cert baked into the AMIs is signed by an intermediate CA, so the API endpoints are checked for the full
+// chain. Serve it the way the Packer template installs it, with the chain file as the cert, and without the chain.
+func TestAmiTlsCertChainIsVerified(t *testing.T) {
+	t.Parallel()
+
+	tlsCert := generateTlsCert(t, amiTlsCertOptions())
+	defer cleanupTlsCertFiles(tlsCert)
+
+	intermediates := loadTlsCertIntermediates(t, tlsCert)
+	require.Len(t, intermediates, 1)
+	assert.Equal(t, intermediateCACommonName(1), intermediates[0].Subject.CommonName)
+
+	roots, err := tlsverify.LoadCAPool(tlsCert.CAPublicKeyPath)
+	require.NoError(t, err)
+	options := tlsverify.Options{Roots: roots, ExpectedNames: requiredTlsCertNames, ExpectedIntermediates: intermediates}
+
+	testCases := []struct {
+		name                 string
+		certPath             string
+		expectedChainValid   bool
+		expectedMissingCount int
+	}{
+		{"Chain", tlsCert.ChainPath, true, 0},
+		{"CertOnly", tlsCert.PublicKeyPath, false, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			keyPair, err := tls.LoadX509KeyPair(testCase.certPath, tlsCert.PrivateKeyPath)
+			require.NoError(t, err)
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{keyPair}}
+			server.StartTLS()
+			defer server.Close()
+
+			endpoint := tlsverify.Endpoint{Name: testCase.name, Address: strings.TrimPrefix(server.URL, "https://"), ServerName: "vault.service.consul"}
+			result := tlsverify.Check(endpoint, options)
+			require.True(t, result.Reachable(), result.Error)
+			assert.Equal(t, testCase.expectedChainValid, result.ChainValid, result.ChainError)
+			assert.Len(t, result.MissingIntermediates, testCase.expectedMissingCount)
+		})
+	}
+}
@@ -1,20 +1,65 @@
 package test
 
 import (
-	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/gruntwork-io/terratest/modules/test-structure"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os/user"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/test-structure"
 )
 
 type TlsCert struct {
 	CAPublicKeyPath string
 	PublicKeyPath   string
 	PrivateKeyPath  string
+	// Only set for certs generated in Go. The private-tls-cert module doesn't write out the CA private key.
+	CAPrivateKeyPath string
+	// The TLS cert followed by the intermediate CA certs that signed it, which is what Vault should serve. The same
+	// cert as PublicKeyPath if there are no intermediate CAs.
+	ChainPath string
+}
+
+// TlsCertOptions configure the self-signed TLS cert generated for Vault
+type TlsCertOptions struct {
+	DNSNames       []string
+	IPAddresses    []string
+	ValidityPeriod time.Duration
+	KeyAlgorithm   tlscert.KeyAlgorithm
+	// The number of intermediate CAs between the root CA and the TLS cert. The intermediates are written to the chain
+	// file after the TLS cert, so Vault serves the full chain.
+	IntermediateCAs int
+}
+
+// The default options for the TLS certs the tests generate, matching what the private-tls-cert module is used with in
+// the vault-consul-ami example
+var DefaultTlsCertOptions = TlsCertOptions{
+	DNSNames:       []string{"vault.service.consul"},
+	IPAddresses:    []string{"127.0.0.1"},
+	ValidityPeriod: 1000 * time.Hour,
+	KeyAlgorithm:   tlscert.RSA,
+}
+
+// The options used for the TLS cert baked into the AMIs: the default options, with the TLS cert signed by an
+// intermediate CA, so the tests of the examples check that Vault serves the full chain
+func amiTlsCertOptions() TlsCertOptions {
+	options := DefaultTlsCertOptions
+	options.IntermediateCAs = 1
+	return options
 }
 
+const TLS_CERT_ORGANIZATION_NAME = "Gruntwork"
+const TLS_CERT_CA_COMMON_NAME = "Vault Module Test CA"
+const TLS_CERT_COMMON_NAME = "Vault Module Test"
+
+// The permissions the private-tls-cert module gives the files it writes by default
+const TLS_CERT_FILE_PERMISSIONS = 0600
+
 const PRIVATE_TLS_CERT_PATH = "modules/private-tls-cert"
 
 const VAR_CA_PUBLIC_KEY_FILE_PATH = "ca_public_key_file_path"
@@ -27,25 +72,135 @@ const VAR_COMMON_NAME = "common_name"
 const VAR_DNS_NAMES = "dns_names"
 const VAR_IP_ADDRESSES = "ip_addresses"
 const VAR_VALIDITY_PERIOD_HOURS = "validity_period_hours"
+const VAR_PRIVATE_KEY_ALGORITHM = "private_key_algorithm"
+const VAR_INTERMEDIATE_CA_COMMON_NAME = "intermediate_ca_common_name"
+const VAR_CHAIN_FILE_PATH = "chain_file_path"
+
+// Load the CA that signed the given TLS cert, so more certs can be issued from it. This only works for certs generated
+// in Go, as the private-tls-cert module doesn't write out the CA private key.
+func loadTlsCertCA(t *testing.T, tlsCert TlsCert) *tlscert.CA {
+	if tlsCert.CAPrivateKeyPath == "" {
+		t.Fatalf("Can't issue certs from the CA of %s: its private key wasn't saved", tlsCert.PublicKeyPath)
+	}
 
-// Use the private-tls-cert module to generate a self-signed TLS certificate
+	ca, err := tlscert.LoadCA(tlsCert.CAPublicKeyPath, tlsCert.CAPrivateKeyPath)
+	if err != nil {
+		t.Fatalf("Couldn't load the CA of %s: %v", tlsCert.PublicKeyPath, err)
+	}
+	return ca
+}
+
+// Generate a self-signed TLS certificate with the default options
 func generateSelfSignedTlsCert(t *testing.T) TlsCert {
-	currentUser, err := user.Current()
+	return generateTlsCert(t, DefaultTlsCertOptions)
+}
+
+// Generate a self-signed TLS certificate with the given options. This creates the same files as the private-tls-cert
+// module, without having to run Terraform.
+func generateTlsCert(t *testing.T, options TlsCertOptions) TlsCert {
+	tlsCert, err := generateTlsCertE(options)
 	if err != nil {
-		t.Fatalf("Couldn't get current OS user: %v", err)
+		t.Fatalf("Couldn't generate TLS cert: %v", err)
 	}
+	return tlsCert
+}
 
-	caPublicKeyFilePath, err := ioutil.TempFile("", "ca-public-key")
+// Generate a self-signed TLS certificate with the given options. This creates the same files as the private-tls-cert
+// module, without having to run Terraform.
+func generateTlsCertE(options TlsCertOptions) (TlsCert, error) {
+	ca, err := tlscert.NewRootCA(tlscert.CAOptions{
+		CommonName:   TLS_CERT_CA_COMMON_NAME,
+		Organization: TLS_CERT_ORGANIZATION_NAME,
+		Validity:     options.ValidityPeriod,
+		Key:          tlscert.KeyOptions{Algorithm: options.KeyAlgorithm},
+	})
 	if err != nil {
-		t.Fatalf("Couldn't create temp file: %v", err)
+		return TlsCert{}, err
+	}
+
+	issuer := ca
+	for i := 1; i <= options.IntermediateCAs; i++ {
+		issuer, err = issuer.NewIntermediateCA(tlscert.CAOptions{
+			CommonName:   intermediateCACommonName(i),
+			Organization: TLS_CERT_ORGANIZATION_NAME,
+			Validity:     options.ValidityPeriod,
+			Key:          tlscert.KeyOptions{Algorithm: options.KeyAlgorithm},
+		})
+		if err != nil {
+			return TlsCert{}, err
+		}
 	}
 
-	publicKeyFilePath, err := ioutil.TempFile("", "tls-public-key")
+	ipAddresses := []net.IP{}
+	for _, ipAddress := range options.IPAddresses {
+		parsed := net.ParseIP(ipAddress)
+		if parsed == nil {
+			return TlsCert{}, fmt.Errorf("invalid IP address %q", ipAddress)
+		}
+		ipAddresses = append(ipAddresses, parsed)
+	}
+
+	cert, err := issuer.IssueCert(tlscert.CertOptions{
+		CommonName:   TLS_CERT_COMMON_NAME,
+		Organization: TLS_CERT_ORGANIZATION_NAME,
+		DNSNames:     options.DNSNames,
+		IPAddresses:  ipAddresses,
+		Validity:     options.ValidityPeriod,
+		Key:          tlscert.KeyOptions{Algorithm: options.KeyAlgorithm},
+	})
 	if err != nil {
-		t.Fatalf("Couldn't create temp file: %v", err)
+		return TlsCert{}, err
+	}
+
+	tlsCert, err := createTlsCertTempFiles()
+	if err != nil {
+		return tlsCert, err
+	}
+
+	if err := ca.WriteFile(tlsCert.CAPublicKeyPath, TLS_CERT_FILE_PERMISSIONS); err != nil {
+		return tlsCert, err
 	}
 
-	privateKeyFilePath, err := ioutil.TempFile("", "tls-private-key")
+	caPrivateKeyFile, err := ioutil.TempFile("", "ca-private-key")
+	if err != nil {
+		return tlsCert, err
+	}
+	caPrivateKeyFile.Close()
+	tlsCert.CAPrivateKeyPath = caPrivateKeyFile.Name()
+
+	if err := ca.WriteKeyFile(tlsCert.CAPrivateKeyPath, TLS_CERT_FILE_PERMISSIONS); err != nil {
+		return tlsCert, err
+	}
+
+	if err := cert.WriteFiles(tlsCert.ChainPath, tlsCert.PrivateKeyPath, TLS_CERT_FILE_PERMISSIONS); err != nil {
+		return tlsCert, err
+	}
+
+	if err := cert.WriteCertFile(tlsCert.PublicKeyPath, TLS_CERT_FILE_PERMISSIONS); err != nil {
+		return tlsCert, err
+	}
+
+	return tlsCert, nil
+}
+
+// The common name of the given intermediate CA, counting from the one signed by the root CA
+func intermediateCACommonName(index int) string {
+	return fmt.Sprintf("%s Intermediate %d", TLS_CERT_CA_COMMON_NAME, index)
+}
+
+// Use the private-tls-cert module to generate a self-signed TLS certificate with the given options. The module
+// supports at most one intermediate CA.
+func generateTlsCertWithTerraform(t *testing.T, options TlsCertOptions) TlsCert {
+	if options.IntermediateCAs > 1 {
+		t.Fatalf("The private-tls-cert module supports at most one intermediate CA, but %d were requested", options.IntermediateCAs)
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("Couldn't get current OS user: %v", err)
+	}
+
+	tlsCert, err := createTlsCertTempFiles()
 	if err != nil {
 		t.Fatalf("Couldn't create temp file: %v", err)
 	}
@@ -55,32 +210,54 @@ func generateSelfSignedTlsCert(t *testing.T) TlsCert {
 	terraformOptions := &terraform.Options{
 		TerraformDir: examplesDir,
 		Vars: map[string]interface{}{
-			VAR_CA_PUBLIC_KEY_FILE_PATH: caPublicKeyFilePath.Name(),
-			VAR_PUBLIC_KEY_FILE_PATH:    publicKeyFilePath.Name(),
-			VAR_PRIVATE_KEY_FILE_PATH:   privateKeyFilePath.Name(),
+			VAR_CA_PUBLIC_KEY_FILE_PATH: tlsCert.CAPublicKeyPath,
+			VAR_PUBLIC_KEY_FILE_PATH:    tlsCert.PublicKeyPath,
+			VAR_PRIVATE_KEY_FILE_PATH:   tlsCert.PrivateKeyPath,
 			VAR_OWNER:                   currentUser.Username,
-			VAR_ORGANIZATION_NAME:       "Gruntwork",
-			VAR_CA_COMMON_NAME:          "Vault Module Test CA",
-			VAR_COMMON_NAME:             "Vault Module Test",
-			VAR_DNS_NAMES:               []string{"vault.service.consul"},
-			VAR_IP_ADDRESSES:            []string{"127.0.0.1"},
-			VAR_VALIDITY_PERIOD_HOURS:   1000,
+			VAR_ORGANIZATION_NAME:       TLS_CERT_ORGANIZATION_NAME,
+			VAR_CA_COMMON_NAME:          TLS_CERT_CA_COMMON_NAME,
+			VAR_COMMON_NAME:             TLS_CERT_COMMON_NAME,
+			VAR_DNS_NAMES:               options.DNSNames,
+			VAR_IP_ADDRESSES:            options.IPAddresses,
+			VAR_VALIDITY_PERIOD_HOURS:   int(options.ValidityPeriod.Hours()),
+			VAR_PRIVATE_KEY_ALGORITHM:   string(options.KeyAlgorithm),
+			VAR_CHAIN_FILE_PATH:         tlsCert.ChainPath,
 		},
 	}
 
+	if options.IntermediateCAs == 1 {
+		terraformOptions.Vars[VAR_INTERMEDIATE_CA_COMMON_NAME] = intermediateCACommonName(1)
+	}
+
 	defer terraform.Destroy(t, terraformOptions)
 
 	terraform.InitAndApply(t, terraformOptions)
 
-	assertFileNotEmpty(t, caPublicKeyFilePath.Name())
-	assertFileNotEmpty(t, publicKeyFilePath.Name())
-	assertFileNotEmpty(t, privateKeyFilePath.Name())
+	assertFileNotEmpty(t, tlsCert.CAPublicKeyPath)
+	assertFileNotEmpty(t, tlsCert.PublicKeyPath)
+	assertFileNotEmpty(t, tlsCert.PrivateKeyPath)
+	assertFileNotEmpty(t, tlsCert.ChainPath)
 
-	return TlsCert{
-		CAPublicKeyPath: caPublicKeyFilePath.Name(),
-		PublicKeyPath:   publicKeyFilePath.Name(),
-		PrivateKeyPath:  privateKeyFilePath.Name(),
+	return tlsCert
+}
+
+func createTlsCertTempFiles() (TlsCert, error) {
+	paths := map[string]string{}
+	for _, prefix := range []string{"ca-public-key", "tls-public-key", "tls-private-key", "tls-chain"} {
+		file, err := ioutil.TempFile("", prefix)
+		if err != nil {
+			return TlsCert{}, err
+		}
+		file.Close()
+		paths[prefix] = file.Name()
 	}
+
+	return TlsCert{
+		CAPublicKeyPath: paths["ca-public-key"],
+		PublicKeyPath:   paths["tls-public-key"],
+		PrivateKeyPath:  paths["tls-private-key"],
+		ChainPath:       paths["tls-chain"],
+	}, nil
 }
 
 // This is an attempt to catch a strange issue where the private-tls-cert module seems to occasionally create a private
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The parts of a TLS cert's files that matter to Vault and its clients. Everything random, such as keys, serial numbers
+// and timestamps, is left out so certs generated separately can be compared.
+type tlsCertDescription struct {
+	CA             certDescription
+	Cert           certDescription
+	Chain          []certDescription
+	PrivateKeyType string
+	Permissions    []os.FileMode
+}
+
+type certDescription struct {
+	Subject               string
+	Issuer                string
+	DNSNames              []string
+	IPAddresses           []string
+	KeyUsage              x509.KeyUsage
+	ExtKeyUsage           []x509.ExtKeyUsage
+	IsCA                  bool
+	BasicConstraintsValid bool
+	PublicKeyAlgorithm    x509.PublicKeyAlgorithm
+	Validity              time.Duration
+}
+
+func TestGenerateTlsCert(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		options TlsCertOptions
+	}{
+		{"Default", DefaultTlsCertOptions},
+		{"ECDSAWithIntermediates", TlsCertOptions{
+			DNSNames:        []string{"vault.service.consul", "vault.example.com"},
+			IPAddresses:     []string{"127.0.0.1", "10.0.0.10"},
+			ValidityPeriod:  24 * time.Hour,
+			KeyAlgorithm:    tlscert.ECDSA,
+			IntermediateCAs: 2,
+		}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			tlsCert := generateTlsCert(t, testCase.options)
+			defer cleanupTlsCertFiles(tlsCert)
+
+			description := describeTlsCert(t, tlsCert)
+			assert.Len(t, description.Chain, testCase.options.IntermediateCAs)
+			assert.Equal(t, testCase.options.DNSNames, description.Cert.DNSNames)
+			assert.Equal(t, testCase.options.IPAddresses, description.Cert.IPAddresses)
+			assert.Equal(t, testCase.options.ValidityPeriod, description.Cert.Validity)
+			assert.Equal(t, []os.FileMode{TLS_CERT_FILE_PERMISSIONS, TLS_CERT_FILE_PERMISSIONS, TLS_CERT_FILE_PERMISSIONS, TLS_CERT_FILE_PERMISSIONS}, description.Permissions)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(readCerts(t, tlsCert.CAPublicKeyPath)[0])
+
+			certs := readCerts(t, tlsCert.ChainPath)
+			intermediates := x509.NewCertPool()
+			for _, intermediate := range certs[1:] {
+				intermediates.AddCert(intermediate)
+			}
+
+			for _, name := range append(testCase.options.DNSNames, testCase.options.IPAddresses...) {
+				_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: name})
+				assert.NoError(t, err, "Expected cert to be valid for %s", name)
+			}
+		})
+	}
+}
+
+// Check that the Go cert factory creates the same files as the private-tls-cert module. This runs Terraform, so it's
+// skipped in short mode.
+func TestGenerateTlsCertMatchesPrivateTlsCertModule(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("Skipping the private-tls-cert parity test, which runs Terraform, in short mode")
+	}
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("Skipping the private-tls-cert parity test, as terraform is not installed")
+	}
+
+	testCases := []struct {
+		name            string
+		keyAlgorithm    tlscert.KeyAlgorithm
+		intermediateCAs int
+	}{
+		{"RSA", tlscert.RSA, 0},
+		{"ECDSA", tlscert.ECDSA, 0},
+		{"RSAWithIntermediate", tlscert.RSA, 1},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := DefaultTlsCertOptions
+			options.KeyAlgorithm = testCase.keyAlgorithm
+			options.IntermediateCAs = testCase.intermediateCAs
+
+			expected := generateTlsCertWithTerraform(t, options)
+			defer cleanupTlsCertFiles(expected)
+
+			actual := generateTlsCert(t, options)
+			defer cleanupTlsCertFiles(actual)
+
+			assert.Equal(t, describeTlsCert(t, expected), describeTlsCert(t, actual))
+		})
+	}
+}
+
+// Describe the given TLS cert files. The public key file must contain just the TLS cert, and the chain file the same
+// cert followed by its intermediate CAs.
+func describeTlsCert(t *testing.T, tlsCert TlsCert) tlsCertDescription {
+	certs := readCerts(t, tlsCert.PublicKeyPath)
+	require.Len(t, certs, 1, "Expected %s to contain just the TLS cert", tlsCert.PublicKeyPath)
+
+	chainCerts := readCerts(t, tlsCert.ChainPath)
+	require.Equal(t, certs[0].Raw, chainCerts[0].Raw, "Expected %s to start with the TLS cert", tlsCert.ChainPath)
+
+	chain := []certDescription{}
+	for _, intermediate := range chainCerts[1:] {
+		chain = append(chain, describeCert(intermediate))
+	}
+
+	privateKey, err := ioutil.ReadFile(tlsCert.PrivateKeyPath)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(privateKey)
+	require.NotNil(t, block, "No PEM block found in %s", tlsCert.PrivateKeyPath)
+
+	permissions := []os.FileMode{}
+	for _, path := range []string{tlsCert.CAPublicKeyPath, tlsCert.PublicKeyPath, tlsCert.PrivateKeyPath, tlsCert.ChainPath} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		permissions = append(permissions, info.Mode().Perm())
+	}
+
+	return tlsCertDescription{
+		CA:             describeCert(readCerts(t, tlsCert.CAPublicKeyPath)[0]),
+		Cert:           describeCert(certs[0]),
+		Chain:          chain,
+		PrivateKeyType: block.Type,
+		Permissions:    permissions,
+	}
+}
+
+func describeCert(cert *x509.Certificate) certDescription {
+	ipAddresses := []string{}
+	for _, ipAddress := range cert.IPAddresses {
+		ipAddresses = append(ipAddresses, ipAddress.String())
+	}
+
+	return certDescription{
+		Subject:               cert.Subject.String(),
+		Issuer:                cert.Issuer.String(),
+		DNSNames:              cert.DNSNames,
+		IPAddresses:           ipAddresses,
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		IsCA:                  cert.IsCA,
+		BasicConstraintsValid: cert.BasicConstraintsValid,
+		PublicKeyAlgorithm:    cert.PublicKeyAlgorithm,
+		Validity:              cert.NotAfter.Sub(cert.NotBefore).Round(time.Hour),
+	}
+}
+
+// Read all the certs in the PEM file at the given path
+func readCerts(t *testing.T, path string) []*x509.Certificate {
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	certs, err := tlscert.ParseCertsPEM(contents)
+	require.NoError(t, err, "Couldn't read certs from %s", path)
+	return certs
+}
@@ -0,0 +1,364 @@
+package test
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const vaultTlsCertFilePath = "/opt/vault/tls/vault.crt.pem"
+const vaultTlsKeyFilePath = "/opt/vault/tls/vault.key.pem"
+const vaultTlsCaCertFilePath = "/opt/vault/tls/ca.crt.pem"
+
+// Where the availability probe on each node writes its samples, one "<unix time> <HTTP status>" line per request
+const availabilityProbeLogPath = "/tmp/vault-availability-probe.log"
+const availabilityProbePidPath = "/tmp/vault-availability-probe.pid"
+const availabilityProbeInterval = 200 * time.Millisecond
+
+// How long to keep probing after the new cert is served everywhere, to catch anything the reload breaks late
+const availabilityProbeCooldown = 10 * time.Second
+
+// The curl write-out for a request that didn't get an HTTP response at all, e.g. because of a TLS error
+const availabilityProbeNoResponse = 0
+
+// AvailabilitySample is a single health check made by the availability probe
+type AvailabilitySample struct {
+	Time       time.Time
+	StatusCode int
+}
+
+// AvailabilityReport summarizes the health checks the availability probe made against one Vault node
+type AvailabilityReport struct {
+	Host          string
+	Samples       int
+	StatusCodes   map[int]int
+	Available     int
+	LongestOutage time.Duration
+}
+
+// Percentage of the health checks that got a response from an unsealed node
+func (report AvailabilityReport) AvailabilityPercent() float64 {
+	if report.Samples == 0 {
+		return 0
+	}
+	return 100 * float64(report.Available) / float64(report.Samples)
+}
+
+func (report AvailabilityReport) String() string {
+	statusCodes := []string{}
+	for _, statusCode := range sortedStatusCodes(report.StatusCodes) {
+		statusCodes = append(statusCodes, fmt.Sprintf("%d: %d", statusCode, report.StatusCodes[statusCode]))
+	}
+	return fmt.Sprintf("%s: %.2f%% available over %d health checks, longest outage %s, status codes {%s}", report.Host, report.AvailabilityPercent(), report.Samples, report.LongestOutage, strings.Join(statusCodes, ", "))
+}
+
+// How far apart the clocks of the test runner and the Vault nodes may be. The availability probe timestamps its
+// samples with the clock of the node, while the reload windows are timed with the clock of the test runner.
+const availabilityProbeClockSkew = 2 * time.Second
+
+// The time between starting to install the new cert on a node and that node serving it, during which the node may not
+// respond to the availability probe
+type reloadWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Whether the given time is in the window, allowing for the clocks of the test runner and the node being apart
+func (window reloadWindow) Contains(when time.Time) bool {
+	return !when.Before(window.Start.Add(-availabilityProbeClockSkew)) && !when.After(window.End.Add(availabilityProbeClockSkew))
+}
+
+// Rotate the TLS cert of each node in the given cluster while it's serving traffic:
+//
+// 1. Issue a new cert for the same names, signed with the key of the CA of the given TLS cert
+// 2. Start an availability probe on each node that checks the health endpoint several times per second
+// 3. One node at a time, copy the new cert to the node, have Vault reload it by sending it a SIGHUP (systemctl
+//    reload), and wait until the node serves the new cert with a chain its clients trust
+// 4. Check that no node was sealed, the leader stayed the leader the whole time, and that a node only failed to respond
+//    while it was reloading its own cert
+//
+// The clients on the nodes, including the availability probe, only trust the CA, so a node that serves a cert the CA
+// didn't sign stops responding to the probe after the reload and fails the test.
+//
+// Returns the availability of each node during the swap.
+func rotateTlsCert(t *testing.T, cluster vaulttest.Cluster, tlsCert TlsCert) []AvailabilityReport {
+	newCert := issueTlsCertFromSameCA(t, tlsCert)
+	logger.Logf(t, "Rotating the TLS cert of the Vault cluster to the cert with serial %X, issued by %s", newCert.Cert.SerialNumber, newCert.Cert.Issuer.CommonName)
+
+	for _, node := range cluster.Nodes() {
+		startAvailabilityProbe(t, node)
+	}
+
+	reloadWindows := map[string]reloadWindow{}
+	for _, node := range cluster.Nodes() {
+		window := reloadWindow{Start: time.Now()}
+		installTlsCert(t, node, newCert)
+		reloadVault(t, node)
+		waitForTlsCertSerial(t, node, newCert.Cert.SerialNumber)
+		window.End = time.Now()
+		reloadWindows[node.Hostname] = window
+	}
+
+	time.Sleep(availabilityProbeCooldown)
+
+	reports := []AvailabilityReport{}
+	for _, node := range cluster.Nodes() {
+		samples := stopAvailabilityProbe(t, node)
+		report := summarizeAvailability(node.Hostname, samples)
+		logger.Logf(t, "Availability during TLS cert rotation: %s", report)
+		reports = append(reports, report)
+
+		assert.NotContains(t, report.StatusCodes, int(vaulttest.Sealed), "Vault node %s was sealed during the TLS cert rotation", node.Hostname)
+		if node.Hostname == cluster.Leader.Hostname {
+			assertOnlyStatusCodes(t, samples, []int{int(vaulttest.Leader)}, reloadWindows[node.Hostname], "The leader %s lost leadership or stopped responding outside of its reload during the TLS cert rotation", node.Hostname)
+		} else {
+			assertOnlyStatusCodes(t, samples, []int{int(vaulttest.Standby), int(vaulttest.PerformanceStandby)}, reloadWindows[node.Hostname], "The standby %s became leader or stopped responding outside of its reload during the TLS cert rotation", node.Hostname)
+		}
+	}
+
+	vaulttest.AssertStatus(t, cluster.Leader, vaulttest.Leader)
+
+	return reports
+}
+
+// Load the CA of the given TLS cert from its cert and private key, and use it to issue a new cert for the same names,
+// with a new key and serial number
+func issueTlsCertFromSameCA(t *testing.T, tlsCert TlsCert) *tlscert.Cert {
+	ca := loadTlsCertCA(t, tlsCert)
+
+	ipAddresses := []net.IP{}
+	for _, ipAddress := range DefaultTlsCertOptions.IPAddresses {
+		ipAddresses = append(ipAddresses, net.ParseIP(ipAddress))
+	}
+
+	cert, err := ca.IssueCert(tlscert.CertOptions{
+		CommonName:   TLS_CERT_COMMON_NAME,
+		Organization: TLS_CERT_ORGANIZATION_NAME,
+		DNSNames:     DefaultTlsCertOptions.DNSNames,
+		IPAddresses:  ipAddresses,
+		Validity:     DefaultTlsCertOptions.ValidityPeriod,
+		Key:          tlscert.KeyOptions{Algorithm: DefaultTlsCertOptions.KeyAlgorithm},
+	})
+	require.NoError(t, err, "Couldn't issue a new TLS cert")
+
+	return cert
+}
+
+// Copy the given cert and its private key to the given Vault node, with the same owner and permissions the Packer
+// template gives the original files. Each file is moved into place so Vault never sees a partially written file.
+func installTlsCert(t *testing.T, host ssh.Host, cert *tlscert.Cert) {
+	keyPEM, err := tlscert.EncodeKeyPEM(cert.Key)
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		vaultTlsCertFilePath: cert.ChainPEM(),
+		vaultTlsKeyFilePath:  keyPEM,
+	}
+
+	for destination, contents := range files {
+		uploadPath := fmt.Sprintf("/tmp/%s", strings.Replace(strings.TrimPrefix(destination, "/"), "/", "-", -1))
+		description := fmt.Sprintf("Copying new TLS file %s to host %s", destination, host.Hostname)
+
+		retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+			if err := ssh.ScpFileToE(t, host, 0600, uploadPath, string(contents)); err != nil {
+				return "", err
+			}
+			return ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo install -o vault -g vault -m 600 %s %s.new && sudo mv %s.new %s && rm -f %s", uploadPath, destination, destination, destination, uploadPath))
+		})
+	}
+}
+
+// Have Vault reload its config and TLS certs. The systemd unit run-vault generates sends Vault a SIGHUP on reload.
+func reloadVault(t *testing.T, host ssh.Host) {
+	description := fmt.Sprintf("Reloading vault on host %s", host.Hostname)
+	retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, host, "sudo systemctl reload vault.service")
+	})
+}
+
+// Wait until the given Vault node serves the cert with the given serial number on its API port, along with the chain
+// the clients on the node need to trust it. openssl fails the handshake if the chain doesn't lead to the CA cert the
+// Packer template installs.
+func waitForTlsCertSerial(t *testing.T, host ssh.Host, expectedSerial *big.Int) {
+	command := fmt.Sprintf("echo | openssl s_client -connect 127.0.0.1:8200 -servername vault.service.consul -CAfile %s -verify_return_error 2>/dev/null | openssl x509 -noout -serial", vaultTlsCaCertFilePath)
+	description := fmt.Sprintf("Waiting for Vault on host %s to serve the TLS cert with serial %X and a trusted chain", host.Hostname, expectedSerial)
+
+	retry.DoWithRetry(t, description, 30, 2*time.Second, func() (string, error) {
+		output, err := ssh.CheckSshCommandE(t, host, command)
+		if err != nil {
+			return "", err
+		}
+
+		serial, err := parseOpenSslSerial(output)
+		if err != nil {
+			return "", err
+		}
+
+		if serial.Cmp(expectedSerial) != 0 {
+			return "", fmt.Errorf("Vault on host %s still serves the TLS cert with serial %X", host.Hostname, serial)
+		}
+		return "", nil
+	})
+}
+
+// Parse the output of 'openssl x509 -noout -serial', which looks like: serial=0A1B2C...
+func parseOpenSslSerial(output string) (*big.Int, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(output), "serial=")
+	serial, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected output from openssl x509 -serial: %q", output)
+	}
+	return serial, nil
+}
+
+// Start checking the health endpoint of the given Vault node in the background, several times per second. The checks
+// run on the node itself, so SSH latency doesn't hide short outages.
+func startAvailabilityProbe(t *testing.T, host ssh.Host) {
+	probe := fmt.Sprintf(`while true; do echo "$(date +%%s.%%N) $(curl -s -o /dev/null -w %%{http_code} https://127.0.0.1:8200/v1/sys/health)"; sleep %.1f; done`, availabilityProbeInterval.Seconds())
+	command := fmt.Sprintf("nohup bash -c '%s' > %s 2>&1 < /dev/null & echo $! > %s", probe, availabilityProbeLogPath, availabilityProbePidPath)
+
+	description := fmt.Sprintf("Starting availability probe on host %s", host.Hostname)
+	retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, host, command)
+	})
+}
+
+// Stop the availability probe on the given Vault node and return the health checks it made
+func stopAvailabilityProbe(t *testing.T, host ssh.Host) []AvailabilitySample {
+	command := fmt.Sprintf("kill $(cat %s) && cat %s && rm -f %s %s", availabilityProbePidPath, availabilityProbeLogPath, availabilityProbePidPath, availabilityProbeLogPath)
+
+	description := fmt.Sprintf("Stopping availability probe on host %s", host.Hostname)
+	output := retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, host, command)
+	})
+
+	samples, err := parseAvailabilitySamples(output)
+	require.NoError(t, err, "Couldn't parse the output of the availability probe on host %s", host.Hostname)
+	require.NotEmpty(t, samples, "The availability probe on host %s didn't make any health checks", host.Hostname)
+
+	return samples
+}
+
+// Parse the "<unix time> <HTTP status>" lines written by the availability probe
+func parseAvailabilitySamples(output string) ([]AvailabilitySample, error) {
+	samples := []AvailabilitySample{}
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Unexpected availability probe line: %q", line)
+		}
+
+		seconds, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected timestamp in availability probe line %q: %v", line, err)
+		}
+
+		statusCode, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected status code in availability probe line %q: %v", line, err)
+		}
+
+		samples = append(samples, AvailabilitySample{
+			Time:       time.Unix(0, int64(seconds*float64(time.Second))),
+			StatusCode: statusCode,
+		})
+	}
+
+	return samples, nil
+}
+
+// Summarize the given health checks of a Vault node. A node counts as available if it responds as an unsealed leader or
+// standby. An outage lasts from the first failed health check until the next successful one.
+func summarizeAvailability(host string, samples []AvailabilitySample) AvailabilityReport {
+	report := AvailabilityReport{Host: host, Samples: len(samples), StatusCodes: map[int]int{}}
+
+	var outageStart *time.Time
+	for i := range samples {
+		sample := samples[i]
+		report.StatusCodes[sample.StatusCode]++
+
+		if isAvailableStatus(sample.StatusCode) {
+			report.Available++
+			if outageStart != nil {
+				if outage := sample.Time.Sub(*outageStart); outage > report.LongestOutage {
+					report.LongestOutage = outage
+				}
+				outageStart = nil
+			}
+		} else if outageStart == nil {
+			outageStart = &samples[i].Time
+		}
+	}
+
+	if outageStart != nil && len(samples) > 0 {
+		if outage := samples[len(samples)-1].Time.Sub(*outageStart); outage > report.LongestOutage {
+			report.LongestOutage = outage
+		}
+	}
+
+	return report
+}
+
+func isAvailableStatus(statusCode int) bool {
+	return statusCode == int(vaulttest.Leader) || statusCode == int(vaulttest.Standby) || statusCode == int(vaulttest.PerformanceStandby)
+}
+
+// Check that the availability probe only saw the given status codes, or no response at all while the node was
+// reloading its cert
+func assertOnlyStatusCodes(t *testing.T, samples []AvailabilitySample, allowed []int, window reloadWindow, msgAndArgs ...interface{}) {
+	for _, sample := range unexpectedSamples(samples, allowed, window) {
+		assert.Fail(t, fmt.Sprintf("Unexpected status code %d at %s", sample.StatusCode, sample.Time.UTC().Format(time.RFC3339Nano)), msgAndArgs...)
+	}
+}
+
+// The samples with a status code that isn't in the given list. Samples without a response are only expected during the
+// given reload window.
+func unexpectedSamples(samples []AvailabilitySample, allowed []int, window reloadWindow) []AvailabilitySample {
+	unexpected := []AvailabilitySample{}
+	for _, sample := range samples {
+		if containsInt(allowed, sample.StatusCode) {
+			continue
+		}
+		if sample.StatusCode == availabilityProbeNoResponse && window.Contains(sample.Time) {
+			continue
+		}
+		unexpected = append(unexpected, sample)
+	}
+	return unexpected
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedStatusCodes(statusCodes map[int]int) []int {
+	sorted := []int{}
+	for statusCode := range statusCodes {
+		sorted = append(sorted, statusCode)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
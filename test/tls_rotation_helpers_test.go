@@ -0,0 +1,107 @@
+package test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAvailabilitySamples(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseAvailabilitySamples("1600000000.000000000 200\n1600000000.250000000 000\n\n")
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+
+	assert.Equal(t, 200, samples[0].StatusCode)
+	assert.Equal(t, 0, samples[1].StatusCode)
+	assert.Equal(t, 250*time.Millisecond, samples[1].Time.Sub(samples[0].Time).Round(time.Millisecond))
+
+	_, err = parseAvailabilitySamples("1600000000.000000000")
+	assert.Error(t, err)
+}
+
+func TestSummarizeAvailability(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1600000000, 0)
+	sample := func(offset time.Duration, statusCode int) AvailabilitySample {
+		return AvailabilitySample{Time: start.Add(offset), StatusCode: statusCode}
+	}
+
+	testCases := []struct {
+		name                  string
+		samples               []AvailabilitySample
+		expectedAvailable     int
+		expectedLongestOutage time.Duration
+	}{
+		{"AlwaysAvailable", []AvailabilitySample{sample(0, 200), sample(time.Second, 429), sample(2*time.Second, 473)}, 3, 0},
+		{"ShortOutages", []AvailabilitySample{
+			sample(0, 200),
+			sample(time.Second, 0),
+			sample(2*time.Second, 200),
+			sample(3*time.Second, 503),
+			sample(4*time.Second, 0),
+			sample(5*time.Second, 200),
+		}, 3, 2 * time.Second},
+		{"OutageUntilTheEnd", []AvailabilitySample{sample(0, 200), sample(time.Second, 0), sample(4*time.Second, 0)}, 1, 3 * time.Second},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			report := summarizeAvailability("10.0.0.10", testCase.samples)
+			assert.Equal(t, len(testCase.samples), report.Samples)
+			assert.Equal(t, testCase.expectedAvailable, report.Available)
+			assert.Equal(t, testCase.expectedLongestOutage, report.LongestOutage)
+		})
+	}
+}
+
+func TestParseOpenSslSerial(t *testing.T) {
+	t.Parallel()
+
+	serial, err := parseOpenSslSerial("serial=0A1B2C3D4E5F\n")
+	require.NoError(t, err)
+	assert.Equal(t, 0, serial.Cmp(big.NewInt(0x0A1B2C3D4E5F)))
+
+	_, err = parseOpenSslSerial("unable to load certificate")
+	assert.Error(t, err)
+}
+
+func TestUnexpectedSamples(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1600000000, 0)
+	sample := func(offset time.Duration, statusCode int) AvailabilitySample {
+		return AvailabilitySample{Time: start.Add(offset), StatusCode: statusCode}
+	}
+	window := reloadWindow{Start: start.Add(10 * time.Second), End: start.Add(20 * time.Second)}
+	allowed := []int{200}
+
+	testCases := []struct {
+		name     string
+		samples  []AvailabilitySample
+		expected []AvailabilitySample
+	}{
+		{"OnlyAllowedStatusCodes", []AvailabilitySample{sample(0, 200), sample(30*time.Second, 200)}, []AvailabilitySample{}},
+		{"NoResponseDuringReload", []AvailabilitySample{sample(10*time.Second, 0), sample(15*time.Second, 0), sample(20*time.Second, 0)}, []AvailabilitySample{}},
+		{"NoResponseWithinClockSkew", []AvailabilitySample{sample(9*time.Second, 0), sample(21*time.Second, 0)}, []AvailabilitySample{}},
+		{"NoResponseBeforeReload", []AvailabilitySample{sample(5*time.Second, 0), sample(15*time.Second, 0)}, []AvailabilitySample{sample(5*time.Second, 0)}},
+		{"NoResponseAfterReload", []AvailabilitySample{sample(15*time.Second, 0), sample(25*time.Second, 0)}, []AvailabilitySample{sample(25*time.Second, 0)}},
+		{"OtherStatusCodeDuringReload", []AvailabilitySample{sample(15*time.Second, 429)}, []AvailabilitySample{sample(15*time.Second, 429)}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, testCase.expected, unexpectedSamples(testCase.samples, allowed, window))
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// Package tlscert generates CA and TLS certificates in pure Go, with the same structure as the certs created by the
+// private-tls-cert module, so tests don't need to run Terraform just to get a cert for Vault.
+package tlscert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// KeyAlgorithm is the algorithm used for private keys. The names match the private_key_algorithm variable of the
+// private-tls-cert module.
+type KeyAlgorithm string
+
+const (
+	RSA   KeyAlgorithm = "RSA"
+	ECDSA KeyAlgorithm = "ECDSA"
+)
+
+// KeyOptions configure how private keys are generated. The zero value generates 2048 bit RSA keys, like the
+// private-tls-cert module does by default.
+type KeyOptions struct {
+	Algorithm KeyAlgorithm
+	RsaBits   int
+	// One of P224, P256, P384 or P521. Only used for ECDSA keys. Defaults to P256.
+	EcdsaCurve string
+}
+
+// CAOptions configure a root or intermediate CA
+type CAOptions struct {
+	CommonName   string
+	Organization string
+	Validity     time.Duration
+	Key          KeyOptions
+}
+
+// CertOptions configure a TLS certificate signed by a CA
+type CertOptions struct {
+	CommonName   string
+	Organization string
+	DNSNames     []string
+	IPAddresses  []net.IP
+	Validity     time.Duration
+	Key          KeyOptions
+	// Extended key usages for the cert. Leave empty to match the private-tls-cert module, which doesn't set any.
+	ExtKeyUsages []x509.ExtKeyUsage
+}
+
+// CA is a certificate authority that can sign intermediate CAs and TLS certs
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	// The intermediate CAs between this CA and the root, starting with the one that signed this CA. Empty for a root.
+	Chain []*x509.Certificate
+}
+
+// Cert is a TLS certificate and its private key
+type Cert struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	// The intermediate CAs between this cert and the root, starting with the one that signed this cert
+	Chain []*x509.Certificate
+}
+
+// The key usages the private-tls-cert module gives CA certs and TLS certs by default
+const (
+	caKeyUsage   = x509.KeyUsageCertSign | x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	certKeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+)
+
+// NewRootCA generates a self-signed root CA
+func NewRootCA(options CAOptions) (*CA, error) {
+	key, err := generateKey(options.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := caTemplate(options, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := createCertificate(template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// NewIntermediateCA generates an intermediate CA signed by this CA
+func (ca *CA) NewIntermediateCA(options CAOptions) (*CA, error) {
+	key, err := generateKey(options.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := caTemplate(options, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := createCertificate(template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Cert: cert, Key: key, Chain: ca.issuedChain()}, nil
+}
+
+// IssueCert generates a TLS cert signed by this CA
+func (ca *CA) IssueCert(options CertOptions) (*Cert, error) {
+	key, err := generateKey(options.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	subjectKeyId, err := subjectKeyId(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject(options.CommonName, options.Organization),
+		DNSNames:              options.DNSNames,
+		IPAddresses:           options.IPAddresses,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(options.Validity),
+		KeyUsage:              certKeyUsage,
+		ExtKeyUsage:           options.ExtKeyUsages,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          subjectKeyId,
+	}
+
+	cert, err := createCertificate(template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cert{Cert: cert, Key: key, Chain: ca.issuedChain()}, nil
+}
+
+// The chain to include with anything this CA signs: this CA, unless it's the root, followed by its own chain
+func (ca *CA) issuedChain() []*x509.Certificate {
+	if isSelfSigned(ca.Cert) {
+		return nil
+	}
+	return append([]*x509.Certificate{ca.Cert}, ca.Chain...)
+}
+
+// WriteFiles writes the cert, followed by its intermediate CAs, and its private key as PEM files with the given
+// permissions. The cert file has the same contents as the chain file of the private-tls-cert module.
+func (cert *Cert) WriteFiles(certPath string, keyPath string, permissions os.FileMode) error {
+	if err := writeFile(certPath, cert.ChainPEM(), permissions); err != nil {
+		return err
+	}
+
+	keyPEM, err := EncodeKeyPEM(cert.Key)
+	if err != nil {
+		return err
+	}
+	return writeFile(keyPath, keyPEM, permissions)
+}
+
+// WriteCertFile writes just the cert, without its intermediate CAs, as a PEM file with the given permissions, like the
+// public key file of the private-tls-cert module
+func (cert *Cert) WriteCertFile(certPath string, permissions os.FileMode) error {
+	return writeFile(certPath, EncodeCertsPEM(cert.Cert), permissions)
+}
+
+// ChainPEM encodes the cert, followed by its intermediate CAs, as PEM. This is the format servers such as Vault expect
+// in their TLS cert file.
+func (cert *Cert) ChainPEM() []byte {
+	return EncodeCertsPEM(append([]*x509.Certificate{cert.Cert}, cert.Chain...)...)
+}
+
+// WriteFile writes the CA cert as a PEM file with the given permissions
+func (ca *CA) WriteFile(certPath string, permissions os.FileMode) error {
+	return writeFile(certPath, EncodeCertsPEM(ca.Cert), permissions)
+}
+
+// WriteKeyFile writes the CA private key as a PEM file with the given permissions. Keep this file somewhere safe: it's
+// needed to issue new certs from this CA later, e.g. to rotate a cert.
+func (ca *CA) WriteKeyFile(keyPath string, permissions os.FileMode) error {
+	keyPEM, err := EncodeKeyPEM(ca.Key)
+	if err != nil {
+		return err
+	}
+	return writeFile(keyPath, keyPEM, permissions)
+}
+
+// LoadCA reads a CA from the given PEM files, so it can issue more certs. The cert file contains the CA cert, optionally
+// followed by its intermediate CAs.
+func LoadCA(certPath string, keyPath string) (*CA, error) {
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", certPath, err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyPath, err)
+	}
+
+	return &CA{Cert: certs[0], Key: key, Chain: certs[1:]}, nil
+}
+
+// EncodeCertsPEM encodes the given certs as concatenated PEM blocks
+func EncodeCertsPEM(certs ...*x509.Certificate) []byte {
+	encoded := []byte{}
+	for _, cert := range certs {
+		encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return encoded
+}
+
+// EncodeKeyPEM encodes the given private key in the same PEM format as the tls_private_key Terraform resource: PKCS #1
+// for RSA keys and SEC 1 for ECDSA keys
+func EncodeKeyPEM(key crypto.Signer) ([]byte, error) {
+	switch typedKey := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(typedKey)}), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(typedKey)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// ParseCertsPEM parses all the certs in the given PEM data, returning an error if there are none
+func ParseCertsPEM(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
+
+// ParseKeyPEM parses a private key in PKCS #1, SEC 1 or PKCS #8 PEM format
+func ParseKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+func caTemplate(options CAOptions, key crypto.Signer) (*x509.Certificate, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	subjectKeyId, err := subjectKeyId(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject(options.CommonName, options.Organization),
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(options.Validity),
+		KeyUsage:              caKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subjectKeyId,
+	}, nil
+}
+
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func generateKey(options KeyOptions) (crypto.Signer, error) {
+	switch options.Algorithm {
+	case RSA, "":
+		bits := options.RsaBits
+		if bits == 0 {
+			bits = 2048
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case ECDSA:
+		curve, err := ecdsaCurve(options.EcdsaCurve)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q: must be one of %s or %s", options.Algorithm, RSA, ECDSA)
+	}
+}
+
+func ecdsaCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P224":
+		return elliptic.P224(), nil
+	case "P256", "":
+		return elliptic.P256(), nil
+	case "P384":
+		return elliptic.P384(), nil
+	case "P521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve %q: must be one of P224, P256, P384 or P521", name)
+	}
+}
+
+func subject(commonName string, organization string) pkix.Name {
+	name := pkix.Name{CommonName: commonName}
+	if organization != "" {
+		name.Organization = []string{organization}
+	}
+	return name
+}
+
+// Random 128 bit serial numbers, like the tls Terraform provider uses
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// The SHA-1 hash of the marshaled public key, which is the usual way of computing the subject key ID
+func subjectKeyId(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(der)
+	return hash[:], nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(cert) == nil
+}
+
+func writeFile(path string, contents []byte, permissions os.FileMode) error {
+	if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+		return err
+	}
+	// Chmod explicitly, as WriteFile doesn't change the permissions of existing files and is subject to the umask
+	return os.Chmod(path, permissions)
+}
@@ -0,0 +1,236 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCertOptions = CertOptions{
+	CommonName:   "Vault Module Test",
+	Organization: "Gruntwork",
+	DNSNames:     []string{"vault.service.consul"},
+	IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	Validity:     time.Hour,
+}
+
+func TestIssueCertFromRootCA(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewRootCA(CAOptions{CommonName: "Vault Module Test CA", Organization: "Gruntwork", Validity: time.Hour})
+	require.NoError(t, err)
+	assert.True(t, ca.Cert.IsCA)
+	assert.Empty(t, ca.Chain)
+
+	cert, err := ca.IssueCert(testCertOptions)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"vault.service.consul"}, cert.Cert.DNSNames)
+	assert.True(t, cert.Cert.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.Equal(t, []string{"Gruntwork"}, cert.Cert.Subject.Organization)
+	assert.False(t, cert.Cert.IsCA)
+	assert.Empty(t, cert.Chain)
+	assert.IsType(t, &rsa.PrivateKey{}, cert.Key)
+	assert.Equal(t, 2048, cert.Key.(*rsa.PrivateKey).N.BitLen())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cert.Cert.NotAfter, time.Minute)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	for _, name := range []string{"vault.service.consul", "127.0.0.1"} {
+		_, err := cert.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: name})
+		assert.NoError(t, err, "Expected cert to be valid for %s", name)
+	}
+
+	_, err = cert.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "vault.example.com"})
+	assert.Error(t, err)
+}
+
+func TestIssueCertFromIntermediateCAs(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewRootCA(CAOptions{CommonName: "Root CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	first, err := root.NewIntermediateCA(CAOptions{CommonName: "First Intermediate CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	second, err := first.NewIntermediateCA(CAOptions{CommonName: "Second Intermediate CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	cert, err := second.IssueCert(testCertOptions)
+	require.NoError(t, err)
+
+	require.Len(t, cert.Chain, 2)
+	assert.Equal(t, "Second Intermediate CA", cert.Chain[0].Subject.CommonName)
+	assert.Equal(t, "First Intermediate CA", cert.Chain[1].Subject.CommonName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	_, err = cert.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "vault.service.consul"})
+	assert.Error(t, err, "Expected the cert not to be valid without its intermediates")
+
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range cert.Chain {
+		intermediates.AddCert(intermediate)
+	}
+
+	_, err = cert.Cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "vault.service.consul"})
+	assert.NoError(t, err)
+}
+
+func TestKeyAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		key             KeyOptions
+		expectedPEMType string
+		check           func(t *testing.T, cert *Cert)
+	}{
+		{"RSA4096", KeyOptions{Algorithm: RSA, RsaBits: 4096}, "RSA PRIVATE KEY", func(t *testing.T, cert *Cert) {
+			assert.Equal(t, 4096, cert.Key.(*rsa.PrivateKey).N.BitLen())
+		}},
+		{"ECDSADefaultCurve", KeyOptions{Algorithm: ECDSA}, "EC PRIVATE KEY", func(t *testing.T, cert *Cert) {
+			assert.Equal(t, elliptic.P256(), cert.Key.(*ecdsa.PrivateKey).Curve)
+		}},
+		{"ECDSAP384", KeyOptions{Algorithm: ECDSA, EcdsaCurve: "P384"}, "EC PRIVATE KEY", func(t *testing.T, cert *Cert) {
+			assert.Equal(t, elliptic.P384(), cert.Key.(*ecdsa.PrivateKey).Curve)
+		}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			ca, err := NewRootCA(CAOptions{CommonName: "Test CA", Validity: time.Hour, Key: testCase.key})
+			require.NoError(t, err)
+
+			options := testCertOptions
+			options.Key = testCase.key
+
+			cert, err := ca.IssueCert(options)
+			require.NoError(t, err)
+			testCase.check(t, cert)
+
+			keyPEM, err := EncodeKeyPEM(cert.Key)
+			require.NoError(t, err)
+
+			block, _ := pem.Decode(keyPEM)
+			require.NotNil(t, block)
+			assert.Equal(t, testCase.expectedPEMType, block.Type)
+		})
+	}
+}
+
+func TestInvalidKeyOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRootCA(CAOptions{CommonName: "Test CA", Validity: time.Hour, Key: KeyOptions{Algorithm: "DSA"}})
+	assert.EqualError(t, err, `unsupported key algorithm "DSA": must be one of RSA or ECDSA`)
+
+	_, err = NewRootCA(CAOptions{CommonName: "Test CA", Validity: time.Hour, Key: KeyOptions{Algorithm: ECDSA, EcdsaCurve: "P128"}})
+	assert.EqualError(t, err, `unsupported ECDSA curve "P128": must be one of P224, P256, P384 or P521`)
+}
+
+func TestWriteFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tlscert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root, err := NewRootCA(CAOptions{CommonName: "Root CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	intermediate, err := root.NewIntermediateCA(CAOptions{CommonName: "Intermediate CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	cert, err := intermediate.IssueCert(testCertOptions)
+	require.NoError(t, err)
+
+	caPath := filepath.Join(dir, "ca.crt.pem")
+	certPath := filepath.Join(dir, "vault.crt.pem")
+	leafPath := filepath.Join(dir, "vault-leaf.crt.pem")
+	keyPath := filepath.Join(dir, "vault.key.pem")
+
+	require.NoError(t, root.WriteFile(caPath, 0600))
+	require.NoError(t, cert.WriteFiles(certPath, keyPath, 0600))
+	require.NoError(t, cert.WriteCertFile(leafPath, 0600))
+
+	for _, path := range []string{caPath, certPath, leafPath, keyPath} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Unexpected permissions on %s", path)
+	}
+
+	certPEM, err := ioutil.ReadFile(certPath)
+	require.NoError(t, err)
+
+	leaf, rest := pem.Decode(certPEM)
+	require.NotNil(t, leaf)
+	assert.Equal(t, cert.Cert.Raw, leaf.Bytes)
+
+	chain, rest := pem.Decode(rest)
+	require.NotNil(t, chain)
+	assert.Equal(t, intermediate.Cert.Raw, chain.Bytes)
+	assert.Empty(t, rest)
+
+	leafPEM, err := ioutil.ReadFile(leafPath)
+	require.NoError(t, err)
+	assert.Equal(t, EncodeCertsPEM(cert.Cert), leafPEM)
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Key.Public(), key.Public())
+}
+
+func TestLoadCA(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tlscert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, algorithm := range []KeyAlgorithm{RSA, ECDSA} {
+		ca, err := NewRootCA(CAOptions{CommonName: "Root CA", Validity: time.Hour, Key: KeyOptions{Algorithm: algorithm}})
+		require.NoError(t, err)
+
+		certPath := filepath.Join(dir, string(algorithm)+"-ca.crt.pem")
+		keyPath := filepath.Join(dir, string(algorithm)+"-ca.key.pem")
+		require.NoError(t, ca.WriteFile(certPath, 0600))
+		require.NoError(t, ca.WriteKeyFile(keyPath, 0600))
+
+		loaded, err := LoadCA(certPath, keyPath)
+		require.NoError(t, err)
+		assert.Equal(t, ca.Cert.Raw, loaded.Cert.Raw)
+		assert.Equal(t, ca.Key.Public(), loaded.Key.Public())
+
+		// A cert issued by the loaded CA must be trusted by the original one
+		cert, err := loaded.IssueCert(testCertOptions)
+		require.NoError(t, err)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+		_, err = cert.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "vault.service.consul"})
+		assert.NoError(t, err)
+	}
+}
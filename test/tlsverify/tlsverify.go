@@ -0,0 +1,207 @@
+// Package tlsverify dials TLS endpoints, such as the API and cluster ports of the Vault nodes or the ELB in front of
+// them, and reports what they serve: whether the chain is trusted by a given CA and includes the expected intermediate
+// CAs, which of the expected names the cert covers, the negotiated TLS version and cipher, and how long until the cert
+// expires.
+package tlsverify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// Endpoint is a TLS server to dial
+type Endpoint struct {
+	// A human readable name for the endpoint, e.g. "10.0.0.10 api"
+	Name string
+	// The host:port to dial
+	Address string
+	// The name to send in SNI. Optional.
+	ServerName string
+	// The ALPN protocols to offer. Vault's cluster port only accepts connections for the protocols it knows.
+	NextProtos []string
+}
+
+// Options configure how endpoints are checked
+type Options struct {
+	// The CAs the served chain must lead to
+	Roots *x509.CertPool
+	// The DNS names and IP addresses the cert is expected to be valid for
+	ExpectedNames []string
+	// The intermediate CA certs the endpoint is expected to serve along with its own cert. Clients that only trust the
+	// root CA can't verify the cert without them.
+	ExpectedIntermediates []*x509.Certificate
+	// How long to wait for the connection and TLS handshake. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Result describes what an endpoint served. If the endpoint couldn't be dialed, only Endpoint and Error are set.
+type Result struct {
+	Endpoint    Endpoint
+	Error       string `json:",omitempty"`
+	TlsVersion  string
+	CipherSuite string
+	// The subjects of the certs the endpoint served, starting with its own cert
+	ServedChain []string
+	ChainValid  bool
+	ChainError  string `json:",omitempty"`
+	// The subjects of the expected intermediate CA certs the endpoint didn't serve
+	MissingIntermediates []string `json:",omitempty"`
+	DNSNames             []string
+	IPAddresses          []string
+	// Whether the cert is valid for each of the expected names
+	NameCoverage map[string]bool
+	NotAfter     time.Time
+	DaysToExpiry int
+}
+
+// Reachable returns true if the TLS handshake with the endpoint succeeded
+func (result Result) Reachable() bool {
+	return result.Error == ""
+}
+
+// ServesFullChain returns true if the endpoint served all the expected intermediate CA certs
+func (result Result) ServesFullChain() bool {
+	return result.Reachable() && len(result.MissingIntermediates) == 0
+}
+
+// UncoveredNames returns the expected names the cert is not valid for
+func (result Result) UncoveredNames() []string {
+	uncovered := []string{}
+	for name, covered := range result.NameCoverage {
+		if !covered {
+			uncovered = append(uncovered, name)
+		}
+	}
+	return uncovered
+}
+
+func (result Result) String() string {
+	if !result.Reachable() {
+		return fmt.Sprintf("%s (%s): %s", result.Endpoint.Name, result.Endpoint.Address, result.Error)
+	}
+
+	chain := "valid"
+	if !result.ChainValid {
+		chain = fmt.Sprintf("invalid (%s)", result.ChainError)
+	}
+
+	if len(result.MissingIntermediates) > 0 {
+		chain = fmt.Sprintf("%s, missing intermediates %v", chain, result.MissingIntermediates)
+	}
+
+	return fmt.Sprintf("%s (%s): %s %s, chain %s, names %v, expires in %d days", result.Endpoint.Name, result.Endpoint.Address, result.TlsVersion, result.CipherSuite, chain, result.NameCoverage, result.DaysToExpiry)
+}
+
+// LoadCAPool reads the CA certs in the given PEM file into a cert pool
+func LoadCAPool(caPath string) (*x509.CertPool, error) {
+	contents, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+	return pool, nil
+}
+
+// Check dials the given endpoint and describes the TLS cert and connection it serves. The handshake itself doesn't
+// verify anything, so that a cert that isn't trusted or doesn't cover the expected names is still reported on.
+func Check(endpoint Endpoint, options Options) Result {
+	result := Result{Endpoint: endpoint, NameCoverage: map[string]bool{}}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	config := &tls.Config{
+		ServerName:         endpoint.ServerName,
+		NextProtos:         endpoint.NextProtos,
+		InsecureSkipVerify: true,
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", endpoint.Address, config)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	return describeConnection(result, conn.ConnectionState(), options)
+}
+
+func describeConnection(result Result, state tls.ConnectionState, options Options) Result {
+	result.TlsVersion = tlsVersionName(state.Version)
+	result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+
+	if len(state.PeerCertificates) == 0 {
+		result.Error = "the endpoint didn't serve a certificate"
+		return result
+	}
+
+	for _, cert := range state.PeerCertificates {
+		result.ServedChain = append(result.ServedChain, cert.Subject.String())
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	for _, expected := range options.ExpectedIntermediates {
+		if !containsCert(state.PeerCertificates[1:], expected) {
+			result.MissingIntermediates = append(result.MissingIntermediates, expected.Subject.String())
+		}
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: options.Roots, Intermediates: intermediates})
+	result.ChainValid = err == nil
+	if err != nil {
+		result.ChainError = err.Error()
+	}
+
+	result.DNSNames = leaf.DNSNames
+	for _, ipAddress := range leaf.IPAddresses {
+		result.IPAddresses = append(result.IPAddresses, ipAddress.String())
+	}
+
+	for _, name := range options.ExpectedNames {
+		result.NameCoverage[name] = leaf.VerifyHostname(name) == nil
+	}
+
+	result.NotAfter = leaf.NotAfter
+	result.DaysToExpiry = int(time.Until(leaf.NotAfter).Hours() / 24)
+
+	return result
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, candidate := range certs {
+		if candidate.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("unknown (0x%04x)", version)
+	}
+}
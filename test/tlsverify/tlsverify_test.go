@@ -0,0 +1,175 @@
+package tlsverify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/tlscert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var expectedNames = []string{"vault.service.consul", "127.0.0.1", "vault.example.com"}
+
+// Start a local HTTPS server serving the given cert and its chain
+func startTlsServer(t *testing.T, cert *tlscert.Cert) *httptest.Server {
+	keyPEM, err := tlscert.EncodeKeyPEM(cert.Key)
+	require.NoError(t, err)
+
+	keyPair, err := tls.X509KeyPair(cert.ChainPEM(), keyPEM)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{keyPair}}
+	server.StartTLS()
+	return server
+}
+
+func newCertOptions(validity time.Duration) tlscert.CertOptions {
+	return tlscert.CertOptions{
+		CommonName:  "Vault Module Test",
+		DNSNames:    []string{"vault.service.consul"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		Validity:    validity,
+	}
+}
+
+func serverEndpoint(server *httptest.Server) Endpoint {
+	return Endpoint{Name: "test server", Address: strings.TrimPrefix(server.URL, "https://")}
+}
+
+func TestCheckTrustedCert(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Test CA", Validity: 90 * 24 * time.Hour})
+	require.NoError(t, err)
+
+	cert, err := ca.IssueCert(newCertOptions(30*24*time.Hour + time.Hour))
+	require.NoError(t, err)
+
+	server := startTlsServer(t, cert)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	result := Check(serverEndpoint(server), Options{Roots: roots, ExpectedNames: expectedNames})
+
+	assert.True(t, result.Reachable(), result.Error)
+	assert.True(t, result.ChainValid, result.ChainError)
+	assert.Equal(t, map[string]bool{"vault.service.consul": true, "127.0.0.1": true, "vault.example.com": false}, result.NameCoverage)
+	assert.Equal(t, []string{"vault.example.com"}, result.UncoveredNames())
+	assert.Equal(t, "TLS 1.3", result.TlsVersion)
+	assert.NotEmpty(t, result.CipherSuite)
+	assert.Equal(t, 30, result.DaysToExpiry)
+	assert.Equal(t, []string{"CN=Vault Module Test"}, result.ServedChain)
+}
+
+func TestCheckUntrustedCert(t *testing.T) {
+	t.Parallel()
+
+	ca, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Test CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	otherCA, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Other CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	cert, err := otherCA.IssueCert(newCertOptions(time.Hour))
+	require.NoError(t, err)
+
+	server := startTlsServer(t, cert)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	result := Check(serverEndpoint(server), Options{Roots: roots, ExpectedNames: expectedNames})
+
+	assert.True(t, result.Reachable(), result.Error)
+	assert.False(t, result.ChainValid)
+	assert.Contains(t, result.ChainError, "unknown authority")
+}
+
+func TestCheckServedChain(t *testing.T) {
+	t.Parallel()
+
+	root, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Root CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	intermediate, err := root.NewIntermediateCA(tlscert.CAOptions{CommonName: "Intermediate CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	cert, err := intermediate.IssueCert(newCertOptions(time.Hour))
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	server := startTlsServer(t, cert)
+	defer server.Close()
+
+	options := Options{Roots: roots, ExpectedIntermediates: []*x509.Certificate{intermediate.Cert}}
+
+	result := Check(serverEndpoint(server), options)
+	assert.True(t, result.ChainValid, result.ChainError)
+	assert.True(t, result.ServesFullChain())
+	assert.Empty(t, result.MissingIntermediates)
+	assert.Equal(t, []string{"CN=Vault Module Test", "CN=Intermediate CA"}, result.ServedChain)
+
+	// The same cert without its intermediate can't be verified
+	cert.Chain = nil
+	serverWithoutChain := startTlsServer(t, cert)
+	defer serverWithoutChain.Close()
+
+	result = Check(serverEndpoint(serverWithoutChain), options)
+	assert.False(t, result.ChainValid)
+	assert.False(t, result.ServesFullChain())
+	assert.Equal(t, []string{"CN=Intermediate CA"}, result.MissingIntermediates)
+	assert.Contains(t, result.String(), "missing intermediates [CN=Intermediate CA]")
+	assert.Equal(t, []string{"CN=Vault Module Test"}, result.ServedChain)
+}
+
+func TestCheckUnreachableEndpoint(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	result := Check(Endpoint{Name: "closed port", Address: address}, Options{Timeout: time.Second})
+	assert.False(t, result.Reachable())
+	assert.Contains(t, result.String(), "closed port")
+}
+
+func TestLoadCAPool(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tlsverify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, err := tlscert.NewRootCA(tlscert.CAOptions{CommonName: "Test CA", Validity: time.Hour})
+	require.NoError(t, err)
+
+	caPath := filepath.Join(dir, "ca.crt.pem")
+	require.NoError(t, ca.WriteFile(caPath, 0600))
+
+	_, err = LoadCAPool(caPath)
+	assert.NoError(t, err)
+
+	emptyPath := filepath.Join(dir, "empty.pem")
+	require.NoError(t, ioutil.WriteFile(emptyPath, []byte("not a cert"), 0600))
+
+	_, err = LoadCAPool(emptyPath)
+	assert.Error(t, err)
+}
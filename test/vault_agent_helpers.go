@@ -0,0 +1,293 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// The file sink run-vault configures the Vault agent to write its token to
+const VAULT_AGENT_SINK_PATH = "/opt/vault/data/vault-token"
+
+// The vault-agent test sets a short TTL on the Vault role, so the agent has to renew its token, and log in again once
+// it's revoked, while the test watches. The max TTL is long enough that the agent never reaches it during the test.
+const VAR_VAULT_AGENT_ROLE_TTL = "example_role_ttl"
+const VAR_VAULT_AGENT_ROLE_MAX_TTL = "example_role_max_ttl"
+const VAULT_AGENT_TEST_ROLE_TTL = 2 * time.Minute
+const VAULT_AGENT_TEST_ROLE_MAX_TTL = time.Hour
+
+// The agent renews its token after about two thirds of its TTL, which is also when it finds out the token was revoked.
+// Give it another minute to log in again and write the new token.
+const VAULT_AGENT_REAUTH_TIMEOUT = VAULT_AGENT_TEST_ROLE_TTL + time.Minute
+const VAULT_AGENT_SINK_POLL_INTERVAL = 5 * time.Second
+
+// The port the vault-agent example runs the caching proxy of the Vault agent on, on 127.0.0.1
+const VAULT_AGENT_LISTENER_PORT = 8100
+
+// How long to wait for an SSH connection to a host, the same as the Terratest ssh helpers
+const SSH_DIAL_TIMEOUT = 10 * time.Second
+
+// The config file the vault-agent example has the Vault agent render the example secret into, and the permissions it
+// asks for, as stat prints them
+const VAULT_AGENT_TEMPLATE_DESTINATION = "/opt/vault/data/example-app.conf"
+const VAULT_AGENT_TEMPLATE_PERMS = "640"
+
+// The vault-agent example writes the example secret with this TTL, which is how often the agent reads it again to
+// render its template. Give it another minute to notice the secret changed and render the file again.
+const VAULT_AGENT_SECRET_TTL = time.Minute
+const VAULT_AGENT_RENDER_TIMEOUT = VAULT_AGENT_SECRET_TTL + time.Minute
+
+// The vault-agent example leaves a token that can update the example secret in this file on the Vault node, as the
+// token of the agent can only read it
+const VAULT_AGENT_SECRET_WRITER_TOKEN_PATH = "/opt/vault/data/example-writer-token"
+
+// The contents the template in the vault-agent example renders for the given secret
+func expectedAgentTemplateContents(secret string) string {
+	return fmt.Sprintf(`the_answer = "%s"`, secret)
+}
+
+// Read the token the Vault agent on the given host wrote to its sink. The sink belongs to the vault user, hence sudo.
+func readAgentSinkTokenE(t *testing.T, host ssh.Host) (string, error) {
+	output, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", VAULT_AGENT_SINK_PATH))
+	return strings.TrimSpace(output), err
+}
+
+func readAgentSinkToken(t *testing.T, host ssh.Host) string {
+	token, err := readAgentSinkTokenE(t, host)
+	require.NoError(t, err, "Failed to read the token the Vault agent on %s wrote to %s", host.Hostname, VAULT_AGENT_SINK_PATH)
+	require.NotEmpty(t, token, "Expected the Vault agent on %s to have written a token to %s", host.Hostname, VAULT_AGENT_SINK_PATH)
+	return token
+}
+
+// Look up the given token with the token itself
+func lookupToken(client *api.Client, token string) (*api.Secret, error) {
+	client.SetToken(token)
+	return client.Auth().Token().LookupSelf()
+}
+
+// Check the lifecycle of the token the Vault agent on the given client host manages, against the Vault node at the
+// given host:
+//
+//  1. The token in the sink is valid and renewable, and has a TTL no longer than the one of the role.
+//  2. Once that TTL has passed, the same token is still valid, as the agent renewed it.
+//  3. Once the token is revoked, the agent logs in again and writes a new, valid token to the sink within
+//     VAULT_AGENT_REAUTH_TIMEOUT.
+func testVaultAgentTokenLifecycle(t *testing.T, clientHost ssh.Host, vaultHost string, tlsCert TlsCert, roleTtl time.Duration) {
+	client := createVaultClientWithCert(t, net.JoinHostPort(vaultHost, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+
+	token := readAgentSinkToken(t, clientHost)
+	ttl := checkAgentTokenValid(t, client, token, roleTtl)
+
+	logger.Logf(t, "Waiting %s for the token of the Vault agent on %s to reach the end of its TTL", ttl, clientHost.Hostname)
+	time.Sleep(ttl + VAULT_AGENT_SINK_POLL_INTERVAL)
+
+	assert.Equal(t, token, readAgentSinkToken(t, clientHost), "Expected the Vault agent on %s to keep renewing its token, rather than log in again", clientHost.Hostname)
+	renewed, err := lookupToken(client, token)
+	require.NoError(t, err, "Expected the Vault agent on %s to renew its token before its TTL of %s ran out", clientHost.Hostname, ttl)
+	assert.NotNil(t, renewed.Data["last_renewal_time"], "Expected Vault to have recorded the renewal of the token of the Vault agent on %s", clientHost.Hostname)
+
+	require.NoError(t, client.Auth().Token().RevokeSelf(""), "Failed to revoke the token of the Vault agent on %s", clientHost.Hostname)
+
+	_, err = lookupToken(client, token)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the revoked token of the Vault agent on %s to be rejected", clientHost.Hostname)
+
+	newToken := waitForNewAgentSinkToken(t, clientHost, token)
+	checkAgentTokenValid(t, client, newToken, roleTtl)
+}
+
+// Check that the given agent token is valid and renewable, has the policy of the example role and a TTL no longer than
+// the one of the role. Returns the TTL it has left.
+func checkAgentTokenValid(t *testing.T, client *api.Client, token string, roleTtl time.Duration) time.Duration {
+	secret, err := lookupToken(client, token)
+	require.NoError(t, err, "Expected the token in the sink of the Vault agent to be valid")
+
+	policies, err := secret.TokenPolicies()
+	require.NoError(t, err)
+	assert.Contains(t, policies, AWS_AUTH_EXAMPLE_POLICY, "Expected the token of the Vault agent to have the policy of the role")
+
+	renewable, err := secret.TokenIsRenewable()
+	require.NoError(t, err)
+	assert.True(t, renewable, "Expected the token of the Vault agent to be renewable")
+
+	ttl, err := secret.TokenTTL()
+	require.NoError(t, err)
+	require.True(t, ttl > 0 && ttl <= roleTtl, "Expected the token of the Vault agent to have a TTL of at most %s, the TTL of the role, but got %s", roleTtl, ttl)
+
+	return ttl
+}
+
+// Wait for the Vault agent on the given host to replace the given token in its sink, and return the new one
+func waitForNewAgentSinkToken(t *testing.T, host ssh.Host, oldToken string) string {
+	maxRetries := int(VAULT_AGENT_REAUTH_TIMEOUT / VAULT_AGENT_SINK_POLL_INTERVAL)
+	description := fmt.Sprintf("Waiting for the Vault agent on %s to log in again and write a new token to %s", host.Hostname, VAULT_AGENT_SINK_PATH)
+
+	newToken, err := retry.DoWithRetryE(t, description, maxRetries, VAULT_AGENT_SINK_POLL_INTERVAL, func() (string, error) {
+		token, err := readAgentSinkTokenE(t, host)
+		if err != nil {
+			return "", err
+		}
+		if token == "" || token == oldToken {
+			return "", fmt.Errorf("Sink still has the revoked token")
+		}
+		return token, nil
+	})
+	require.NoError(t, err, "Expected the Vault agent on %s to write a new token within %s of its token being revoked", host.Hostname, VAULT_AGENT_REAUTH_TIMEOUT)
+	return newToken
+}
+
+// Check the template the Vault agent on the given client host renders, against the Vault node on the given host:
+//
+//  1. The agent rendered the example secret into VAULT_AGENT_TEMPLATE_DESTINATION, with the permissions the example
+//     asks for.
+//  2. The token of the agent can't update the secret, as the example policy only allows reading it.
+//  3. Once the secret is updated, with the token the example leaves on the Vault node for that, the agent renders the
+//     file again with the new value within VAULT_AGENT_RENDER_TIMEOUT.
+func testVaultAgentTemplate(t *testing.T, clientHost ssh.Host, vaultHost ssh.Host, tlsCert TlsCert, secretPath string, expectedSecret string) {
+	waitForAgentTemplateContents(t, clientHost, expectedAgentTemplateContents(expectedSecret))
+
+	perms, err := ssh.CheckSshCommandE(t, clientHost, fmt.Sprintf("sudo stat -c %%a %s", VAULT_AGENT_TEMPLATE_DESTINATION))
+	require.NoError(t, err, "Failed to check the permissions of %s on %s", VAULT_AGENT_TEMPLATE_DESTINATION, clientHost.Hostname)
+	assert.Equal(t, VAULT_AGENT_TEMPLATE_PERMS, strings.TrimSpace(perms), "Expected the Vault agent on %s to render %s with the permissions of its template", clientHost.Hostname, VAULT_AGENT_TEMPLATE_DESTINATION)
+
+	client := createVaultClientWithCert(t, net.JoinHostPort(vaultHost.Hostname, strconv.Itoa(vaultApiPort)), tlsCert, nil)
+
+	// Keep the TTL, or the agent would only read the secret again once its token expires
+	updatedSecret := fmt.Sprintf("%s-%s", expectedSecret, random.UniqueId())
+	update := map[string]interface{}{"the_answer": updatedSecret, "ttl": VAULT_AGENT_SECRET_TTL.String()}
+
+	client.SetToken(readAgentSinkToken(t, clientHost))
+	_, err = client.Logical().Write(secretPath, update)
+	assertVaultError(t, err, http.StatusForbidden, VAULT_ERROR_PERMISSION_DENIED, "Expected the token of the Vault agent on %s to be denied updating %s", clientHost.Hostname, secretPath)
+
+	client.SetToken(readSecretWriterToken(t, vaultHost))
+	_, err = client.Logical().Write(secretPath, update)
+	require.NoError(t, err, "Failed to update %s with the token the example leaves on %s", secretPath, vaultHost.Hostname)
+
+	waitForAgentTemplateContents(t, clientHost, expectedAgentTemplateContents(updatedSecret))
+}
+
+// Read the token that can update the example secret, which the vault-agent example leaves on the given Vault node.
+// Only root can read it.
+func readSecretWriterToken(t *testing.T, host ssh.Host) string {
+	output, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", VAULT_AGENT_SECRET_WRITER_TOKEN_PATH))
+	require.NoError(t, err, "Failed to read the secret writer token from %s on %s", VAULT_AGENT_SECRET_WRITER_TOKEN_PATH, host.Hostname)
+
+	token := strings.TrimSpace(output)
+	require.NotEmpty(t, token, "Expected the Vault node %s to have a secret writer token in %s", host.Hostname, VAULT_AGENT_SECRET_WRITER_TOKEN_PATH)
+	return token
+}
+
+// Wait for the Vault agent on the given host to render the given contents into VAULT_AGENT_TEMPLATE_DESTINATION
+func waitForAgentTemplateContents(t *testing.T, host ssh.Host, expectedContents string) {
+	maxRetries := int(VAULT_AGENT_RENDER_TIMEOUT / VAULT_AGENT_SINK_POLL_INTERVAL)
+	description := fmt.Sprintf("Waiting for the Vault agent on %s to render %s", host.Hostname, VAULT_AGENT_TEMPLATE_DESTINATION)
+
+	_, err := retry.DoWithRetryE(t, description, maxRetries, VAULT_AGENT_SINK_POLL_INTERVAL, func() (string, error) {
+		output, err := ssh.CheckSshCommandE(t, host, fmt.Sprintf("sudo cat %s", VAULT_AGENT_TEMPLATE_DESTINATION))
+		if err != nil {
+			return "", err
+		}
+		if contents := strings.TrimSpace(output); contents != expectedContents {
+			return "", fmt.Errorf("Expected %s to contain '%s', but got '%s'", VAULT_AGENT_TEMPLATE_DESTINATION, expectedContents, contents)
+		}
+		return "", nil
+	})
+	require.NoError(t, err, "Expected the Vault agent on %s to render '%s' into %s within %s", host.Hostname, expectedContents, VAULT_AGENT_TEMPLATE_DESTINATION, VAULT_AGENT_RENDER_TIMEOUT)
+}
+
+// Check that a client with no token can read the example secret through the caching proxy of the Vault agent on the
+// given client host, as the agent adds its own token to the requests it forwards, and that the proxy only listens on
+// 127.0.0.1. The client reaches the proxy through an SSH connection to the host, and checks the proxy serves the same
+// TLS cert as the Vault nodes.
+func testVaultAgentListener(t *testing.T, clientHost ssh.Host, tlsCert TlsCert, secretPath string, expectedSecret string) {
+	sshClient, err := dialSsh(clientHost)
+	require.NoError(t, err, "Failed to SSH to %s", clientHost.Hostname)
+	defer sshClient.Close()
+
+	config := createVaultConfigWithCert(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(VAULT_AGENT_LISTENER_PORT)), tlsCert, nil)
+	config.HttpClient.Transport.(*http.Transport).DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return sshClient.Dial(network, address)
+	}
+	client := newVaultClient(t, config)
+
+	secret, err := client.Logical().Read(secretPath)
+	require.NoError(t, err, "Failed to read %s through the Vault agent on %s without a token", secretPath, clientHost.Hostname)
+	require.NotNil(t, secret, "Expected %s to exist", secretPath)
+	assert.Equal(t, expectedSecret, secret.Data["the_answer"], "Expected to read %s through the Vault agent on %s", secretPath, clientHost.Hostname)
+
+	output, err := ssh.CheckSshCommandE(t, clientHost, fmt.Sprintf("ss -ltnH 'sport = :%d'", VAULT_AGENT_LISTENER_PORT))
+	require.NoError(t, err, "Failed to list the sockets listening on port %d on %s", VAULT_AGENT_LISTENER_PORT, clientHost.Hostname)
+
+	listenAddresses := parseListenAddresses(output)
+	require.NotEmpty(t, listenAddresses, "Expected the caching proxy of the Vault agent to listen on port %d on %s", VAULT_AGENT_LISTENER_PORT, clientHost.Hostname)
+	for _, listenAddress := range listenAddresses {
+		host, _, err := net.SplitHostPort(listenAddress)
+		require.NoError(t, err, "Failed to parse the listen address %s", listenAddress)
+		assert.Equal(t, "127.0.0.1", host, "Expected the caching proxy of the Vault agent on %s to only listen on 127.0.0.1", clientHost.Hostname)
+	}
+}
+
+// Parse the local addresses out of the output of ss -ltnH, which has one socket per line, e.g.
+// "LISTEN 0 128 127.0.0.1:8100 0.0.0.0:*"
+func parseListenAddresses(output string) []string {
+	listenAddresses := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 {
+			listenAddresses = append(listenAddresses, fields[3])
+		}
+	}
+	return listenAddresses
+}
+
+// Open an SSH connection to the given host with its key pair or the local SSH agent, the way the Terratest ssh helpers
+// do. Those helpers can't forward ports, but the client this returns can dial addresses on the host.
+func dialSsh(host ssh.Host) (*gossh.Client, error) {
+	authMethods := []gossh.AuthMethod{}
+	if host.SshKeyPair != nil {
+		signer, err := gossh.ParsePrivateKey([]byte(host.SshKeyPair.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		authMethods = append(authMethods, gossh.PublicKeys(signer))
+	}
+	if host.SshAgent {
+		agentConn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, err
+		}
+		// The agent is only needed for the handshake, which gossh.Dial completes before returning
+		defer agentConn.Close()
+		authMethods = append(authMethods, gossh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	port := host.CustomPort
+	if port == 0 {
+		port = 22
+	}
+
+	config := &gossh.ClientConfig{
+		User: host.SshUserName,
+		Auth: authMethods,
+		// The test hosts are short-lived, so there's no known host key to check against
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         SSH_DIAL_TIMEOUT,
+	}
+	return gossh.Dial("tcp", net.JoinHostPort(host.Hostname, strconv.Itoa(port)), config)
+}
@@ -0,0 +1,15 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenAddresses(t *testing.T) {
+	t.Parallel()
+
+	output := "LISTEN 0      4096       127.0.0.1:8100       0.0.0.0:*\nLISTEN 0      4096           [::]:8100          [::]:*\n"
+	assert.Equal(t, []string{"127.0.0.1:8100", "[::]:8100"}, parseListenAddresses(output))
+	assert.Empty(t, parseListenAddresses(""))
+}
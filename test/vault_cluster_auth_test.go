@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"testing"
 	"time"
 
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultlog"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/gruntwork-io/terratest/modules/files"
 	http_helper "github.com/gruntwork-io/terratest/modules/http-helper"
@@ -20,6 +24,8 @@ import (
 const VAULT_EC2_AUTH_PATH = "examples/vault-ec2-auth"
 const VAULT_IAM_AUTH_PATH = "examples/vault-iam-auth"
 const VAULT_AGENT_PATH = "examples/vault-agent"
+const VAULT_CERT_AUTH_PATH = "examples/vault-cert-auth"
+const VAULT_APPROLE_AUTH_PATH = "examples/vault-approle-auth"
 
 const VAR_VAULT_AUTH_SERVER_NAME = "auth_server_name"
 const VAR_VAULT_SECRET_NAME = "example_secret"
@@ -27,6 +33,10 @@ const VAR_VAULT_IAM_AUTH_ROLE = "example_role_name"
 
 const OUTPUT_AUTH_CLIENT_IP = "auth_client_public_ip"
 const OUTPUT_AUTH_CLIENT_INSTANCE_ID = "auth_client_instance_id"
+const OUTPUT_AUTH_ROLE_NAME = "auth_role_name"
+const OUTPUT_AUTH_ROLE_ARN = "auth_role_arn"
+
+const EXAMPLE_SECRET_PATH = "secret/example_gruntwork"
 
 // Test the Vault EC2 authentication example by:
 //
@@ -37,6 +47,8 @@ const OUTPUT_AUTH_CLIENT_INSTANCE_ID = "auth_client_instance_id"
 // 4. Waiting for Vault to boot, then unsealing the server, creating a Vault Role to allow logins from instances with a specific EC2 property and writing the example secret
 // 5. Waiting for the client to login, read the secret and launch a simple web server with the contents read
 // 6. Making a request to the webserver started by the auth client
+// 7. Logging in from the test with the PKCS7 identity of a Vault node, checking the policies, TTL and metadata of the token and reading the secret with it
+// 8. Checking that the token is denied reading outside the policy and overwriting the secret, and that a login as a role that doesn't exist is rejected
 func runVaultEC2AuthTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
 	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, VAULT_EC2_AUTH_PATH)
 	exampleSecret := "42"
@@ -48,22 +60,34 @@ func runVaultEC2AuthTest(t *testing.T, amiId string, awsRegion string, sshUserNa
 	defer test_structure.RunTestStage(t, "log", func() {
 		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
 		getSyslogs(t, terraformOptions, amiId, awsRegion, "vaultEc2Auth")
+		collectDiagnosticsIfFailed(t, "vaultEc2Auth", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_VAULT_AUTH_SERVER_NAME: fmt.Sprintf("vault-auth-test-%s", uniqueId),
-			VAR_VAULT_SECRET_NAME:      exampleSecret,
-			VAR_CONSUL_CLUSTER_NAME:    fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY: fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTH_SERVER_NAME, fmt.Sprintf("vault-auth-test-%s", uniqueId)).
+			Set(VAR_VAULT_SECRET_NAME, exampleSecret).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+
+		tlsCert := loadTlsCert(t, WORK_DIR)
+		roleName := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_ROLE_NAME)
+
 		testRequestSecret(t, terraformOptions, exampleSecret)
+
+		// The role in the example lets in any instance running the AMI under test, which includes the Vault nodes
+		node := clusterOptions.Host(clusterOptions.NodeIpAddresses(t)[0])
+		testEc2AuthLogin(t, node, tlsCert, roleName, amiId, awsRegion, EXAMPLE_SECRET_PATH, exampleSecret)
+		testEc2AuthRejectsInvalidLogins(t, node, tlsCert, roleName)
+
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 	})
 }
 
@@ -73,9 +97,13 @@ func runVaultEC2AuthTest(t *testing.T, amiId string, awsRegion string, sshUserNa
 //    state files overwriting each other.
 // 2. Building the AMI in the vault-consul-ami example with the given build name
 // 3. Deploying that AMI using the example Terraform code setting an example secret
-// 4. Waiting for Vault to boot, then unsealing the server, creating a Vault Role to allow logins from resources with a specific AWS IAM Role and writing the example secret
-// 5. Waiting for the client to login, read the secret and launch a simple web server with the contents read
-// 6. Making a request to the webserver started by the auth client
+// 4. Waiting for Vault to boot, then unsealing the server, creating the example policy and a Vault Role to allow logins from resources with a specific AWS IAM Role and writing the example secret
+// 5. Applying the vault-config folder of the example, which declares the same policy and Vault Role, with the root token the example logs, and checking that it changes nothing
+// 6. Waiting for the client to login, read the secret and launch a simple web server with the contents read
+// 7. Making a request to the webserver started by the auth client
+// 8. Logging in from the test with an STS request signed with the credentials of the client's IAM role, checking the policies, TTL and metadata of the token and reading the secret with it
+// 9. Checking that the token is denied reading outside the policy and overwriting the secret, and that logins with the IAM role of a Vault node or as a role that doesn't exist are rejected
+// 10. Downloading the audit log of the file audit device the example enables, and checking that the reads of the secret show up in it with the accessor of the token, and with the token and the secret hashed
 func runVaultIAMAuthTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
 	// For convenience - uncomment these as well as the "os" import
 	// when doing local testing if you need to skip any sections.
@@ -93,25 +121,48 @@ func runVaultIAMAuthTest(t *testing.T, amiId string, awsRegion string, sshUserNa
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
+		// Deferred, so a failing check of the audit log below also gets a diagnostics bundle
+		defer collectDiagnosticsIfFailed(t, "vaultIamAuth", examplesDir, amiId, awsRegion, sshUserName)
+
 		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
 		getSyslogs(t, terraformOptions, amiId, awsRegion, "vaultIamAuth")
+
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		node := clusterOptions.Host(clusterOptions.NodeIpAddresses(t)[0])
+		testAuditLog(t, examplesDir, node, filepath.Join("/tmp/logs", "vaultIamAuth", amiId), EXAMPLE_SECRET_PATH, exampleSecret)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_VAULT_AUTH_SERVER_NAME: fmt.Sprintf("vault-auth-test-%s", uniqueId),
-			VAR_VAULT_IAM_AUTH_ROLE:    fmt.Sprintf("vault-auth-role-test-%s", uniqueId),
-			VAR_VAULT_SECRET_NAME:      exampleSecret,
-			VAR_CONSUL_CLUSTER_NAME:    fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY: fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTH_SERVER_NAME, fmt.Sprintf("vault-auth-test-%s", uniqueId)).
+			Set(VAR_VAULT_IAM_AUTH_ROLE, fmt.Sprintf("vault-auth-role-test-%s", uniqueId)).
+			Set(VAR_VAULT_SECRET_NAME, exampleSecret).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+
+		tlsCert := loadTlsCert(t, WORK_DIR)
+		roleName := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_ROLE_NAME)
+		roleArn := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_ROLE_ARN)
+		clientHost := clusterOptions.Host(terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_CLIENT_IP))
+
+		nodeIp := clusterOptions.NodeIpAddresses(t)[0]
+		testIamAuthBootstrapDir(t, examplesDir, clusterOptions.Host(nodeIp), tlsCert, roleName, roleArn, EXAMPLE_SECRET_PATH)
+
 		testRequestSecret(t, terraformOptions, exampleSecret)
+
+		// The Vault nodes have the IAM role of the cluster, rather than the one the Vault role is bound to
+		accessor := testIamAuthLogin(t, nodeIp, clientHost, tlsCert, roleName, roleArn, EXAMPLE_SECRET_PATH, exampleSecret)
+		saveAuditAccessor(t, examplesDir, accessor)
+		testIamAuthRejectsInvalidLogins(t, nodeIp, clientHost, clusterOptions.Host(nodeIp), tlsCert, roleName)
+
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 	})
 }
 
@@ -124,6 +175,9 @@ func runVaultIAMAuthTest(t *testing.T, amiId string, awsRegion string, sshUserNa
 // 4. Waiting for Vault to boot, then unsealing the server, creating a Vault Role to allow logins from resources with a specific AWS IAM Role and writing the example secret
 // 5. Waiting for the client to login, read the secret and launch a simple web server with the contents read
 // 6. Making a request to the webserver started by the auth client
+// 7. Reading the secret without a token through the caching proxy the agent runs on 127.0.0.1, through an SSH connection to the client, and checking the proxy only listens on 127.0.0.1
+// 8. Checking that the agent rendered the secret into a config file with its template, that its token can't update the secret, and that it renders the file again once the secret is updated with the token the example leaves for that
+// 9. Checking that the token the agent writes to its sink is valid and renewable, that the agent renews it before its short TTL runs out, and that it logs in again and writes a new token once the token is revoked
 func runVaultAgentTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
 	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, VAULT_AGENT_PATH)
 	exampleSecret := "42"
@@ -135,23 +189,141 @@ func runVaultAgentTest(t *testing.T, amiId string, awsRegion string, sshUserName
 	defer test_structure.RunTestStage(t, "log", func() {
 		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
 		getSyslogs(t, terraformOptions, amiId, awsRegion, "vaultAgentAuth")
+		collectDiagnosticsIfFailed(t, "vaultAgentAuth", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_VAULT_AUTH_SERVER_NAME: fmt.Sprintf("vault-auth-test-%s", uniqueId),
-			VAR_VAULT_IAM_AUTH_ROLE:    fmt.Sprintf("vault-auth-role-test-%s", uniqueId),
-			VAR_VAULT_SECRET_NAME:      exampleSecret,
-			VAR_CONSUL_CLUSTER_NAME:    fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY: fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTH_SERVER_NAME, fmt.Sprintf("vault-auth-test-%s", uniqueId)).
+			Set(VAR_VAULT_IAM_AUTH_ROLE, fmt.Sprintf("vault-auth-role-test-%s", uniqueId)).
+			Set(VAR_VAULT_SECRET_NAME, exampleSecret).
+			Set(VAR_VAULT_AGENT_ROLE_TTL, VAULT_AGENT_TEST_ROLE_TTL.String()).
+			Set(VAR_VAULT_AGENT_ROLE_MAX_TTL, VAULT_AGENT_TEST_ROLE_MAX_TTL.String()).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+
+		tlsCert := loadTlsCert(t, WORK_DIR)
+		clientHost := clusterOptions.Host(terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_CLIENT_IP))
+
+		testRequestSecret(t, terraformOptions, exampleSecret)
+		testVaultAgentListener(t, clientHost, tlsCert, EXAMPLE_SECRET_PATH, exampleSecret)
+		// Before the token lifecycle checks, which revoke the token the agent renders the template with
+		testVaultAgentTemplate(t, clientHost, clusterOptions.Host(clusterOptions.NodeIpAddresses(t)[0]), tlsCert, EXAMPLE_SECRET_PATH, exampleSecret)
+		testVaultAgentTokenLifecycle(t, clientHost, clusterOptions.NodeIpAddresses(t)[0], tlsCert, VAULT_AGENT_TEST_ROLE_TTL)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
+	})
+}
+
+// Test the Vault TLS certificate authentication example by:
+//
+// 1. Copying the code in this repo to a temp folder so tests on the Terraform code can run in parallel without the
+//    state files overwriting each other.
+// 2. Building the AMI in the vault-consul-ami example with the given build name
+// 3. Deploying that AMI using the example Terraform code setting an example secret
+// 4. Waiting for Vault to boot, then unsealing the server, requiring client certs signed by the CA for client certs the example creates, creating a Vault Role for the cert auth method and writing the example secret
+// 5. Waiting for the client to login with Vault agent and its own client cert, read the secret and launch a simple web server with the contents read
+// 6. Making a request to the webserver started by the auth client
+// 7. Logging in to each Vault node from the test with the client cert of the auth client and reading the secret
+// 8. Checking that each Vault node rejects clients without a cert, with a cert from another CA, or with the server cert
+func runVaultCertAuthTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
+	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, VAULT_CERT_AUTH_PATH)
+	exampleSecret := "42"
+
+	defer test_structure.RunTestStage(t, "teardown", func() {
+		teardownResources(t, examplesDir)
+	})
+
+	defer test_structure.RunTestStage(t, "log", func() {
 		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
+		getSyslogs(t, terraformOptions, amiId, awsRegion, "vaultCertAuth")
+		collectDiagnosticsIfFailed(t, "vaultCertAuth", examplesDir, amiId, awsRegion, sshUserName)
+	})
+
+	test_structure.RunTestStage(t, "deploy", func() {
+		uniqueId := random.UniqueId()
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTH_SERVER_NAME, fmt.Sprintf("vault-auth-test-%s", uniqueId)).
+			Set(VAR_VAULT_IAM_AUTH_ROLE, fmt.Sprintf("vault-auth-role-test-%s", uniqueId)).
+			Set(VAR_VAULT_SECRET_NAME, exampleSecret).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
+		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
+	})
+
+	test_structure.RunTestStage(t, "validate", func() {
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+		tlsCert := loadTlsCert(t, WORK_DIR)
+		roleName := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_ROLE_NAME)
+		clientCert := loadAuthClientCert(t, terraformOptions)
+
 		testRequestSecret(t, terraformOptions, exampleSecret)
+
+		for _, host := range clusterOptions.NodeIpAddresses(t) {
+			testCertAuthLogin(t, host, tlsCert, clientCert, roleName, EXAMPLE_SECRET_PATH, exampleSecret)
+			testCertAuthRejectsInvalidClients(t, host, tlsCert, roleName)
+		}
+
+		expectations := vaultconfig.DefaultExpectations
+		expectations.RequireClientCert = true
+		expectations.TlsClientCAFile = "/opt/vault/tls/client-ca.crt.pem"
+		validateVaultConfig(t, clusterOptions, expectations)
+	})
+}
+
+// Test the Vault AppRole authentication example by:
+//
+// 1. Copying the code in this repo to a temp folder so tests on the Terraform code can run in parallel without the
+//    state files overwriting each other.
+// 2. Building the AMI in the vault-consul-ami example with the given build name
+// 3. Deploying that AMI using the example Terraform code setting an example secret
+// 4. Waiting for Vault to boot, then unsealing the server, creating an AppRole and a token for a trusted orchestrator that can issue secret IDs for it, and writing the example secret
+// 5. Playing the part of the orchestrator: reading the role ID of the AppRole and issuing a response-wrapped secret ID with the orchestrator token, and checking the token can't read the secret itself, nor issue a secret ID that isn't wrapped or is wrapped for too long
+// 6. Delivering the role ID and the wrapped secret ID to the auth client over SSH
+// 7. Waiting for the Vault agent on the auth client to unwrap the secret ID and log in as the AppRole, and checking the token it gets
+// 8. Reading the secret without a token through the caching proxy the agent runs on 127.0.0.1, through an SSH connection to the client, and checking the proxy only listens on 127.0.0.1
+func runVaultAppRoleAuthTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
+	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, VAULT_APPROLE_AUTH_PATH)
+	exampleSecret := "42"
+
+	defer test_structure.RunTestStage(t, "teardown", func() {
+		teardownResources(t, examplesDir)
+	})
+
+	defer test_structure.RunTestStage(t, "log", func() {
+		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
+		getSyslogs(t, terraformOptions, amiId, awsRegion, "vaultAppRoleAuth")
+		collectDiagnosticsIfFailed(t, "vaultAppRoleAuth", examplesDir, amiId, awsRegion, sshUserName)
+	})
+
+	test_structure.RunTestStage(t, "deploy", func() {
+		uniqueId := random.UniqueId()
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTH_SERVER_NAME, fmt.Sprintf("vault-auth-test-%s", uniqueId)).
+			Set(VAR_VAULT_IAM_AUTH_ROLE, fmt.Sprintf("vault-auth-role-test-%s", uniqueId)).
+			Set(VAR_VAULT_SECRET_NAME, exampleSecret).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
+		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
+	})
+
+	test_structure.RunTestStage(t, "validate", func() {
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+		tlsCert := loadTlsCert(t, WORK_DIR)
+		roleName := terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_ROLE_NAME)
+		clientHost := clusterOptions.Host(terraform.OutputRequired(t, terraformOptions, OUTPUT_AUTH_CLIENT_IP))
+		vaultHost := clusterOptions.Host(clusterOptions.NodeIpAddresses(t)[0])
+
+		testAppRoleAgentLogin(t, vaultHost, clientHost, tlsCert, roleName, EXAMPLE_SECRET_PATH, exampleSecret)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 	})
 }
 
@@ -181,8 +353,19 @@ func getSyslogs(t *testing.T, terraformOptions *terraform.Options, amiId string,
 		os.MkdirAll(localDestDir, 0755)
 	}
 
+	reports := []vaultlog.Report{}
 	for id, buf := range serverLogs {
-		writeLogFile(t, buf, filepath.Join(localDestDir, fmt.Sprintf("vault-server-%s-syslog.log", id)))
+		fileName := fmt.Sprintf("vault-server-%s-syslog.log", id)
+		vaulttest.WriteLogFile(t, buf, filepath.Join(localDestDir, fileName))
+		reports = append(reports, vaulttest.AnalyzeLogs(fileName, buf, vaultlog.DefaultAllowList))
+	}
+	vaulttest.WriteLogFile(t, clientLog, filepath.Join(localDestDir, "auth-client-syslog.log"))
+
+	// Sort the summaries by server, as the syslogs come in a map
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Source < reports[j].Source })
+	summary := vaulttest.SummarizeLogs(reports)
+	vaulttest.WriteLogFile(t, summary, filepath.Join(localDestDir, vaulttest.LogSummaryFileName))
+	if t.Failed() {
+		logger.Logf(t, "Summary of the Vault server syslogs of the failed test:\n%s", summary)
 	}
-	writeLogFile(t, clientLog, filepath.Join(localDestDir, "auth-client-syslog.log"))
 }
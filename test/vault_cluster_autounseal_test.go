@@ -5,7 +5,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/logger"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/retry"
@@ -41,61 +42,55 @@ func runVaultAutoUnsealTest(t *testing.T, amiId string, awsRegion string, sshUse
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		getVaultLogs(t, "vaultAutoUnseal", terraformOptions, amiId, awsRegion, sshUserName, keyPair)
+		getVaultLogs(t, "vaultAutoUnseal", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_VAULT_AUTO_UNSEAL_KMS_KEY_ALIAS: AUTO_UNSEAL_KMS_KEY_ALIAS,
-			VAR_VAULT_CLUSTER_SIZE:              1,
-			VAR_CONSUL_CLUSTER_NAME:             fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY:          fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_VAULT_AUTO_UNSEAL_KMS_KEY_ALIAS, AUTO_UNSEAL_KMS_KEY_ALIAS).
+			Set(VAR_VAULT_CLUSTER_SIZE, 1).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+
+		testAutoUnseal(t, clusterOptions)
 
-		testAutoUnseal(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		expectedConfig := vaultconfig.DefaultExpectations
+		expectedConfig.AutoUnseal = true
+		validateVaultConfig(t, clusterOptions, expectedConfig)
 	})
 }
 
-func testAutoUnseal(t *testing.T, asgNameOutputVar string, sshUserName string, terraformOptions *terraform.Options, awsRegion string, keyPair *aws.Ec2Keypair) {
-	asgName := terraform.OutputRequired(t, terraformOptions, asgNameOutputVar)
-	nodeIpAddresses := getIpAddressesOfAsgInstances(t, asgName, awsRegion)
+func testAutoUnseal(t *testing.T, clusterOptions vaulttest.ClusterOptions) {
+	nodeIpAddresses := clusterOptions.NodeIpAddresses(t)
 	logger.Logf(t, fmt.Sprintf("IP ADDRESS OF INSTANCE %s", nodeIpAddresses[0]))
-	initialCluster := VaultCluster{
-		Leader: ssh.Host{
-			Hostname:    nodeIpAddresses[0],
-			SshUserName: sshUserName,
-			SshKeyPair:  keyPair.KeyPair,
-		},
+	initialCluster := vaulttest.Cluster{
+		Leader: clusterOptions.Host(nodeIpAddresses[0]),
 	}
 
-	establishConnectionToCluster(t, initialCluster)
-	waitForVaultToBoot(t, initialCluster)
+	vaulttest.EstablishConnectionToCluster(t, initialCluster)
+	vaulttest.WaitForVaultToBoot(t, initialCluster)
 
 	retry.DoWithRetry(t, "Initializing the cluster", 10, 10*time.Second, func() (string, error) {
 		return ssh.CheckSshCommandE(t, initialCluster.Leader, "vault operator init")
 	})
-	assertStatus(t, initialCluster.Leader, Leader)
+	vaulttest.AssertStatus(t, initialCluster.Leader, vaulttest.Leader)
 
 	logger.Logf(t, "Increasing the cluster size and running 'terraform apply' again")
-	terraformOptions.Vars[VAR_VAULT_CLUSTER_SIZE] = 3
-	terraform.Apply(t, terraformOptions)
+	clusterOptions.TerraformOptions.Vars[VAR_VAULT_CLUSTER_SIZE] = 3
+	terraform.Apply(t, clusterOptions.TerraformOptions)
 
 	logger.Logf(t, "The cluster now should be bigger and the new nodes should boot unsealed (on standby mode already)")
-	newCluster := findVaultClusterNodes(t, asgNameOutputVar, sshUserName, terraformOptions, awsRegion, keyPair)
-	establishConnectionToCluster(t, newCluster)
+	newCluster := vaulttest.FindCluster(t, clusterOptions)
+	vaulttest.EstablishConnectionToCluster(t, newCluster)
 	for _, node := range newCluster.Nodes() {
 		if node.Hostname != initialCluster.Leader.Hostname {
-			assertStatus(t, node, Standby)
+			vaulttest.AssertStatus(t, node, vaulttest.Standby)
 		}
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/random"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 )
@@ -28,26 +30,22 @@ func runVaultWithDynamoBackendClusterTest(t *testing.T, amiId string, awsRegion,
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		getVaultLogs(t, "vaultClusterWithDynamoBackend", terraformOptions, amiId, awsRegion, sshUserName, keyPair)
+		getVaultLogs(t, "vaultClusterWithDynamoBackend", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_DYNAMO_TABLE_NAME:       fmt.Sprintf("vault-dynamo-test-%s", uniqueId),
-			VAR_S3_BUCKET_NAME:          s3BucketName(uniqueId),
-			VAR_FORCE_DESTROY_S3_BUCKET: true,
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_DYNAMO_TABLE_NAME, fmt.Sprintf("vault-dynamo-test-%s", uniqueId)).
+			Set(VAR_S3_BUCKET_NAME, s3BucketName(uniqueId)).
+			Set(VAR_FORCE_DESTROY_S3_BUCKET, true)
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
 
-		initializeAndUnsealVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		vaulttest.InitializeAndUnsealCluster(t, clusterOptions)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 	})
 }
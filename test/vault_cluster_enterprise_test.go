@@ -7,11 +7,11 @@ import (
 	"testing"
 	"time"
 
-	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/retry"
 	"github.com/gruntwork-io/terratest/modules/ssh"
-	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 )
 
@@ -44,48 +44,35 @@ func runVaultEnterpriseClusterTest(t *testing.T, amiId string, awsRegion string,
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		getVaultLogs(t, "vaultEnterpriseCluster", terraformOptions, amiId, awsRegion, sshUserName, keyPair)
+		getVaultLogs(t, "vaultEnterpriseCluster", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_CONSUL_CLUSTER_NAME:    fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY: fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "initialize_unseal", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		initializeAndUnsealVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		vaulttest.InitializeAndUnsealCluster(t, loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName))
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
 
-		cluster := getInitializedAndUnsealedVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		cluster := vaulttest.GetInitializedAndUnsealedCluster(t, clusterOptions)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 		testVaultUsesConsulForDns(t, cluster)
-		checkEnterpriseInstall(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		checkEnterpriseInstall(t, clusterOptions)
 	})
 }
 
 // Check if the enterprise version of consul and vault is installed
-func checkEnterpriseInstall(t *testing.T, asgNameOutputVar string, sshUserName string, terratestOptions *terraform.Options, awsRegion string, keyPair *aws.Ec2Keypair) {
-	asgName := terraform.OutputRequired(t, terratestOptions, asgNameOutputVar)
-	nodeIpAddresses := getIpAddressesOfAsgInstances(t, asgName, awsRegion)
-
-	host := ssh.Host{
-		Hostname:    nodeIpAddresses[0],
-		SshUserName: sshUserName,
-		SshKeyPair:  keyPair.KeyPair,
-	}
+func checkEnterpriseInstall(t *testing.T, clusterOptions vaulttest.ClusterOptions) {
+	nodeIpAddresses := clusterOptions.NodeIpAddresses(t)
+	host := clusterOptions.Host(nodeIpAddresses[0])
 
 	maxRetries := 10
 	sleepBetweenRetries := 10 * time.Second
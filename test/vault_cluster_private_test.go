@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/random"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 )
@@ -27,33 +29,26 @@ func runVaultPrivateClusterTest(t *testing.T, amiId string, awsRegion string, ss
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		getVaultLogs(t, "vaultPrivateCluster", terraformOptions, amiId, awsRegion, sshUserName, keyPair)
+		getVaultLogs(t, "vaultPrivateCluster", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAR_CONSUL_CLUSTER_NAME:    fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY: fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "initialize_unseal", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		initializeAndUnsealVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		vaulttest.InitializeAndUnsealCluster(t, loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName))
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
 
-		cluster := getInitializedAndUnsealedVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		cluster := vaulttest.GetInitializedAndUnsealedCluster(t, clusterOptions)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
 		testVaultUsesConsulForDns(t, cluster)
 	})
 }
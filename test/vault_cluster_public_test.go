@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
 	"github.com/gruntwork-io/terratest/modules/random"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 )
@@ -14,6 +16,8 @@ const VAULT_CLUSTER_PUBLIC_VAR_CREATE_DNS_ENTRY = "create_dns_entry"
 const VAULT_CLUSTER_PUBLIC_VAR_HOSTED_ZONE_DOMAIN_NAME = "hosted_zone_domain_name"
 const VAULT_CLUSTER_PUBLIC_VAR_VAULT_DOMAIN_NAME = "vault_domain_name"
 
+const SAVED_TLS_ENDPOINTS = "TlsEndpoints"
+
 // Test the Vault public cluster example by:
 //
 // 1. Copy the code in this repo to a temp folder so tests on the Terraform code can run in parallel without the
@@ -23,7 +27,10 @@ const VAULT_CLUSTER_PUBLIC_VAR_VAULT_DOMAIN_NAME = "vault_domain_name"
 // 4. SSH to a Vault node and initialize the Vault cluster
 // 5. SSH to each Vault node and unseal it
 // 6. Connect to the Vault cluster via the ELB
-// 7. SSH to a Vault node and make sure you can communicate with the nodes via Consul-managed DNS
+// 7. Check the TLS cert served by the API port of each node and by the ELB. DNS entries are disabled, so the Route 53
+//    name isn't checked.
+// 8. SSH to a Vault node and make sure you can communicate with the nodes via Consul-managed DNS
+// 9. Check the Prometheus metrics need a token, then scrape the metrics of each node with the root token and check the core gauges and the request count
 func runVaultPublicClusterTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
 	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, ".")
 
@@ -32,37 +39,42 @@ func runVaultPublicClusterTest(t *testing.T, amiId string, awsRegion string, ssh
 	})
 
 	defer test_structure.RunTestStage(t, "log", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		getVaultLogs(t, "vaultPrivateCluster", terraformOptions, amiId, awsRegion, sshUserName, keyPair)
+		getVaultLogs(t, "vaultPrivateCluster", examplesDir, amiId, awsRegion, sshUserName)
 	})
 
 	test_structure.RunTestStage(t, "deploy", func() {
 		uniqueId := random.UniqueId()
-		terraformVars := map[string]interface{}{
-			VAULT_CLUSTER_PUBLIC_VAR_CREATE_DNS_ENTRY:        boolToTerraformVar(false),
-			VAULT_CLUSTER_PUBLIC_VAR_HOSTED_ZONE_DOMAIN_NAME: "",
-			VAULT_CLUSTER_PUBLIC_VAR_VAULT_DOMAIN_NAME:       "",
-			VAR_CONSUL_CLUSTER_NAME:                          fmt.Sprintf("consul-test-%s", uniqueId),
-			VAR_CONSUL_CLUSTER_TAG_KEY:                       fmt.Sprintf("consul-test-%s", uniqueId),
-		}
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAULT_CLUSTER_PUBLIC_VAR_CREATE_DNS_ENTRY, false).
+			Set(VAULT_CLUSTER_PUBLIC_VAR_HOSTED_ZONE_DOMAIN_NAME, "").
+			Set(VAULT_CLUSTER_PUBLIC_VAR_VAULT_DOMAIN_NAME, "").
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
 		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
 	})
 
 	test_structure.RunTestStage(t, "initialize_unseal", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
-
-		initializeAndUnsealVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		cluster := vaulttest.InitializeAndUnsealCluster(t, loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName))
+		saveRootToken(t, examplesDir, cluster.RootToken)
 	})
 
 	test_structure.RunTestStage(t, "validate", func() {
-		terraformOptions := test_structure.LoadTerraformOptions(t, examplesDir)
-		keyPair := test_structure.LoadEc2KeyPair(t, examplesDir)
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		terraformOptions := clusterOptions.TerraformOptions
+		tlsCert := loadTlsCert(t, WORK_DIR)
 
-		cluster := getInitializedAndUnsealedVaultCluster(t, OUTPUT_VAULT_CLUSTER_ASG_NAME, sshUserName, terraformOptions, awsRegion, keyPair)
+		cluster := vaulttest.GetInitializedAndUnsealedCluster(t, clusterOptions)
+		cluster.RootToken = loadRootToken(t, examplesDir)
+		expectations := vaultconfig.DefaultExpectations
+		expectations.PrometheusRetentionTime = VAULT_PROMETHEUS_RETENTION_TIME
+		expectations.UnauthenticatedMetricsAccess = false
+		validateVaultConfig(t, clusterOptions, expectations)
 		testVaultViaElb(t, terraformOptions)
+
+		tlsEndpoints := verifyVaultTlsEndpoints(t, cluster, tlsCert, terraformOptions)
+		test_structure.SaveTestData(t, test_structure.FormatTestDataPath(examplesDir, SAVED_TLS_ENDPOINTS), tlsEndpoints)
+
 		testVaultUsesConsulForDns(t, cluster)
+		testVaultPrometheusMetrics(t, cluster)
 	})
 }
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultconfig"
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaulttest"
+	"github.com/gruntwork-io/terratest/modules/random"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+const SAVED_TLS_ROTATION_AVAILABILITY = "TlsRotationAvailability"
+
+// Test rotating the TLS cert of a live Vault cluster, using the Vault private cluster example, by:
+//
+// 1. Copy the code in this repo to a temp folder so tests on the Terraform code can run in parallel without the
+//    state files overwriting each other.
+// 2. Build the AMI in the vault-consul-ami example with the given build name
+// 3. Deploy that AMI using the example Terraform code
+// 4. SSH to a Vault node and initialize the Vault cluster
+// 5. SSH to each Vault node and unseal it
+// 6. Issue a new TLS cert signed by the same CA, copy it to each Vault node in turn and send Vault a SIGHUP
+// 7. Make sure each node serves the new cert with a chain its clients trust, that no node was sealed, that the leader
+//    didn't change, and that a node only stopped responding while it was reloading its own cert
+func runVaultTlsRotationTest(t *testing.T, amiId string, awsRegion string, sshUserName string) {
+	examplesDir := test_structure.CopyTerraformFolderToTemp(t, REPO_ROOT, VAULT_CLUSTER_PRIVATE_PATH)
+
+	defer test_structure.RunTestStage(t, "teardown", func() {
+		teardownResources(t, examplesDir)
+	})
+
+	defer test_structure.RunTestStage(t, "log", func() {
+		getVaultLogs(t, "vaultTlsRotation", examplesDir, amiId, awsRegion, sshUserName)
+	})
+
+	test_structure.RunTestStage(t, "deploy", func() {
+		uniqueId := random.UniqueId()
+		terraformVars := newTerraformVars(t, examplesDir).
+			Set(VAR_CONSUL_CLUSTER_NAME, fmt.Sprintf("consul-test-%s", uniqueId)).
+			Set(VAR_CONSUL_CLUSTER_TAG_KEY, fmt.Sprintf("consul-test-%s", uniqueId))
+		deployCluster(t, amiId, awsRegion, examplesDir, uniqueId, terraformVars)
+	})
+
+	test_structure.RunTestStage(t, "initialize_unseal", func() {
+		vaulttest.InitializeAndUnsealCluster(t, loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName))
+	})
+
+	test_structure.RunTestStage(t, "validate", func() {
+		clusterOptions := loadVaultClusterOptions(t, examplesDir, awsRegion, sshUserName)
+		tlsCert := loadTlsCert(t, WORK_DIR)
+
+		cluster := vaulttest.GetInitializedAndUnsealedCluster(t, clusterOptions)
+		validateVaultConfig(t, clusterOptions, vaultconfig.DefaultExpectations)
+
+		reports := rotateTlsCert(t, cluster, tlsCert)
+		test_structure.SaveTestData(t, test_structure.FormatTestDataPath(examplesDir, SAVED_TLS_ROTATION_AVAILABILITY), reports)
+
+		testVaultUsesConsulForDns(t, cluster)
+	})
+}
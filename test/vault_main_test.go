@@ -2,6 +2,7 @@ package test
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/aws"
@@ -79,13 +80,32 @@ var testCases = []testCase{
 		runVaultAgentTest,
 		false,
 	},
+	{
+		"TestVaultCertAuth",
+		runVaultCertAuthTest,
+		false,
+	},
+	{
+		"TestVaultAppRoleAuth",
+		runVaultAppRoleAuthTest,
+		false,
+	},
+	{
+		"TestVaultTlsRotation",
+		runVaultTlsRotationTest,
+		false,
+	},
 }
 
 func TestMainVaultCluster(t *testing.T) {
 	t.Parallel()
 
-	// For convenience - uncomment these as well as the "os" import
-	// when doing local testing if you need to skip any sections.
+	if testing.Short() {
+		t.Skip("Skipping the Vault cluster tests, which deploy real infrastructure to AWS, in short mode")
+	}
+
+	// For convenience - uncomment these when doing local testing if
+	// you need to skip any sections.
 
 	// os.Setenv("SKIP_setup_amis", "true")
 	// os.Setenv("SKIP_deploy", "true")
@@ -96,9 +116,13 @@ func TestMainVaultCluster(t *testing.T) {
 	// os.Setenv("SKIP_delete_amis", "true")
 
 	test_structure.RunTestStage(t, "setup_amis", func() {
-		tlsCert := generateSelfSignedTlsCert(t)
+		tlsCert := generateTlsCert(t, amiTlsCertOptions())
 		saveTlsCert(t, WORK_DIR, tlsCert)
 
+		// Packer has uploaded the binary by the time the builds finish, so it's only needed in this stage
+		signRequestBinaryPath := buildSignRequestBinary(t)
+		defer os.Remove(signRequestBinaryPath)
+
 		amisPackerOptions := map[string]*packer.Options{}
 		for _, ami := range amisData {
 			// Exclude a few regions as they are missing the instance types we use
@@ -107,9 +131,9 @@ func TestMainVaultCluster(t *testing.T) {
 			test_structure.SaveString(t, WORK_DIR, fmt.Sprintf("awsRegion-%s", ami.Name), awsRegion)
 
 			if ami.Enterprise {
-				amisPackerOptions[ami.Name] = composeAmiOptions(t, AMI_EXAMPLE_PATH, ami.PackerBuildName, tlsCert, awsRegion, getUrlFromEnv(t))
+				amisPackerOptions[ami.Name] = composeAmiOptions(t, AMI_EXAMPLE_PATH, ami.PackerBuildName, tlsCert, signRequestBinaryPath, awsRegion, getUrlFromEnv(t))
 			} else {
-				amisPackerOptions[ami.Name] = composeAmiOptions(t, AMI_EXAMPLE_PATH, ami.PackerBuildName, tlsCert, awsRegion, "")
+				amisPackerOptions[ami.Name] = composeAmiOptions(t, AMI_EXAMPLE_PATH, ami.PackerBuildName, tlsCert, signRequestBinaryPath, awsRegion, "")
 			}
 		}
 
@@ -0,0 +1,326 @@
+// Package vaultbootstrap applies the policies, auth methods and roles declared in a directory of files to a Vault
+// cluster through the Vault API, rather than with 'vault policy write' and 'vault write auth/...' calls in a shell
+// script. Applying is idempotent: it first plans what would change, so the plan can be reviewed, and only writes what
+// differs from what's already in Vault.
+//
+// The directory looks like this:
+//
+//	policies/example-policy.hcl   The policy example-policy, in Vault's policy syntax
+//	auth/aws.yaml                 The auth method at auth/aws and its roles, in YAML or JSON
+//	auth/approle.json
+//
+// An auth method file declares the type of the auth method and its roles, with the parameters the role endpoint of
+// the auth method takes:
+//
+//	type: aws
+//	description: Logins from EC2 Instances
+//	roles:
+//	  example-role:
+//	    auth_type: ec2
+//	    policies: example-policy
+//	    bound_ami_id: ami-0123456789abcdef0
+//	    max_ttl: 500h
+//
+// The auth method is mounted at the name of the file, unless the file sets path. The roles are written to
+// auth/PATH/role/NAME, the endpoint most auth methods use, unless the file sets role_endpoint, e.g. to certs for the cert
+// auth method. Policies and roles that are in Vault but not in the directory are left alone.
+//
+// Values that are only known once the cluster is deployed, such as the ARN of an IAM role, can be left as ${NAME} in
+// the strings of the auth method files, including the names of roles, and passed in as variables. Variables are only
+// filled in once the file is parsed, so a ${NAME} in a comment is left alone, and the value always ends up in a string:
+//
+//	bound_iam_principal_arn: ${client_role_arn}
+package vaultbootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"sigs.k8s.io/yaml"
+)
+
+// The folders in the bootstrap directory
+const PoliciesDir = "policies"
+const AuthDir = "auth"
+
+// The endpoint most auth methods manage their roles at, e.g. auth/aws/role/NAME
+const DefaultRoleEndpoint = "role"
+
+// Policy is an ACL policy and its rules
+type Policy struct {
+	Name  string `json:"name"`
+	Rules string `json:"rules"`
+}
+
+// Role is a role of an auth method, with the parameters to write to its role endpoint
+type Role struct {
+	Name       string                 `json:"name"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// AuthMethod is an auth method mounted at auth/Path, and its roles
+type AuthMethod struct {
+	Path         string `json:"path"`
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	RoleEndpoint string `json:"role_endpoint"`
+	Roles        []Role `json:"roles,omitempty"`
+}
+
+// RolePath returns the path of the endpoint for the role with the given name, e.g. auth/aws/role/example-role
+func (method AuthMethod) RolePath(roleName string) string {
+	return fmt.Sprintf("auth/%s/%s/%s", method.Path, method.RoleEndpoint, roleName)
+}
+
+// Config is everything declared in a bootstrap directory, sorted by name
+type Config struct {
+	Policies    []Policy     `json:"policies"`
+	AuthMethods []AuthMethod `json:"auth_methods"`
+}
+
+// The format of an auth method file
+type authMethodFile struct {
+	Path         string                            `json:"path"`
+	Type         string                            `json:"type"`
+	Description  string                            `json:"description"`
+	RoleEndpoint string                            `json:"role_endpoint"`
+	Roles        map[string]map[string]interface{} `json:"roles"`
+}
+
+// A variable in an auth method file, e.g. ${client_role_arn}
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadDir reads the policies and auth methods in the given bootstrap directory. Either folder may be missing.
+func LoadDir(dir string) (*Config, error) {
+	return LoadDirWithVars(dir, nil)
+}
+
+// LoadDirWithVars reads the policies and auth methods in the given bootstrap directory, replacing each ${NAME} in the
+// strings of the auth method files with the value of the variable NAME. A variable that isn't set is an error.
+func LoadDirWithVars(dir string, vars map[string]string) (*Config, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	config := &Config{Policies: []Policy{}, AuthMethods: []AuthMethod{}}
+
+	policyFiles, err := listFiles(filepath.Join(dir, PoliciesDir), ".hcl")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range policyFiles {
+		policy, err := loadPolicy(file)
+		if err != nil {
+			return nil, err
+		}
+		config.Policies = append(config.Policies, policy)
+	}
+
+	authFiles, err := listFiles(filepath.Join(dir, AuthDir), ".yaml", ".yml", ".json")
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, file := range authFiles {
+		method, err := loadAuthMethod(file, vars)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := paths[method.Path]; ok {
+			return nil, fmt.Errorf("%s and %s both declare the auth method at auth/%s", other, file, method.Path)
+		}
+		paths[method.Path] = file
+		config.AuthMethods = append(config.AuthMethods, method)
+	}
+
+	sort.Slice(config.AuthMethods, func(i, j int) bool { return config.AuthMethods[i].Path < config.AuthMethods[j].Path })
+	return config, nil
+}
+
+// List the files with one of the given extensions in the given folder, sorted by name. A missing folder has no files.
+func listFiles(dir string, extensions ...string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, extension := range extensions {
+			if filepath.Ext(entry.Name()) == extension {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// Load the policy in the given file, named after the file. The rules are checked to be valid HCL, so a typo fails the
+// plan rather than the write halfway through applying it.
+func loadPolicy(file string) (Policy, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	if _, diags := hclsyntax.ParseConfig(contents, file, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+		return Policy{}, fmt.Errorf("Invalid policy in %s: %v", file, diags)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return Policy{Name: name, Rules: string(contents)}, nil
+}
+
+// Load the auth method in the given YAML or JSON file, with the given variables filled in
+func loadAuthMethod(file string, vars map[string]string) (AuthMethod, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return AuthMethod{}, err
+	}
+
+	// JSON is valid YAML, so both go through the same conversion
+	jsonContents, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return AuthMethod{}, fmt.Errorf("Invalid auth method in %s: %v", file, err)
+	}
+
+	jsonContents, err = replaceVariables(jsonContents, vars)
+	if err != nil {
+		return AuthMethod{}, fmt.Errorf("Invalid auth method in %s: %v", file, err)
+	}
+
+	parsed := authMethodFile{}
+	decoder := json.NewDecoder(strings.NewReader(string(jsonContents)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&parsed); err != nil {
+		return AuthMethod{}, fmt.Errorf("Invalid auth method in %s: %v", file, err)
+	}
+
+	if parsed.Type == "" {
+		return AuthMethod{}, fmt.Errorf("Invalid auth method in %s: type is required", file)
+	}
+
+	method := AuthMethod{
+		Path:         strings.Trim(parsed.Path, "/"),
+		Type:         parsed.Type,
+		Description:  parsed.Description,
+		RoleEndpoint: strings.Trim(parsed.RoleEndpoint, "/"),
+		Roles:        []Role{},
+	}
+	if method.Path == "" {
+		method.Path = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if method.RoleEndpoint == "" {
+		method.RoleEndpoint = DefaultRoleEndpoint
+	}
+
+	for name, parameters := range parsed.Roles {
+		if parameters == nil {
+			parameters = map[string]interface{}{}
+		}
+		method.Roles = append(method.Roles, Role{Name: name, Parameters: parameters})
+	}
+	sort.Slice(method.Roles, func(i, j int) bool { return method.Roles[i].Name < method.Roles[j].Name })
+
+	return method, nil
+}
+
+// Replace each ${NAME} in the strings of the given JSON, including the keys of objects such as the names of roles, with
+// the value of the variable NAME. As this works on the parsed file, a ${NAME} in a YAML comment is left alone, and a
+// value can't change the structure of the file: it's always filled in as (part of) a string.
+func replaceVariables(jsonContents []byte, vars map[string]string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(jsonContents))
+	// Keep the numbers as they're written, rather than round them through a float64
+	decoder.UseNumber()
+
+	var parsed interface{}
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	replaceString := func(value string) string {
+		return variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+			name := variablePattern.FindStringSubmatch(match)[1]
+			replacement, ok := vars[name]
+			if !ok {
+				missing = appendIfMissing(missing, name)
+				return match
+			}
+			return replacement
+		})
+	}
+
+	replaced, err := replaceVariablesInValue(parsed, replaceString)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("variables not set: %s", strings.Join(missing, ", "))
+	}
+	return json.Marshal(replaced)
+}
+
+// Call replaceString on every string in the given parsed JSON value. The keys of objects are visited in order, so the
+// variables that aren't set are reported in the order they appear in, for the most part.
+func replaceVariablesInValue(value interface{}, replaceString func(string) string) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		return replaceString(value), nil
+	case []interface{}:
+		replaced := make([]interface{}, len(value))
+		for i, item := range value {
+			replacedItem, err := replaceVariablesInValue(item, replaceString)
+			if err != nil {
+				return nil, err
+			}
+			replaced[i] = replacedItem
+		}
+		return replaced, nil
+	case map[string]interface{}:
+		replaced := map[string]interface{}{}
+		for _, key := range sortedKeys(value) {
+			replacedKey := replaceString(key)
+			if _, ok := replaced[replacedKey]; ok {
+				return nil, fmt.Errorf("%s is declared more than once after filling in the variables", replacedKey)
+			}
+			replacedItem, err := replaceVariablesInValue(value[key], replaceString)
+			if err != nil {
+				return nil, err
+			}
+			replaced[replacedKey] = replacedItem
+		}
+		return replaced, nil
+	default:
+		return value, nil
+	}
+}
+
+// Append the given item to the given list, unless it's already in there
+func appendIfMissing(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
@@ -0,0 +1,394 @@
+package vaultbootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Action is what applying a change does
+type Action string
+
+const (
+	Create   Action = "create"
+	Update   Action = "update"
+	NoChange Action = "no-change"
+)
+
+// Kind is the kind of thing a change applies to
+type Kind string
+
+const (
+	KindPolicy     Kind = "policy"
+	KindAuthMethod Kind = "auth"
+	KindRole       Kind = "role"
+)
+
+// Change is what applying a plan does to a single policy, auth method or role. Diff is in the format of a unified diff:
+// "+ " for what's added, "- " for what's removed, "  " for the lines of a policy that stay the same, and "~ " for a
+// parameter that changes.
+type Change struct {
+	Action Action   `json:"action"`
+	Kind   Kind     `json:"kind"`
+	Path   string   `json:"path"`
+	Diff   []string `json:"diff,omitempty"`
+
+	apply func(client *api.Client) error
+}
+
+// Plan is the list of changes it takes to make Vault match a Config, in the order they're applied: policies first,
+// then auth methods, then their roles
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// Count the changes with the given action
+func (plan *Plan) Count(action Action) int {
+	count := 0
+	for _, change := range plan.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// HasChanges returns true if applying the plan would change anything in Vault
+func (plan *Plan) HasChanges() bool {
+	return plan.Count(NoChange) != len(plan.Changes)
+}
+
+// Write the changes in the plan to the given writer, for humans, followed by a summary. Changes that do nothing are
+// only counted.
+func (plan *Plan) Write(w io.Writer) {
+	for _, change := range plan.Changes {
+		if change.Action == NoChange {
+			continue
+		}
+
+		symbol := "~"
+		if change.Action == Create {
+			symbol = "+"
+		}
+		fmt.Fprintf(w, "%s %s %s %s\n", symbol, change.Action, change.Kind, change.Path)
+		for _, line := range change.Diff {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d unchanged.\n", plan.Count(Create), plan.Count(Update), plan.Count(NoChange))
+}
+
+// Apply the changes in the plan, in order, stopping at the first one that fails
+func (plan *Plan) Apply(client *api.Client) error {
+	for _, change := range plan.Changes {
+		if change.Action == NoChange {
+			continue
+		}
+		if err := change.apply(client); err != nil {
+			return fmt.Errorf("Failed to %s %s %s: %v", change.Action, change.Kind, change.Path, err)
+		}
+	}
+	return nil
+}
+
+// NewPlan compares the given config with what's in the Vault the given client talks to, and returns the changes it
+// takes to make Vault match the config. It only reads from Vault. The client needs a token that can read and write
+// sys/policies/acl, sys/auth and the role endpoints of the auth methods.
+func NewPlan(client *api.Client, config *Config) (*Plan, error) {
+	plan := &Plan{Changes: []Change{}}
+
+	for _, policy := range config.Policies {
+		change, err := planPolicy(client, policy)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	mounts, err := client.Sys().ListAuth()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the auth methods: %v", err)
+	}
+
+	roleChanges := []Change{}
+	for _, method := range config.AuthMethods {
+		change, err := planAuthMethod(mounts, method)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, change)
+
+		for _, role := range method.Roles {
+			// The role can't exist if the auth method doesn't yet, so there's nothing to read
+			roleChange, err := planRole(client, method, role, change.Action == Create)
+			if err != nil {
+				return nil, err
+			}
+			roleChanges = append(roleChanges, roleChange)
+		}
+	}
+
+	plan.Changes = append(plan.Changes, roleChanges...)
+	return plan, nil
+}
+
+// Apply makes Vault match the given config and returns the plan it applied
+func Apply(client *api.Client, config *Config) (*Plan, error) {
+	plan, err := NewPlan(client, config)
+	if err != nil {
+		return nil, err
+	}
+	return plan, plan.Apply(client)
+}
+
+func planPolicy(client *api.Client, policy Policy) (Change, error) {
+	change := Change{Kind: KindPolicy, Path: policy.Name, apply: func(client *api.Client) error {
+		return client.Sys().PutPolicy(policy.Name, policy.Rules)
+	}}
+
+	// GetPolicy returns an empty policy for one that doesn't exist
+	current, err := client.Sys().GetPolicy(policy.Name)
+	if err != nil {
+		return change, fmt.Errorf("Failed to read the policy %s: %v", policy.Name, err)
+	}
+
+	desiredLines := splitLines(policy.Rules)
+	switch {
+	case current == "":
+		change.Action = Create
+		change.Diff = diffLines(nil, desiredLines)
+	case strings.TrimSpace(current) == strings.TrimSpace(policy.Rules):
+		change.Action = NoChange
+	default:
+		change.Action = Update
+		change.Diff = diffLines(splitLines(current), desiredLines)
+	}
+	return change, nil
+}
+
+func planAuthMethod(mounts map[string]*api.AuthMount, method AuthMethod) (Change, error) {
+	change := Change{Kind: KindAuthMethod, Path: method.Path}
+
+	// Vault lists the auth methods by their path with a trailing slash
+	current, ok := mounts[method.Path+"/"]
+	if !ok {
+		change.Action = Create
+		change.Diff = []string{"+ type: " + method.Type}
+		if method.Description != "" {
+			change.Diff = append(change.Diff, "+ description: "+strconv.Quote(method.Description))
+		}
+		change.apply = func(client *api.Client) error {
+			return client.Sys().EnableAuthWithOptions(method.Path, &api.EnableAuthOptions{Type: method.Type, Description: method.Description})
+		}
+		return change, nil
+	}
+
+	// Changing the type would mean disabling the auth method, which revokes every token it issued: that's not
+	// something to do as a side effect of a plan
+	if current.Type != method.Type {
+		return change, fmt.Errorf("The auth method at auth/%s is of type %s, not %s. Disable it first to change its type.", method.Path, current.Type, method.Type)
+	}
+
+	if current.Description == method.Description {
+		change.Action = NoChange
+		return change, nil
+	}
+
+	change.Action = Update
+	change.Diff = []string{fmt.Sprintf("~ description: %s => %s", strconv.Quote(current.Description), strconv.Quote(method.Description))}
+	change.apply = func(client *api.Client) error {
+		_, err := client.Logical().Write(fmt.Sprintf("sys/mounts/auth/%s/tune", method.Path), map[string]interface{}{"description": method.Description})
+		return err
+	}
+	return change, nil
+}
+
+func planRole(client *api.Client, method AuthMethod, role Role, authMethodIsNew bool) (Change, error) {
+	path := method.RolePath(role.Name)
+	change := Change{Kind: KindRole, Path: path, apply: func(client *api.Client) error {
+		_, err := client.Logical().Write(path, role.Parameters)
+		return err
+	}}
+
+	var current *api.Secret
+	if !authMethodIsNew {
+		secret, err := client.Logical().Read(path)
+		if err != nil {
+			return change, fmt.Errorf("Failed to read the role %s: %v", path, err)
+		}
+		current = secret
+	}
+
+	if current == nil {
+		change.Action = Create
+		for _, key := range sortedKeys(role.Parameters) {
+			change.Diff = append(change.Diff, fmt.Sprintf("+ %s: %s", key, formatValue(role.Parameters[key])))
+		}
+		return change, nil
+	}
+
+	change.Diff = diffRoleParameters(current.Data, role.Parameters)
+	change.Action = Update
+	if len(change.Diff) == 0 {
+		change.Action = NoChange
+	}
+	return change, nil
+}
+
+// Compare the parameters a role was declared with to what Vault returns for it. Only the declared parameters are
+// compared, as Vault returns every parameter of the role, with its default if it wasn't set.
+func diffRoleParameters(current map[string]interface{}, desired map[string]interface{}) []string {
+	diff := []string{}
+	for _, key := range sortedKeys(desired) {
+		currentValue, ok := current[key]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("+ %s: %s", key, formatValue(desired[key])))
+			continue
+		}
+		if !valuesEqual(desired[key], currentValue) {
+			diff = append(diff, fmt.Sprintf("~ %s: %s => %s", key, formatValue(currentValue), formatValue(desired[key])))
+		}
+	}
+	return diff
+}
+
+// Check whether a declared role parameter matches the value Vault returns for it. Vault accepts parameters in more
+// forms than it returns them in: lists can be given as comma-separated strings, and durations as strings such as
+// "500h", which Vault returns in seconds.
+func valuesEqual(desired interface{}, current interface{}) bool {
+	switch currentValue := current.(type) {
+	case []interface{}:
+		return stringListsEqual(toStringList(desired), toStringList(currentValue))
+	case json.Number:
+		if desiredString, ok := desired.(string); ok {
+			if duration, err := time.ParseDuration(desiredString); err == nil {
+				return currentValue.String() == strconv.FormatInt(int64(duration/time.Second), 10)
+			}
+		}
+	}
+	return formatScalar(desired) == formatScalar(current)
+}
+
+func toStringList(value interface{}) []string {
+	list := []string{}
+	switch value := value.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range value {
+			list = append(list, formatScalar(item))
+		}
+	case string:
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	default:
+		list = append(list, formatScalar(value))
+	}
+	return list
+}
+
+// Vault doesn't keep the order of most list parameters, e.g. the policies of a role
+func stringListsEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Format a scalar the same way whether it was parsed from YAML or JSON (a float64) or returned by Vault (a json.Number)
+func formatScalar(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// Format a value for the diff of a role
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return strconv.Quote(value)
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			items = append(items, formatValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return formatScalar(value)
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// Diff two lists of lines, keeping the lines in their longest common subsequence, and prefixing each line with "- "
+// if it's only in the old lines, "+ " if it's only in the new lines, or "  " if it's in both
+func diffLines(oldLines []string, newLines []string) []string {
+	// common[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	diff := []string{}
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			diff = append(diff, "  "+oldLines[i])
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || common[i+1][j] >= common[i][j+1]):
+			diff = append(diff, "- "+oldLines[i])
+			i++
+		default:
+			diff = append(diff, "+ "+newLines[j])
+			j++
+		}
+	}
+	return diff
+}
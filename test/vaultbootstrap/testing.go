@@ -0,0 +1,84 @@
+package vaultbootstrap
+
+import (
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/hashicorp/vault/api"
+)
+
+// PlanDir loads the bootstrap directory at the given path and returns the changes it takes to make the Vault the given
+// client talks to match it. Fails the test on errors.
+func PlanDir(t testing.TestingT, client *api.Client, dir string) *Plan {
+	return PlanDirWithVars(t, client, dir, nil)
+}
+
+// PlanDirE loads the bootstrap directory at the given path and returns the changes it takes to make the Vault the given
+// client talks to match it, logging them
+func PlanDirE(t testing.TestingT, client *api.Client, dir string) (*Plan, error) {
+	return PlanDirWithVarsE(t, client, dir, nil)
+}
+
+// PlanDirWithVars is PlanDir for a bootstrap directory whose auth method files use the given variables. Fails the test
+// on errors.
+func PlanDirWithVars(t testing.TestingT, client *api.Client, dir string, vars map[string]string) *Plan {
+	plan, err := PlanDirWithVarsE(t, client, dir, vars)
+	if err != nil {
+		t.Fatalf("Failed to plan the bootstrap of Vault from %s: %v", dir, err)
+	}
+	return plan
+}
+
+// PlanDirWithVarsE is PlanDirE for a bootstrap directory whose auth method files use the given variables
+func PlanDirWithVarsE(t testing.TestingT, client *api.Client, dir string, vars map[string]string) (*Plan, error) {
+	config, err := LoadDirWithVars(dir, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := NewPlan(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	logPlan(t, dir, plan)
+	return plan, nil
+}
+
+// ApplyDir makes the Vault the given client talks to match the bootstrap directory at the given path, and returns the
+// plan it applied. Fails the test on errors.
+func ApplyDir(t testing.TestingT, client *api.Client, dir string) *Plan {
+	return ApplyDirWithVars(t, client, dir, nil)
+}
+
+// ApplyDirE makes the Vault the given client talks to match the bootstrap directory at the given path, and returns the
+// plan it applied
+func ApplyDirE(t testing.TestingT, client *api.Client, dir string) (*Plan, error) {
+	return ApplyDirWithVarsE(t, client, dir, nil)
+}
+
+// ApplyDirWithVars is ApplyDir for a bootstrap directory whose auth method files use the given variables. Fails the
+// test on errors.
+func ApplyDirWithVars(t testing.TestingT, client *api.Client, dir string, vars map[string]string) *Plan {
+	plan, err := ApplyDirWithVarsE(t, client, dir, vars)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap Vault from %s: %v", dir, err)
+	}
+	return plan
+}
+
+// ApplyDirWithVarsE is ApplyDirE for a bootstrap directory whose auth method files use the given variables
+func ApplyDirWithVarsE(t testing.TestingT, client *api.Client, dir string, vars map[string]string) (*Plan, error) {
+	plan, err := PlanDirWithVarsE(t, client, dir, vars)
+	if err != nil {
+		return nil, err
+	}
+	return plan, plan.Apply(client)
+}
+
+func logPlan(t testing.TestingT, dir string, plan *Plan) {
+	var output strings.Builder
+	plan.Write(&output)
+	logger.Logf(t, "Changes to bootstrap Vault from %s:\n%s", dir, output.String())
+}
@@ -0,0 +1,462 @@
+package vaultbootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const examplePolicy = `path "secret/example_*" {
+  capabilities = ["read"]
+}
+`
+
+const exampleAwsAuth = `
+type: aws
+description: Logins from EC2 Instances
+roles:
+  example-role:
+    auth_type: ec2
+    policies: example-policy,other-policy
+    bound_ami_id: ami-0123456789abcdef0
+    max_ttl: 500h
+`
+
+const exampleAppRoleAuth = `{
+  "type": "approle",
+  "roles": {
+    "example-app": {
+      "token_policies": ["example-policy"],
+      "token_ttl": 3600,
+      "bind_secret_id": true
+    }
+  }
+}`
+
+func TestLoadDir(t *testing.T) {
+	t.Parallel()
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"policies/example-policy.hcl": examplePolicy,
+		"policies/README.md":          "Not a policy",
+		"auth/aws.yaml":               exampleAwsAuth,
+		"auth/approle.json":           exampleAppRoleAuth,
+		"auth/cert.yml":               "type: cert\npath: /certs/\nrole_endpoint: certs\n",
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadDir(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Policy{{Name: "example-policy", Rules: examplePolicy}}, config.Policies)
+
+	require.Len(t, config.AuthMethods, 3)
+	approle, aws, cert := config.AuthMethods[0], config.AuthMethods[1], config.AuthMethods[2]
+
+	assert.Equal(t, "approle", approle.Path)
+	assert.Equal(t, "auth/approle/role/example-app", approle.RolePath("example-app"))
+	assert.Equal(t, []Role{{Name: "example-app", Parameters: map[string]interface{}{
+		"token_policies": []interface{}{"example-policy"},
+		"token_ttl":      float64(3600),
+		"bind_secret_id": true,
+	}}}, approle.Roles)
+
+	assert.Equal(t, "aws", aws.Path)
+	assert.Equal(t, "aws", aws.Type)
+	assert.Equal(t, "Logins from EC2 Instances", aws.Description)
+	require.Len(t, aws.Roles, 1)
+	assert.Equal(t, "500h", aws.Roles[0].Parameters["max_ttl"])
+
+	assert.Equal(t, "certs", cert.Path)
+	assert.Equal(t, "auth/certs/certs/web", cert.RolePath("web"))
+	assert.Empty(t, cert.Roles)
+}
+
+func TestLoadDirRejectsInvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		files         map[string]string
+		expectedError string
+	}{
+		{"InvalidPolicy", map[string]string{"policies/broken.hcl": `path "secret/*" {`}, "Invalid policy in"},
+		{"InvalidYaml", map[string]string{"auth/aws.yaml": "type: [aws"}, "Invalid auth method in"},
+		{"UnknownField", map[string]string{"auth/aws.yaml": "type: aws\nrole:\n  example-role: {}\n"}, `unknown field "role"`},
+		{"MissingType", map[string]string{"auth/aws.yaml": "roles:\n  example-role: {}\n"}, "type is required"},
+		{"DuplicatePath", map[string]string{"auth/aws.yaml": "type: aws\n", "auth/ec2.yaml": "type: aws\npath: aws\n"}, "both declare the auth method at auth/aws"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeBootstrapDir(t, testCase.files)
+			defer os.RemoveAll(dir)
+
+			_, err := LoadDir(dir)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testCase.expectedError)
+		})
+	}
+}
+
+func TestLoadDirWithVars(t *testing.T) {
+	t.Parallel()
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"auth/aws.yaml": "type: aws\nroles:\n  ${role_name}:\n    auth_type: iam\n    bound_iam_principal_arn: ${role_arn}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadDirWithVars(dir, map[string]string{
+		"role_name": "example-role",
+		"role_arn":  "arn:aws:iam::123456789012:role/example",
+	})
+	require.NoError(t, err)
+	require.Len(t, config.AuthMethods, 1)
+	assert.Equal(t, []Role{{Name: "example-role", Parameters: map[string]interface{}{
+		"auth_type":               "iam",
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:role/example",
+	}}}, config.AuthMethods[0].Roles)
+
+	_, err = LoadDirWithVars(dir, map[string]string{"role_name": "example-role"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "variables not set: role_arn")
+
+	_, err = LoadDir(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "variables not set: role_name, role_arn")
+}
+
+func TestLoadDirWithVarsOnlyReplacesStrings(t *testing.T) {
+	t.Parallel()
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"auth/aws.yaml": `# Pass the ARN of the IAM role as ${role_arn}, e.g. --var role_arn=...
+type: aws
+roles:
+  example-role:
+    bound_iam_principal_arn: ${role_arn}
+    policies: "${policy}, other-policy"
+    ttl: 3600
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	// A value that would change the structure of the file if it were pasted into it
+	policy := "example-policy\nmax_ttl: 500h"
+	config, err := LoadDirWithVars(dir, map[string]string{
+		"role_arn": "arn:aws:iam::123456789012:role/example",
+		"policy":   policy,
+	})
+	require.NoError(t, err)
+	require.Len(t, config.AuthMethods, 1)
+	assert.Equal(t, []Role{{Name: "example-role", Parameters: map[string]interface{}{
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:role/example",
+		"policies":                policy + ", other-policy",
+		"ttl":                     float64(3600),
+	}}}, config.AuthMethods[0].Roles)
+}
+
+func TestLoadDirWithVarsDuplicateRoleName(t *testing.T) {
+	t.Parallel()
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"auth/aws.yaml": "type: aws\nroles:\n  ${role_name}:\n    auth_type: iam\n  example-role:\n    auth_type: ec2\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := LoadDirWithVars(dir, map[string]string{"role_name": "example-role"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "example-role is declared more than once")
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	vault := newFakeVault()
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	client := newTestClient(t, server.URL)
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"policies/example-policy.hcl": examplePolicy,
+		"auth/aws.yaml":               exampleAwsAuth,
+		"auth/approle.json":           exampleAppRoleAuth,
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadDir(dir)
+	require.NoError(t, err)
+
+	// Planning doesn't write anything
+	plan, err := NewPlan(client, config)
+	require.NoError(t, err)
+	assert.Equal(t, 0, vault.writes)
+	assert.Equal(t, 5, plan.Count(Create))
+	assert.True(t, plan.HasChanges())
+
+	var output bytes.Buffer
+	plan.Write(&output)
+	assert.Contains(t, output.String(), "+ create policy example-policy\n    + path \"secret/example_*\" {\n")
+	assert.Contains(t, output.String(), "+ create auth aws\n    + type: aws\n    + description: \"Logins from EC2 Instances\"\n")
+	assert.Contains(t, output.String(), "+ create role auth/aws/role/example-role\n    + auth_type: \"ec2\"\n")
+	assert.Contains(t, output.String(), "Plan: 5 to create, 0 to update, 0 unchanged.\n")
+
+	require.NoError(t, plan.Apply(client))
+	assert.Equal(t, examplePolicy, vault.policies["example-policy"])
+	assert.Equal(t, "aws", vault.authMethods["aws/"].Type)
+	assert.Equal(t, []interface{}{"example-policy", "other-policy"}, vault.roles["auth/aws/role/example-role"]["policies"])
+
+	// Vault returns the roles in a different form than they were written in, which must not count as a change
+	plan = ApplyDir(t, client, dir)
+	assert.False(t, plan.HasChanges(), "Expected applying the same directory again to change nothing, but got %+v", plan.Changes)
+	assert.Equal(t, 5, plan.Count(NoChange))
+	assert.Equal(t, 5, vault.writes)
+}
+
+func TestPlanUpdates(t *testing.T) {
+	t.Parallel()
+
+	vault := newFakeVault()
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	client := newTestClient(t, server.URL)
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"policies/example-policy.hcl": examplePolicy,
+		"auth/aws.yaml":               exampleAwsAuth,
+	})
+	defer os.RemoveAll(dir)
+
+	config, err := LoadDir(dir)
+	require.NoError(t, err)
+	_, err = Apply(client, config)
+	require.NoError(t, err)
+
+	config.Policies[0].Rules = strings.Replace(examplePolicy, `["read"]`, `["create", "read"]`, 1)
+	config.AuthMethods[0].Description = "Logins from the Vault AMI"
+	config.AuthMethods[0].Roles[0].Parameters["max_ttl"] = "24h"
+	config.AuthMethods[0].Roles[0].Parameters["ttl"] = "1h"
+
+	plan, err := NewPlan(client, config)
+	require.NoError(t, err)
+	assert.Equal(t, 3, plan.Count(Update))
+
+	assert.Equal(t, Change{Action: Update, Kind: KindPolicy, Path: "example-policy", Diff: []string{
+		`  path "secret/example_*" {`,
+		`-   capabilities = ["read"]`,
+		`+   capabilities = ["create", "read"]`,
+		`  }`,
+	}}, withoutApply(plan.Changes[0]))
+	assert.Equal(t, []string{`~ description: "Logins from EC2 Instances" => "Logins from the Vault AMI"`}, plan.Changes[1].Diff)
+	assert.Equal(t, []string{`~ max_ttl: 1800000 => "24h"`, `~ ttl: 0 => "1h"`}, plan.Changes[2].Diff)
+
+	require.NoError(t, plan.Apply(client))
+	assert.Equal(t, "Logins from the Vault AMI", vault.authMethods["aws/"].Description)
+
+	plan, err = NewPlan(client, config)
+	require.NoError(t, err)
+	assert.False(t, plan.HasChanges())
+}
+
+func TestPlanRejectsAuthMethodOfAnotherType(t *testing.T) {
+	t.Parallel()
+
+	vault := newFakeVault()
+	vault.authMethods["aws/"] = &api.AuthMount{Type: "approle"}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	_, err := NewPlan(newTestClient(t, server.URL), &Config{AuthMethods: []AuthMethod{{Path: "aws", Type: "aws", RoleEndpoint: DefaultRoleEndpoint}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is of type approle, not aws")
+}
+
+func TestValuesEqual(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, valuesEqual("500h", json.Number("1800000")))
+	assert.True(t, valuesEqual(float64(3600), json.Number("3600")))
+	assert.True(t, valuesEqual("a, b", []interface{}{"b", "a"}))
+	assert.True(t, valuesEqual([]interface{}{"a"}, []interface{}{"a"}))
+	assert.True(t, valuesEqual(true, true))
+	assert.True(t, valuesEqual("ec2", "ec2"))
+
+	assert.False(t, valuesEqual("24h", json.Number("1800000")))
+	assert.False(t, valuesEqual("a", []interface{}{"a", "b"}))
+	assert.False(t, valuesEqual(false, true))
+	assert.False(t, valuesEqual("iam", "ec2"))
+}
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"+ a", "+ b"}, diffLines(nil, []string{"a", "b"}))
+	assert.Equal(t, []string{"- a", "  b", "+ c"}, diffLines([]string{"a", "b"}, []string{"b", "c"}))
+	assert.Equal(t, []string{"  a", "  b"}, diffLines([]string{"a", "b"}, []string{"a", "b"}))
+}
+
+func withoutApply(change Change) Change {
+	change.apply = nil
+	return change
+}
+
+// Write the given files, by their path relative to the directory, to a new temp directory
+func writeBootstrapDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "vault-bootstrap")
+	require.NoError(t, err)
+
+	for path, contents := range files {
+		fullPath := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, ioutil.WriteFile(fullPath, []byte(contents), 0644))
+	}
+	return dir
+}
+
+func newTestClient(t *testing.T, address string) *api.Client {
+	config := api.DefaultConfig()
+	config.Address = address
+	config.MaxRetries = 0
+
+	client, err := api.NewClient(config)
+	require.NoError(t, err)
+	client.SetToken("root")
+	return client
+}
+
+// fakeVault implements the endpoints the bootstrapper uses, and stores roles the way Vault returns them: durations in
+// seconds, lists as lists, and every parameter of the role, whether it was set or not
+type fakeVault struct {
+	mutex       sync.Mutex
+	policies    map[string]string
+	authMethods map[string]*api.AuthMount
+	roles       map[string]map[string]interface{}
+	writes      int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{
+		policies:    map[string]string{},
+		authMethods: map[string]*api.AuthMount{"token/": {Type: "token", Description: "token based credentials"}},
+		roles:       map[string]map[string]interface{}{},
+	}
+}
+
+var fakeRoleDefaults = map[string]interface{}{"ttl": 0, "max_ttl": 0, "policies": []interface{}{}, "bound_ami_id": []interface{}{}}
+var fakeRoleListParameters = map[string]bool{"policies": true, "token_policies": true, "bound_ami_id": true}
+
+func (vault *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vault.mutex.Lock()
+	defer vault.mutex.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	body := map[string]interface{}{}
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vault.writes++
+	}
+
+	switch {
+	case strings.HasPrefix(path, "sys/policies/acl/"):
+		name := strings.TrimPrefix(path, "sys/policies/acl/")
+		if r.Method != http.MethodGet {
+			vault.policies[name] = body["policy"].(string)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		policy, ok := vault.policies[name]
+		if !ok {
+			writeJson(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"name": name, "policy": policy}})
+
+	case path == "sys/auth":
+		mounts := map[string]interface{}{}
+		for mountPath, mount := range vault.authMethods {
+			mounts[mountPath] = map[string]interface{}{"type": mount.Type, "description": mount.Description}
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"data": mounts})
+
+	case strings.HasPrefix(path, "sys/auth/"):
+		mountPath := strings.TrimPrefix(path, "sys/auth/") + "/"
+		vault.authMethods[mountPath] = &api.AuthMount{Type: body["type"].(string), Description: body["description"].(string)}
+		w.WriteHeader(http.StatusNoContent)
+
+	case strings.HasPrefix(path, "sys/mounts/auth/") && strings.HasSuffix(path, "/tune"):
+		mountPath := strings.TrimSuffix(strings.TrimPrefix(path, "sys/mounts/auth/"), "tune")
+		vault.authMethods[mountPath].Description = body["description"].(string)
+		w.WriteHeader(http.StatusNoContent)
+
+	case strings.HasPrefix(path, "auth/"):
+		if r.Method != http.MethodGet {
+			vault.writeRole(path, body)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		role, ok := vault.roles[path]
+		if !ok {
+			writeJson(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"data": role})
+
+	default:
+		writeJson(w, http.StatusNotFound, map[string]interface{}{"errors": []string{"no handler for route " + path}})
+	}
+}
+
+func (vault *fakeVault) writeRole(path string, parameters map[string]interface{}) {
+	role, ok := vault.roles[path]
+	if !ok {
+		role = map[string]interface{}{}
+		for key, value := range fakeRoleDefaults {
+			role[key] = value
+		}
+		vault.roles[path] = role
+	}
+
+	for key, value := range parameters {
+		if text, ok := value.(string); ok {
+			if duration, err := time.ParseDuration(text); err == nil {
+				value = int64(duration / time.Second)
+			} else if fakeRoleListParameters[key] {
+				value = toInterfaces(toStringList(text))
+			}
+		}
+		role[key] = value
+	}
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := []interface{}{}
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,345 @@
+// Package vaultconfig parses the Vault server configuration file (default.hcl) written by the run-vault script and
+// checks that it is structurally what we expect for the flags run-vault was called with.
+package vaultconfig
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Stanza is a block in the Vault config, such as storage "consul" or listener "tcp", with its attributes converted to
+// strings. Unlabeled blocks, such as telemetry, have an empty Label. Blocks nested in a stanza, such as the telemetry
+// block of a listener, are in Blocks.
+type Stanza struct {
+	Type       string
+	Label      string
+	Attributes map[string]string
+	Blocks     []Stanza
+}
+
+// Config is the subset of a Vault server config that run-vault generates
+type Config struct {
+	Storage             []Stanza
+	HAStorage           []Stanza
+	Listeners           []Stanza
+	Seals               []Stanza
+	ServiceRegistration []Stanza
+	Telemetry           []Stanza
+	ApiAddr             string
+	ClusterAddr         string
+}
+
+// Expectations describe the run-vault flags a config was generated with
+type Expectations struct {
+	TlsCertFile string
+	TlsKeyFile  string
+	Port        int
+	ClusterPort int
+	AutoUnseal  bool
+	// Whether the listener requires clients to present a cert signed by TlsClientCAFile (or a system CA, if not set)
+	RequireClientCert bool
+	TlsClientCAFile   string
+	// The retention time run-vault was given with --enable-prometheus-metrics, or empty if it expects no telemetry
+	// stanza
+	PrometheusRetentionTime string
+	// Whether the listener allows requests to /v1/sys/metrics without a token
+	UnauthenticatedMetricsAccess bool
+}
+
+// DefaultExpectations are the run-vault flags used by all the examples in this repo: the TLS cert and key the Packer
+// template installs, the default ports, and no auto unseal
+var DefaultExpectations = Expectations{
+	TlsCertFile: "/opt/vault/tls/vault.crt.pem",
+	TlsKeyFile:  "/opt/vault/tls/vault.key.pem",
+	Port:        8200,
+	ClusterPort: 8201,
+	AutoUnseal:  false,
+}
+
+var configSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "api_addr"},
+		{Name: "cluster_addr"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "storage", LabelNames: []string{"type"}},
+		{Type: "ha_storage", LabelNames: []string{"type"}},
+		{Type: "listener", LabelNames: []string{"type"}},
+		{Type: "seal", LabelNames: []string{"type"}},
+		{Type: "service_registration", LabelNames: []string{"type"}},
+		{Type: "telemetry"},
+	},
+}
+
+// Parse the given contents of a Vault server config file. The file name is only used in error messages.
+func Parse(contents []byte, fileName string) (*Config, error) {
+	file, diags := hclsyntax.ParseConfig(contents, fileName, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	content, _, diags := file.Body.PartialContent(configSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	config := &Config{}
+
+	for _, block := range content.Blocks {
+		stanza, err := parseStanza(block)
+		if err != nil {
+			return nil, err
+		}
+
+		switch block.Type {
+		case "storage":
+			config.Storage = append(config.Storage, stanza)
+		case "ha_storage":
+			config.HAStorage = append(config.HAStorage, stanza)
+		case "listener":
+			config.Listeners = append(config.Listeners, stanza)
+		case "seal":
+			config.Seals = append(config.Seals, stanza)
+		case "service_registration":
+			config.ServiceRegistration = append(config.ServiceRegistration, stanza)
+		case "telemetry":
+			config.Telemetry = append(config.Telemetry, stanza)
+		}
+	}
+
+	if config.ApiAddr, diags = stringAttribute(content.Attributes, "api_addr"); diags.HasErrors() {
+		return nil, diags
+	}
+	if config.ClusterAddr, diags = stringAttribute(content.Attributes, "cluster_addr"); diags.HasErrors() {
+		return nil, diags
+	}
+
+	return config, nil
+}
+
+// Validate that the config matches the given expectations, returning an error that lists every problem found
+func (config *Config) Validate(expected Expectations) error {
+	problems := []string{}
+
+	if len(config.Storage) != 1 {
+		problems = append(problems, fmt.Sprintf("expected exactly one storage stanza, but found %d", len(config.Storage)))
+	}
+
+	if len(config.HAStorage) > 1 {
+		problems = append(problems, fmt.Sprintf("expected at most one ha_storage stanza, but found %d", len(config.HAStorage)))
+	}
+
+	if len(config.Listeners) != 1 || config.Listeners[0].Label != "tcp" {
+		problems = append(problems, fmt.Sprintf("expected exactly one tcp listener, but found %v", stanzaNames(config.Listeners)))
+	} else {
+		problems = append(problems, validateListener(config.Listeners[0], expected)...)
+	}
+
+	if err := checkAddrPort(config.ApiAddr, expected.Port); err != nil {
+		problems = append(problems, fmt.Sprintf("api_addr: %v", err))
+	}
+
+	if err := checkAddrPort(config.ClusterAddr, expected.ClusterPort); err != nil {
+		problems = append(problems, fmt.Sprintf("cluster_addr: %v", err))
+	}
+
+	if expected.AutoUnseal && len(config.Seals) != 1 {
+		problems = append(problems, fmt.Sprintf("expected exactly one seal stanza with auto unseal enabled, but found %v", stanzaNames(config.Seals)))
+	}
+
+	if !expected.AutoUnseal && len(config.Seals) != 0 {
+		problems = append(problems, fmt.Sprintf("expected no seal stanza with auto unseal disabled, but found %v", stanzaNames(config.Seals)))
+	}
+
+	problems = append(problems, validateTelemetry(config.Telemetry, expected)...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid Vault config: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func validateListener(listener Stanza, expected Expectations) []string {
+	problems := []string{}
+
+	// run-vault leaves the attribute out entirely unless client certs are required
+	requireClientCertValue := ""
+	if expected.RequireClientCert {
+		requireClientCertValue = "true"
+	}
+
+	expectedAttributes := []struct {
+		name  string
+		value string
+	}{
+		{"address", fmt.Sprintf("0.0.0.0:%d", expected.Port)},
+		{"cluster_address", fmt.Sprintf("0.0.0.0:%d", expected.ClusterPort)},
+		{"tls_cert_file", expected.TlsCertFile},
+		{"tls_key_file", expected.TlsKeyFile},
+		{"tls_require_and_verify_client_cert", requireClientCertValue},
+		{"tls_client_ca_file", expected.TlsClientCAFile},
+	}
+
+	for _, expectedAttribute := range expectedAttributes {
+		if actualValue := listener.Attributes[expectedAttribute.name]; actualValue != expectedAttribute.value {
+			problems = append(problems, fmt.Sprintf("expected listener %s to be %q, but got %q", expectedAttribute.name, expectedAttribute.value, actualValue))
+		}
+	}
+
+	// run-vault only adds a telemetry block to the listener if unauthenticated access to the metrics is allowed
+	unauthenticatedMetricsAccessValue := ""
+	if expected.UnauthenticatedMetricsAccess {
+		unauthenticatedMetricsAccessValue = "true"
+	}
+	actualUnauthenticatedMetricsAccessValue := ""
+	for _, block := range listener.Blocks {
+		if block.Type == "telemetry" {
+			actualUnauthenticatedMetricsAccessValue = block.Attributes["unauthenticated_metrics_access"]
+		}
+	}
+	if actualUnauthenticatedMetricsAccessValue != unauthenticatedMetricsAccessValue {
+		problems = append(problems, fmt.Sprintf("expected listener telemetry unauthenticated_metrics_access to be %q, but got %q", unauthenticatedMetricsAccessValue, actualUnauthenticatedMetricsAccessValue))
+	}
+
+	return problems
+}
+
+func validateTelemetry(telemetry []Stanza, expected Expectations) []string {
+	if expected.PrometheusRetentionTime == "" {
+		if len(telemetry) != 0 {
+			return []string{fmt.Sprintf("expected no telemetry stanza with Prometheus metrics disabled, but found %d", len(telemetry))}
+		}
+		return nil
+	}
+
+	if len(telemetry) != 1 {
+		return []string{fmt.Sprintf("expected exactly one telemetry stanza with Prometheus metrics enabled, but found %d", len(telemetry))}
+	}
+
+	problems := []string{}
+
+	// Without disable_hostname, Vault prefixes each metric with the hostname, so the names differ from node to node
+	expectedAttributes := []struct {
+		name  string
+		value string
+	}{
+		{"prometheus_retention_time", expected.PrometheusRetentionTime},
+		{"disable_hostname", "true"},
+	}
+
+	for _, expectedAttribute := range expectedAttributes {
+		if actualValue := telemetry[0].Attributes[expectedAttribute.name]; actualValue != expectedAttribute.value {
+			problems = append(problems, fmt.Sprintf("expected telemetry %s to be %q, but got %q", expectedAttribute.name, expectedAttribute.value, actualValue))
+		}
+	}
+
+	return problems
+}
+
+// Check that the given address is a URL with the given port
+func checkAddrPort(addr string, expectedPort int) error {
+	if addr == "" {
+		return fmt.Errorf("not set")
+	}
+
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+
+	_, port, err := net.SplitHostPort(parsed.Host)
+	if err != nil {
+		return fmt.Errorf("no port in %q", addr)
+	}
+
+	if port != strconv.Itoa(expectedPort) {
+		return fmt.Errorf("expected port %d in %q", expectedPort, addr)
+	}
+
+	return nil
+}
+
+func parseStanza(block *hcl.Block) (Stanza, error) {
+	stanza := Stanza{
+		Type:       block.Type,
+		Attributes: map[string]string{},
+	}
+	if len(block.Labels) > 0 {
+		stanza.Label = block.Labels[0]
+	}
+
+	// Parse always uses the native HCL syntax, whose bodies can be walked directly, nested blocks and all
+	body, isSyntaxBody := block.Body.(*hclsyntax.Body)
+	if !isSyntaxBody {
+		return stanza, fmt.Errorf("Unexpected body of %s stanza: %T", block.Type, block.Body)
+	}
+
+	attributes := hcl.Attributes{}
+	for name, attribute := range body.Attributes {
+		attributes[name] = attribute.AsHCLAttribute()
+	}
+
+	for _, nestedBlock := range body.Blocks {
+		nestedStanza, err := parseStanza(nestedBlock.AsHCLBlock())
+		if err != nil {
+			return stanza, err
+		}
+		stanza.Blocks = append(stanza.Blocks, nestedStanza)
+	}
+
+	for name := range attributes {
+		value, diags := stringAttribute(attributes, name)
+		if diags.HasErrors() {
+			return stanza, diags
+		}
+		stanza.Attributes[name] = value
+	}
+
+	return stanza, nil
+}
+
+// Read the given attribute as a string. Vault accepts unquoted numbers and bools in most places, so those are
+// converted to strings too. Returns an empty string if the attribute isn't set.
+func stringAttribute(attributes hcl.Attributes, name string) (string, hcl.Diagnostics) {
+	attribute, isSet := attributes[name]
+	if !isSet {
+		return "", nil
+	}
+
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	switch value.Type() {
+	case cty.String:
+		return value.AsString(), nil
+	case cty.Number:
+		return value.AsBigFloat().Text('f', -1), nil
+	case cty.Bool:
+		return strconv.FormatBool(value.True()), nil
+	default:
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported attribute value",
+			Detail:   fmt.Sprintf("Expected %s to be a string, number or bool, but got %s", name, value.Type().FriendlyName()),
+			Subject:  &attribute.Range,
+		}}
+	}
+}
+
+func stanzaNames(stanzas []Stanza) []string {
+	names := []string{}
+	for _, stanza := range stanzas {
+		names = append(names, fmt.Sprintf("%s %q", stanza.Type, stanza.Label))
+	}
+	return names
+}
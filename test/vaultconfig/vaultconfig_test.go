@@ -0,0 +1,191 @@
+package vaultconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfig = `
+ui = true
+
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+}
+
+storage "consul" {
+  address = "127.0.0.1:8500"
+  path    = "vault/"
+  scheme  = "http"
+  service = "vault"
+}
+# HA settings
+cluster_addr  = "https://10.0.0.10:8201"
+api_addr      = "https://10.0.0.10:8200"
+`
+
+const clientCertConfig = `
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+  tls_require_and_verify_client_cert = true
+  tls_client_ca_file = "/opt/vault/tls/ca.crt.pem"
+}
+
+storage "consul" {
+  address = "127.0.0.1:8500"
+}
+cluster_addr  = "https://10.0.0.10:8201"
+api_addr      = "https://10.0.0.10:8200"
+`
+
+const prometheusMetricsConfig = `
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/opt/vault/tls/vault.crt.pem"
+  tls_key_file    = "/opt/vault/tls/vault.key.pem"
+
+  telemetry {
+    unauthenticated_metrics_access = true
+  }
+}
+
+storage "consul" {
+  address = "127.0.0.1:8500"
+}
+cluster_addr  = "https://10.0.0.10:8201"
+api_addr      = "https://10.0.0.10:8200"
+
+telemetry {
+  prometheus_retention_time = "24h"
+  disable_hostname          = true
+}
+`
+
+const autoUnsealConfig = `
+seal "awskms" {
+  kms_key_id = "alias/my-vault-key"
+  region     = "us-east-1"
+}
+` + validConfig
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	config, err := Parse([]byte(autoUnsealConfig), "default.hcl")
+	require.NoError(t, err)
+
+	require.Len(t, config.Storage, 1)
+	assert.Equal(t, "consul", config.Storage[0].Label)
+	assert.Equal(t, "vault/", config.Storage[0].Attributes["path"])
+
+	require.Len(t, config.Listeners, 1)
+	assert.Equal(t, "/opt/vault/tls/vault.crt.pem", config.Listeners[0].Attributes["tls_cert_file"])
+
+	require.Len(t, config.Seals, 1)
+	assert.Equal(t, "awskms", config.Seals[0].Label)
+
+	assert.Equal(t, "https://10.0.0.10:8200", config.ApiAddr)
+	assert.Equal(t, "https://10.0.0.10:8201", config.ClusterAddr)
+}
+
+func TestParseTelemetry(t *testing.T) {
+	t.Parallel()
+
+	config, err := Parse([]byte(prometheusMetricsConfig), "default.hcl")
+	require.NoError(t, err)
+
+	require.Len(t, config.Telemetry, 1)
+	assert.Equal(t, "", config.Telemetry[0].Label)
+	assert.Equal(t, "24h", config.Telemetry[0].Attributes["prometheus_retention_time"])
+	assert.Equal(t, "true", config.Telemetry[0].Attributes["disable_hostname"])
+
+	require.Len(t, config.Listeners, 1)
+	require.Len(t, config.Listeners[0].Blocks, 1)
+	assert.Equal(t, "telemetry", config.Listeners[0].Blocks[0].Type)
+	assert.Equal(t, "true", config.Listeners[0].Blocks[0].Attributes["unauthenticated_metrics_access"])
+}
+
+func TestParseInvalidHcl(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse([]byte(`storage "consul" {`), "default.hcl")
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	autoUnsealExpectations := DefaultExpectations
+	autoUnsealExpectations.AutoUnseal = true
+
+	otherPortExpectations := DefaultExpectations
+	otherPortExpectations.Port = 9200
+
+	otherCertExpectations := DefaultExpectations
+	otherCertExpectations.TlsCertFile = "/opt/vault/tls/other.crt.pem"
+
+	clientCertExpectations := DefaultExpectations
+	clientCertExpectations.RequireClientCert = true
+	clientCertExpectations.TlsClientCAFile = "/opt/vault/tls/ca.crt.pem"
+
+	prometheusMetricsExpectations := DefaultExpectations
+	prometheusMetricsExpectations.PrometheusRetentionTime = "24h"
+	prometheusMetricsExpectations.UnauthenticatedMetricsAccess = true
+
+	otherRetentionExpectations := prometheusMetricsExpectations
+	otherRetentionExpectations.PrometheusRetentionTime = "1h"
+
+	authenticatedMetricsExpectations := prometheusMetricsExpectations
+	authenticatedMetricsExpectations.UnauthenticatedMetricsAccess = false
+
+	testCases := []struct {
+		name          string
+		config        string
+		expectations  Expectations
+		expectedError string
+	}{
+		{"Valid", validConfig, DefaultExpectations, ""},
+		{"ValidAutoUnseal", autoUnsealConfig, autoUnsealExpectations, ""},
+		{"MissingSeal", validConfig, autoUnsealExpectations, "expected exactly one seal stanza with auto unseal enabled"},
+		{"UnexpectedSeal", autoUnsealConfig, DefaultExpectations, `expected no seal stanza with auto unseal disabled, but found [seal "awskms"]`},
+		{"TwoStorageStanzas", validConfig + `storage "s3" {}`, DefaultExpectations, "expected exactly one storage stanza, but found 2"},
+		{"NoStorageStanza", `api_addr = "https://10.0.0.10:8200"`, DefaultExpectations, "expected exactly one storage stanza, but found 0"},
+		{"WrongPort", validConfig, otherPortExpectations, `expected listener address to be "0.0.0.0:9200"`},
+		{"WrongApiAddrPort", validConfig, otherPortExpectations, `api_addr: expected port 9200 in "https://10.0.0.10:8200"`},
+		{"WrongCert", validConfig, otherCertExpectations, `expected listener tls_cert_file to be "/opt/vault/tls/other.crt.pem"`},
+		{"ValidClientCert", clientCertConfig, clientCertExpectations, ""},
+		{"MissingClientCert", validConfig, clientCertExpectations, `expected listener tls_require_and_verify_client_cert to be "true", but got ""`},
+		{"UnexpectedClientCert", clientCertConfig, DefaultExpectations, `expected listener tls_client_ca_file to be "", but got "/opt/vault/tls/ca.crt.pem"`},
+		{"ValidPrometheusMetrics", prometheusMetricsConfig, prometheusMetricsExpectations, ""},
+		{"MissingTelemetry", validConfig, prometheusMetricsExpectations, "expected exactly one telemetry stanza with Prometheus metrics enabled, but found 0"},
+		{"UnexpectedTelemetry", prometheusMetricsConfig, DefaultExpectations, "expected no telemetry stanza with Prometheus metrics disabled, but found 1"},
+		{"WrongRetentionTime", prometheusMetricsConfig, otherRetentionExpectations, `expected telemetry prometheus_retention_time to be "1h", but got "24h"`},
+		{"UnexpectedUnauthenticatedMetricsAccess", prometheusMetricsConfig, authenticatedMetricsExpectations, `expected listener telemetry unauthenticated_metrics_access to be "", but got "true"`},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			config, err := Parse([]byte(testCase.config), "default.hcl")
+			require.NoError(t, err)
+
+			err = config.Validate(testCase.expectations)
+			if testCase.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			}
+		})
+	}
+}
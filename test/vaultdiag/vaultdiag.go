@@ -0,0 +1,170 @@
+// Package vaultdiag builds diagnostic bundles: tarballs of the config, status and logs of a Vault node or of a whole
+// test run, with the secrets in them redacted and an index file that says what each file is and where it came from.
+package vaultdiag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The name of the index file at the top of each bundle
+const IndexFileName = "INDEX.txt"
+
+// What redacted secrets are replaced with
+const Redacted = "[REDACTED]"
+
+// A pattern of secrets and the replacement of its matches, which keeps the submatches that aren't secret, such as the
+// name of a key
+type redaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// The secrets that can end up in what the bundles collect: the root token in the user data log of the examples, the
+// private key of the EC2 Key Pair in the test data, AWS credentials, and so on. They're applied in order, so private
+// keys are replaced as a whole before the lines in them could match anything else, and values that start with [ or -,
+// such as what's already been redacted, are left alone.
+var redactions = []redaction{
+	{regexp.MustCompile(`-----BEGIN ([A-Z ]*)PRIVATE KEY-----[\s\S]*?-----END ([A-Z ]*)PRIVATE KEY-----`), "-----BEGIN ${1}PRIVATE KEY-----" + Redacted + "-----END ${2}PRIVATE KEY-----"},
+	{regexp.MustCompile(`\b(?:hv[sbr]|[sbr])\.[A-Za-z0-9_\-]{20,}`), Redacted},
+	{regexp.MustCompile(`(?i)(unseal key \d+:\s*)\S+`), "${1}" + Redacted},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`), Redacted},
+	{regexp.MustCompile(`(?i)((?:token|secret|secret_id|password|private_?key|secret_?access_?key|session_?token|unseal_keys?)["']?\s*[:=]\s*["']?)[^"'\s,}\]\[\-][^"'\s,}\]]*`), "${1}" + Redacted},
+}
+
+// Redact the secrets in the given contents, returning the redacted contents and how many secrets were replaced
+func Redact(contents string) (string, int) {
+	count := 0
+	for _, redaction := range redactions {
+		contents = redaction.pattern.ReplaceAllStringFunc(contents, func(match string) string {
+			replaced := redaction.pattern.ReplaceAllString(match, redaction.replacement)
+			if replaced != match {
+				count++
+			}
+			return replaced
+		})
+	}
+	return contents, count
+}
+
+// File is a file in a bundle
+type File struct {
+	// The path of the file in the bundle
+	Name string
+	// What the file is, for the index
+	Description string
+	// Where the contents came from, e.g. the command that printed them or the path of the file they were read from
+	Source string
+	// The contents, with the secrets redacted
+	Contents string
+	// How many secrets were redacted from the contents
+	Redactions int
+	// The error collecting the contents ran into, if any. Whatever output there was is still in Contents.
+	Error string
+}
+
+// Bundle is the files collected about a node or a test run
+type Bundle struct {
+	// The name of the bundle, which is also the folder the files are in in the tarball
+	Name string
+	// What the bundle is about, for the index
+	Description string
+	Files       []File
+}
+
+// NewBundle returns an empty bundle with the given name and description
+func NewBundle(name string, description string) *Bundle {
+	return &Bundle{Name: name, Description: description, Files: []File{}}
+}
+
+// Add a file with the given contents to the bundle, redacting the secrets in them. If collecting the contents failed,
+// pass the error: it's recorded in the index, and whatever contents there are are still added.
+func (bundle *Bundle) Add(name string, description string, source string, contents string, err error) {
+	redacted, count := Redact(contents)
+	file := File{
+		Name:        name,
+		Description: description,
+		Source:      source,
+		Contents:    redacted,
+		Redactions:  count,
+	}
+	if err != nil {
+		file.Error = err.Error()
+	}
+	bundle.Files = append(bundle.Files, file)
+}
+
+// Index returns the contents of the index file: a line per file with its name, size and description, and where it
+// came from, how many secrets were redacted from it and what went wrong collecting it, if anything did
+func (bundle *Bundle) Index() string {
+	files := append([]File{}, bundle.Files...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%s\n%s\n\n", bundle.Name, bundle.Description)
+	fmt.Fprintf(builder, "Secrets such as tokens, unseal keys, private keys and AWS credentials are replaced with %s.\n\n", Redacted)
+
+	for _, file := range files {
+		fmt.Fprintf(builder, "%s (%d bytes): %s\n", file.Name, len(file.Contents), file.Description)
+		fmt.Fprintf(builder, "    from: %s\n", file.Source)
+		if file.Redactions > 0 {
+			fmt.Fprintf(builder, "    redacted: %d\n", file.Redactions)
+		}
+		if file.Error != "" {
+			fmt.Fprintf(builder, "    error: %s\n", file.Error)
+		}
+	}
+
+	return builder.String()
+}
+
+// WriteTarGz writes the index and the files of the bundle to the given writer as a gzipped tarball, in a folder named
+// after the bundle
+func (bundle *Bundle) WriteTarGz(writer io.Writer) error {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+
+	entries := append([]File{{Name: IndexFileName, Contents: bundle.Index()}}, bundle.Files...)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    path.Join(bundle.Name, entry.Name),
+			Mode:    0644,
+			Size:    int64(len(entry.Contents)),
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tarWriter, entry.Contents); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// WriteFile writes the bundle to a gzipped tarball at the given path
+func (bundle *Bundle) WriteFile(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := bundle.WriteTarGz(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,203 @@
+package vaultlog
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Kind is the reason an entry of a log was flagged
+type Kind string
+
+const (
+	// Vault panicked, or the Go runtime hit a fatal error
+	KindPanic Kind = "panic"
+	// The core of Vault logged that it failed to do something, e.g. to unseal or to take over as the active node
+	KindCoreFailure Kind = "core failure"
+	// Any other line logged at the ERROR level
+	KindError Kind = "error"
+	// The node was sealed or unsealed, or became the active node or a standby. These aren't problems, but show what
+	// the node went through around the problems.
+	KindSealTransition Kind = "seal transition"
+)
+
+// The messages the core logs when the node is sealed or unsealed, or changes from active to standby or back
+var sealTransitionMessages = []string{
+	"vault is sealed",
+	"vault is unsealed",
+	"marked as sealed",
+	"pre-seal teardown starting",
+	"post-unseal setup complete",
+	"entering standby mode",
+	"acquired lock, enabling active operation",
+	"stepping down from active operation to standby",
+}
+
+// The prefixes of the lines the Go runtime prints when Vault crashes
+var panicPrefixes = []string{"panic:", "fatal error:"}
+
+// AllowRule is a known-benign log message, which is still reported, but isn't counted as a problem
+type AllowRule struct {
+	// Matched against the module and message of each entry, as returned by Entry.Text
+	Pattern *regexp.Regexp
+	// Why the message is benign
+	Reason string
+}
+
+// DefaultAllowList has the messages the clusters in the examples of this repo are known to log while working fine
+var DefaultAllowList = []AllowRule{
+	{
+		Pattern: regexp.MustCompile(`TLS handshake error from .*: EOF`),
+		Reason:  "Health checks connect to the Vault port without speaking TLS",
+	},
+	{
+		Pattern: regexp.MustCompile(`^core\.cluster-listener: no TLS config found for ALPN`),
+		Reason:  "Standbys forward requests over the cluster port before a new active node has set it up, e.g. right after a step-down",
+	},
+}
+
+// Finding is an entry of a log that was flagged
+type Finding struct {
+	Kind  Kind
+	Entry Entry
+	// The reason of the AllowRule that matched the entry, or empty if none did
+	AllowedBecause string
+}
+
+// Allowed returns whether the finding matched a rule in the allow-list
+func (finding Finding) Allowed() bool {
+	return finding.AllowedBecause != ""
+}
+
+// Problem returns whether the finding is worth a look: it's not a seal transition, and not on the allow-list
+func (finding Finding) Problem() bool {
+	return finding.Kind != KindSealTransition && !finding.Allowed()
+}
+
+// Report is what Analyze found in a log
+type Report struct {
+	// Where the log came from, e.g. the path of the log file
+	Source string
+	// How many Vault lines the log had
+	EntryCount int
+	Findings   []Finding
+}
+
+// Analyze the entries of the log from the given source, checking the flagged entries against the given allow-list
+func Analyze(source string, entries []Entry, allowList []AllowRule) Report {
+	report := Report{Source: source, EntryCount: len(entries), Findings: []Finding{}}
+
+	for _, entry := range entries {
+		kind, flagged := classify(entry)
+		if !flagged {
+			continue
+		}
+
+		finding := Finding{Kind: kind, Entry: entry}
+		if kind != KindSealTransition {
+			for _, rule := range allowList {
+				if rule.Pattern.MatchString(entry.Text()) {
+					finding.AllowedBecause = rule.Reason
+					break
+				}
+			}
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+
+	return report
+}
+
+// Work out why the given entry should be flagged, if it should. A failure of the core is usually logged at the ERROR
+// level, so it's checked before the level.
+func classify(entry Entry) (Kind, bool) {
+	if !entry.Structured() {
+		for _, prefix := range panicPrefixes {
+			if strings.HasPrefix(entry.Message, prefix) {
+				return KindPanic, true
+			}
+		}
+		return "", false
+	}
+
+	if entry.Module == "core" && strings.HasPrefix(entry.Message, "failed to") {
+		return KindCoreFailure, true
+	}
+
+	if entry.Level == LevelError {
+		return KindError, true
+	}
+
+	if entry.Module == "core" {
+		for _, message := range sealTransitionMessages {
+			if entry.Message == message {
+				return KindSealTransition, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Problems returns the findings that are worth a look: everything but the seal transitions and the allowed messages
+func (report Report) Problems() []Finding {
+	problems := []Finding{}
+	for _, finding := range report.Findings {
+		if finding.Problem() {
+			problems = append(problems, finding)
+		}
+	}
+	return problems
+}
+
+// Count returns how many findings of the given kind there are, allowed or not
+func (report Report) Count(kind Kind) int {
+	count := 0
+	for _, finding := range report.Findings {
+		if finding.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Write a summary of the report, with a line per finding in the order they were logged
+func (report Report) Write(writer io.Writer) error {
+	_, err := fmt.Fprintf(writer, "%s: %d lines, %d problems (%d panics, %d core failures, %d errors), %d seal transitions\n",
+		report.Source,
+		report.EntryCount,
+		len(report.Problems()),
+		report.Count(KindPanic),
+		report.Count(KindCoreFailure),
+		report.Count(KindError),
+		report.Count(KindSealTransition))
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range report.Findings {
+		line := fmt.Sprintf("  line %d: [%s] %s", finding.Entry.LineNumber, finding.Kind, finding.Entry.Text())
+		if !finding.Entry.Timestamp.IsZero() {
+			line = fmt.Sprintf("  line %d: %s [%s] %s", finding.Entry.LineNumber, finding.Entry.Timestamp.Format("15:04:05.000"), finding.Kind, finding.Entry.Text())
+		}
+		if errorField := finding.Entry.Field("error"); errorField != "" {
+			line += fmt.Sprintf(" (error: %s)", errorField)
+		}
+		if finding.Allowed() {
+			line += fmt.Sprintf(" (allowed: %s)", finding.AllowedBecause)
+		}
+		if _, err := fmt.Fprintln(writer, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String returns the summary Write writes
+func (report Report) String() string {
+	builder := &strings.Builder{}
+	report.Write(builder)
+	return builder.String()
+}
@@ -0,0 +1,235 @@
+// Package vaultlog parses the logs of Vault, as collected from journalctl or the syslog of a node, and flags the lines
+// worth a look when a test fails: errors, panics, failures of the core, and the node being sealed and unsealed.
+package vaultlog
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The levels Vault logs at
+const (
+	LevelTrace = "TRACE"
+	LevelDebug = "DEBUG"
+	LevelInfo  = "INFO"
+	LevelWarn  = "WARN"
+	LevelError = "ERROR"
+)
+
+// The program name Vault logs with in journalctl and the syslog
+const VaultProgram = "vault"
+
+// The prefix journalctl and syslog add to each line, e.g. "May 04 10:00:00 ip-10-0-0-10 vault[1234]: "
+var syslogPrefixRegex = regexp.MustCompile(`^[A-Z][a-z]{2}\s+\d{1,2} \d{2}:\d{2}:\d{2} (\S+) ([^\s\[:]+)(?:\[\d+\])?: ?(.*)$`)
+
+// A line Vault logged itself, e.g. "2021-05-04T10:00:00.123Z [INFO]  core: vault is unsealed"
+var vaultLineRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})) \[(TRACE|DEBUG|INFO|WARN|ERROR)\]\s+(.*)$`)
+
+// Modules are dotted names, e.g. core, storage.consul or core.cluster-listener.tcp
+var moduleRegex = regexp.MustCompile(`^[a-z][a-z0-9_\-]*(?:\.[a-z0-9_\-]+)*$`)
+
+// Vault has logged timestamps both with and without a colon in the time zone offset
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"}
+
+// Field is a key/value pair Vault logged after the message, e.g. error="connection refused"
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Entry is a line of a Vault log. Lines Vault didn't log through its logger, such as the output of a panic, have no
+// Timestamp, Level or Module, and the whole line as their Message.
+type Entry struct {
+	// The line of the log file the entry is on, starting at 1
+	LineNumber int
+	Host       string
+	Program    string
+	Timestamp  time.Time
+	Level      string
+	Module     string
+	Message    string
+	Fields     []Field
+	// The line as it was in the log file
+	Raw string
+}
+
+// Structured returns whether Vault logged the entry through its logger, with a level
+func (entry Entry) Structured() bool {
+	return entry.Level != ""
+}
+
+// Field returns the value of the field with the given key, or an empty string if there's none
+func (entry Entry) Field(key string) string {
+	for _, field := range entry.Fields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Text returns the module and message of the entry the way Vault logs them, e.g. "core: vault is unsealed"
+func (entry Entry) Text() string {
+	if entry.Module == "" {
+		return entry.Message
+	}
+	return entry.Module + ": " + entry.Message
+}
+
+// Parse the given contents of a log file. Lines that journalctl or syslog attributes to programs other than Vault,
+// and the lines journalctl adds about the log itself, are skipped.
+func Parse(contents string) []Entry {
+	entries := []Entry{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	// Stack traces and large errors can be longer than the default limit of a line
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		entry, isVaultLine := ParseLine(scanner.Text())
+		if !isVaultLine {
+			continue
+		}
+		entry.LineNumber = lineNumber
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// ParseLine parses a line of a Vault log, with or without the prefix journalctl or syslog adds. Returns false if the
+// line is empty, a comment of journalctl, or was logged by a program other than Vault.
+func ParseLine(line string) (Entry, bool) {
+	entry := Entry{Raw: line}
+
+	text := strings.TrimRight(line, " \t\r")
+	if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "-- ") {
+		return entry, false
+	}
+
+	if matches := syslogPrefixRegex.FindStringSubmatch(text); matches != nil {
+		entry.Host = matches[1]
+		entry.Program = matches[2]
+		text = matches[3]
+		if entry.Program != VaultProgram {
+			return entry, false
+		}
+	}
+
+	matches := vaultLineRegex.FindStringSubmatch(text)
+	if matches == nil {
+		entry.Message = strings.TrimSpace(text)
+		return entry, true
+	}
+
+	entry.Timestamp = parseTimestamp(matches[1])
+	entry.Level = matches[2]
+	entry.Module, entry.Message, entry.Fields = splitMessage(matches[3])
+
+	return entry, true
+}
+
+func parseTimestamp(value string) time.Time {
+	for _, layout := range timestampLayouts {
+		if timestamp, err := time.Parse(layout, value); err == nil {
+			return timestamp
+		}
+	}
+	return time.Time{}
+}
+
+// Split what Vault logged after the level into the module, the message and the fields, e.g.
+// `storage.consul: check unable to talk with Consul backend: error="Unexpected response code: 500"`
+func splitMessage(text string) (string, string, []Field) {
+	module := ""
+	if separator := strings.Index(text, ": "); separator > 0 && moduleRegex.MatchString(text[:separator]) {
+		module = text[:separator]
+		text = text[separator+2:]
+	}
+
+	// The fields come after the last ": " that's followed by nothing but fields. Messages can contain ": " too, so
+	// try each one from the left.
+	searchFrom := 0
+	for {
+		separator := strings.Index(text[searchFrom:], ": ")
+		if separator < 0 {
+			break
+		}
+		separator += searchFrom
+
+		if fields, isFields := parseFields(text[separator+2:]); isFields {
+			return module, text[:separator], fields
+		}
+		searchFrom = separator + 2
+	}
+
+	// Vault logs a message with no fields without the separator
+	return module, text, nil
+}
+
+// Parse key=value pairs separated by spaces, where values with spaces are quoted as in Go. Returns false if the
+// text isn't only fields.
+func parseFields(text string) ([]Field, bool) {
+	fields := []Field{}
+
+	for {
+		text = strings.TrimLeft(text, " ")
+		if text == "" {
+			return fields, len(fields) > 0
+		}
+
+		equals := strings.Index(text, "=")
+		if equals <= 0 || strings.ContainsAny(text[:equals], " \"") {
+			return nil, false
+		}
+		key := text[:equals]
+		text = text[equals+1:]
+
+		value := ""
+		if strings.HasPrefix(text, `"`) {
+			end := closingQuote(text)
+			if end < 0 {
+				return nil, false
+			}
+			value = unquote(text[1:end])
+			text = text[end+1:]
+			if text != "" && !strings.HasPrefix(text, " ") {
+				return nil, false
+			}
+		} else {
+			end := strings.Index(text, " ")
+			if end < 0 {
+				end = len(text)
+			}
+			value = text[:end]
+			text = text[end:]
+		}
+
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+}
+
+// Return the index of the quote that closes the quoted string at the start of the given text, or -1 if it's not
+// closed
+func closingQuote(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// Undo the escaping of a quoted value. Only the escapes Vault's logger uses for quotes, backslashes and line breaks
+// are handled; anything else is left as it is.
+func unquote(text string) string {
+	replacer := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\n`, "\n", `\t`, "\t")
+	return replacer.Replace(text)
+}
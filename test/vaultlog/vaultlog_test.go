@@ -0,0 +1,145 @@
+package vaultlog
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An excerpt of what journalctl -u vault.service prints for a node that's unsealed, becomes the active node, has
+// trouble with Consul, and then panics
+const exampleJournal = `-- Logs begin at Tue 2021-05-04 09:58:00 UTC, end at Tue 2021-05-04 10:05:00 UTC. --
+May 04 10:00:00 ip-10-0-0-10 systemd[1]: Started HashiCorp Vault - A tool for managing secrets.
+May 04 10:00:00 ip-10-0-0-10 vault[1234]: ==> Vault server configuration:
+May 04 10:00:01 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:01.123Z [INFO]  proxy environment: http_proxy= https_proxy= no_proxy=
+May 04 10:00:02 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:02.000Z [INFO]  core: vault is unsealed
+May 04 10:00:02 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:02.100Z [INFO]  core: acquired lock, enabling active operation
+May 04 10:00:03 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:03.000Z [WARN]  storage.consul: check unable to talk with Consul backend: error="Unexpected response code: 500 (rpc error: No cluster leader)"
+May 04 10:00:04 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:04.000Z [ERROR] core: failed to acquire lock: error="failed to read lock: Unexpected response code: 500"
+May 04 10:00:05 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:05.000Z [ERROR] core.cluster-listener: no TLS config found for ALPN: ALPN=[req_fw_sb-act_v1]
+May 04 10:00:06 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:06.000Z [ERROR] expiration: error restoring leases: error="failed to scan for leases: list failed at path \"\": Unexpected response code: 500"
+May 04 10:00:07 ip-10-0-0-10 vault[1234]: panic: runtime error: invalid memory address or nil pointer dereference
+May 04 10:00:07 ip-10-0-0-10 vault[1234]: goroutine 1 [running]:
+May 04 10:00:08 ip-10-0-0-10 systemd[1]: vault.service: Main process exited, code=exited, status=2/INVALIDARGUMENT
+`
+
+func TestParseLine(t *testing.T) {
+	t.Parallel()
+
+	entry, isVaultLine := ParseLine(`May 04 10:00:03 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:03.000Z [WARN]  storage.consul: check unable to talk with Consul backend: error="Unexpected response code: 500 (rpc error: No cluster leader)" attempt=3`)
+	require.True(t, isVaultLine)
+
+	assert.Equal(t, "ip-10-0-0-10", entry.Host)
+	assert.Equal(t, VaultProgram, entry.Program)
+	assert.Equal(t, time.Date(2021, 5, 4, 10, 0, 3, 0, time.UTC), entry.Timestamp)
+	assert.Equal(t, LevelWarn, entry.Level)
+	assert.Equal(t, "storage.consul", entry.Module)
+	assert.Equal(t, "check unable to talk with Consul backend", entry.Message)
+	assert.Equal(t, []Field{{"error", "Unexpected response code: 500 (rpc error: No cluster leader)"}, {"attempt", "3"}}, entry.Fields)
+	assert.Equal(t, "3", entry.Field("attempt"))
+	assert.Equal(t, "", entry.Field("missing"))
+}
+
+func TestParseLineVariants(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		line            string
+		expectedModule  string
+		expectedMessage string
+		expectedFields  []Field
+	}{
+		{"NoPrefix", "2021-05-04T10:00:02.000Z [INFO]  core: vault is unsealed", "core", "vault is unsealed", nil},
+		{"OffsetWithoutColon", "2021-05-04T10:00:02.000+0000 [INFO]  core: vault is unsealed", "core", "vault is unsealed", nil},
+		{"NoModule", "2021-05-04T10:00:01.123Z [INFO]  proxy environment: http_proxy= https_proxy=", "", "proxy environment", []Field{{"http_proxy", ""}, {"https_proxy", ""}}},
+		{"ColonInMessage", "2021-05-04T10:00:01.123Z [INFO]  http: TLS handshake error from 10.0.0.5:43210: EOF", "http", "TLS handshake error from 10.0.0.5:43210: EOF", nil},
+		{"EscapedQuotes", `2021-05-04T10:00:06.000Z [ERROR] expiration: error restoring leases: error="list failed at path \"sys/\""`, "expiration", "error restoring leases", []Field{{"error", `list failed at path "sys/"`}}},
+		{"Syslog", "May  4 10:00:02 ip-10-0-0-10 vault[1234]: 2021-05-04T10:00:02.000Z [INFO]  core: vault is unsealed", "core", "vault is unsealed", nil},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			entry, isVaultLine := ParseLine(testCase.line)
+			require.True(t, isVaultLine)
+			assert.True(t, entry.Structured())
+			assert.Equal(t, 2021, entry.Timestamp.Year())
+			assert.Equal(t, testCase.expectedModule, entry.Module)
+			assert.Equal(t, testCase.expectedMessage, entry.Message)
+			assert.Equal(t, testCase.expectedFields, entry.Fields)
+		})
+	}
+}
+
+func TestParseSkipsOtherLines(t *testing.T) {
+	t.Parallel()
+
+	entries := Parse(exampleJournal)
+	require.Len(t, entries, 10)
+
+	assert.Equal(t, 3, entries[0].LineNumber)
+	assert.False(t, entries[0].Structured())
+	assert.Equal(t, "==> Vault server configuration:", entries[0].Message)
+
+	for _, entry := range entries {
+		assert.Equal(t, VaultProgram, entry.Program)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+
+	report := Analyze("vault-journalctl.log", Parse(exampleJournal), DefaultAllowList)
+	assert.Equal(t, 10, report.EntryCount)
+
+	kinds := []Kind{}
+	for _, finding := range report.Findings {
+		kinds = append(kinds, finding.Kind)
+	}
+	assert.Equal(t, []Kind{KindSealTransition, KindSealTransition, KindCoreFailure, KindError, KindError, KindPanic}, kinds)
+
+	allowed := report.Findings[3]
+	assert.Equal(t, "core.cluster-listener", allowed.Entry.Module)
+	assert.True(t, allowed.Allowed())
+	assert.False(t, allowed.Problem())
+
+	problems := report.Problems()
+	require.Len(t, problems, 3)
+	assert.Equal(t, "failed to acquire lock", problems[0].Entry.Message)
+	assert.Equal(t, "expiration", problems[1].Entry.Module)
+	assert.Equal(t, "panic: runtime error: invalid memory address or nil pointer dereference", problems[2].Entry.Message)
+}
+
+func TestAnalyzeWithCustomAllowList(t *testing.T) {
+	t.Parallel()
+
+	allowList := []AllowRule{{Pattern: regexp.MustCompile(`^expiration: error restoring leases`), Reason: "Consul has no leader yet"}}
+	report := Analyze("vault-journalctl.log", Parse(exampleJournal), allowList)
+
+	problems := report.Problems()
+	require.Len(t, problems, 3)
+	assert.Equal(t, "core.cluster-listener", problems[1].Entry.Module)
+	assert.Equal(t, 3, report.Count(KindError)+report.Count(KindCoreFailure))
+}
+
+func TestReportString(t *testing.T) {
+	t.Parallel()
+
+	report := Analyze("vault-journalctl.log", Parse(exampleJournal), DefaultAllowList)
+
+	expected := `vault-journalctl.log: 10 lines, 3 problems (1 panics, 1 core failures, 2 errors), 2 seal transitions
+  line 5: 10:00:02.000 [seal transition] core: vault is unsealed
+  line 6: 10:00:02.100 [seal transition] core: acquired lock, enabling active operation
+  line 8: 10:00:04.000 [core failure] core: failed to acquire lock (error: failed to read lock: Unexpected response code: 500)
+  line 9: 10:00:05.000 [error] core.cluster-listener: no TLS config found for ALPN (allowed: Standbys forward requests over the cluster port before a new active node has set it up, e.g. right after a step-down)
+  line 10: 10:00:06.000 [error] expiration: error restoring leases (error: failed to scan for leases: list failed at path "": Unexpected response code: 500)
+  line 11: [panic] panic: runtime error: invalid memory address or nil pointer dereference
+`
+	assert.Equal(t, expected, report.String())
+}
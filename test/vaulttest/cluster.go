@@ -0,0 +1,502 @@
+// Package vaulttest contains helpers for testing Vault clusters deployed with the vault-cluster module with
+// Terratest: finding the nodes of a cluster, initializing and unsealing it, checking the status of each node and
+// collecting their logs. The examples in this repo are tested with these helpers, and Terraform code that wraps the
+// modules in this repo can use them in its own tests.
+package vaulttest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/require"
+)
+
+// The name of the output with the name of the Vault ASG in the examples in this repo
+const DefaultAsgNameOutput = "asg_name_vault_cluster"
+
+// The number of Vault servers the helpers in this package expect a cluster to have if ClusterOptions.ClusterSize isn't
+// set, which is what the examples in this repo deploy
+const DefaultClusterSize = 3
+
+var unsealKeyRegex = regexp.MustCompile("^Unseal Key \\d: (.+)$")
+var rootTokenRegex = regexp.MustCompile("^Initial Root Token: (.+)$")
+
+// ClusterOptions tell the helpers in this package how to find the nodes of a Vault cluster and how to SSH to them
+type ClusterOptions struct {
+	// The name of the Vault ASG. If empty, it's read from the AsgNameOutput output of TerraformOptions.
+	AsgName string
+	// The options used to deploy the cluster, which are used to read the name of the Vault ASG
+	TerraformOptions *terraform.Options
+	// The name of the output with the name of the Vault ASG. Defaults to DefaultAsgNameOutput.
+	AsgNameOutput string
+	AwsRegion     string
+	// The number of Vault servers the cluster is expected to have. Defaults to DefaultClusterSize.
+	ClusterSize int
+	// Connect to the nodes on their private IP addresses, e.g. from a bastion host or over a VPN, rather than their
+	// public ones
+	UsePrivateIps bool
+	// The user to SSH to the nodes as, e.g. ubuntu or ec2-user
+	SshUserName string
+	// The EC2 Key Pair to SSH to the nodes with. Can be nil if SshAgent is set.
+	KeyPair *aws.Ec2Keypair
+	// SSH to the nodes with the keys in the local SSH agent
+	SshAgent bool
+}
+
+func (options ClusterOptions) asgNameOutput() string {
+	if options.AsgNameOutput == "" {
+		return DefaultAsgNameOutput
+	}
+	return options.AsgNameOutput
+}
+
+func (options ClusterOptions) clusterSize() int {
+	if options.ClusterSize == 0 {
+		return DefaultClusterSize
+	}
+	return options.ClusterSize
+}
+
+// GetAsgName returns the name of the Vault ASG, reading it from the Terraform outputs if AsgName isn't set
+func (options ClusterOptions) GetAsgName(t testing.TestingT) string {
+	if options.AsgName != "" {
+		return options.AsgName
+	}
+	return terraform.OutputRequired(t, options.TerraformOptions, options.asgNameOutput())
+}
+
+// GetAsgNameE returns the name of the Vault ASG, reading it from the Terraform outputs if AsgName isn't set, or an
+// error if the output can't be read
+func (options ClusterOptions) GetAsgNameE(t testing.TestingT) (string, error) {
+	if options.AsgName != "" {
+		return options.AsgName, nil
+	}
+	return terraform.OutputRequiredE(t, options.TerraformOptions, options.asgNameOutput())
+}
+
+// Host returns an ssh.Host to SSH to the node with the given IP address
+func (options ClusterOptions) Host(ipAddress string) ssh.Host {
+	host := ssh.Host{
+		Hostname:    ipAddress,
+		SshUserName: options.SshUserName,
+		SshAgent:    options.SshAgent,
+	}
+	if options.KeyPair != nil {
+		host.SshKeyPair = options.KeyPair.KeyPair
+	}
+	return host
+}
+
+// NodeIpAddresses returns the IP addresses of the nodes in the Vault ASG, sorted
+func (options ClusterOptions) NodeIpAddresses(t testing.TestingT) []string {
+	ips, err := options.NodeIpAddressesE(t)
+	require.NoError(t, err, "Failed to look up the IP addresses of the nodes in the Vault ASG")
+	return ips
+}
+
+// NodeIpAddressesE returns the IP addresses of the nodes in the Vault ASG, sorted, or an error if they can't be looked
+// up, e.g. because the cluster was never deployed
+func (options ClusterOptions) NodeIpAddressesE(t testing.TestingT) ([]string, error) {
+	instanceIdsToIps, err := options.NodeIpAddressesByInstanceIdE(t)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{}
+	for _, ip := range instanceIdsToIps {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	return ips, nil
+}
+
+// NodeIpAddressesByInstanceIdE returns the IP address of each node in the Vault ASG by its instance ID, or an error if
+// they can't be looked up
+func (options ClusterOptions) NodeIpAddressesByInstanceIdE(t testing.TestingT) (map[string]string, error) {
+	asgName, err := options.GetAsgNameE(t)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceIds, err := aws.GetInstanceIdsForAsgE(t, asgName, options.AwsRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.UsePrivateIps {
+		return aws.GetPrivateIpsOfEc2InstancesE(t, instanceIds, options.AwsRegion)
+	}
+	return aws.GetPublicIpsOfEc2InstancesE(t, instanceIds, options.AwsRegion)
+}
+
+// Cluster is a Vault cluster: its leader and the standbys. Until the cluster is initialized and unsealed, which node is
+// the Leader is arbitrary.
+type Cluster struct {
+	Leader     ssh.Host
+	Standbys   []ssh.Host
+	UnsealKeys []string
+	// The initial root token. Only InitializeVault knows it, so it's empty in a Cluster found any other way.
+	RootToken string
+}
+
+// Nodes returns all the nodes in the cluster, starting with the leader
+func (cluster Cluster) Nodes() []ssh.Host {
+	return append([]ssh.Host{cluster.Leader}, cluster.Standbys...)
+}
+
+// String returns the hostnames of the leader and the standbys, and leaves the unseal keys and the root token out, so
+// the cluster can be logged
+func (cluster Cluster) String() string {
+	standbys := []string{}
+	for _, standby := range cluster.Standbys {
+		standbys = append(standbys, standby.Hostname)
+	}
+	return fmt.Sprintf("[Leader: %s, Standbys: %s]", cluster.Leader.Hostname, strings.Join(standbys, ", "))
+}
+
+// GetIpAddressesOfAsgInstances returns the public IP addresses of the EC2 Instances in an Auto Scaling Group of the
+// given name in the given region
+func GetIpAddressesOfAsgInstances(t testing.TestingT, asgName string, awsRegion string) []string {
+	instanceIds := aws.GetInstanceIdsForAsg(t, asgName, awsRegion)
+	instanceIdsToIps := aws.GetPublicIpsOfEc2Instances(t, instanceIds, awsRegion)
+
+	ips := []string{}
+	for _, ip := range instanceIdsToIps {
+		ips = append(ips, ip)
+	}
+
+	return ips
+}
+
+// GetPrivateIpAddressesOfAsgInstances returns the private IP addresses of the EC2 Instances in an Auto Scaling Group
+// of the given name in the given region
+func GetPrivateIpAddressesOfAsgInstances(t testing.TestingT, asgName string, awsRegion string) []string {
+	instanceIds := aws.GetInstanceIdsForAsg(t, asgName, awsRegion)
+	instanceIdsToIps := aws.GetPrivateIpsOfEc2Instances(t, instanceIds, awsRegion)
+
+	ips := []string{}
+	for _, ip := range instanceIdsToIps {
+		ips = append(ips, ip)
+	}
+
+	return ips
+}
+
+// FindNodes returns the nodes in the Vault ASG, however many there are
+func FindNodes(t testing.TestingT, options ClusterOptions) []ssh.Host {
+	nodes := []ssh.Host{}
+	for _, ipAddress := range options.NodeIpAddresses(t) {
+		nodes = append(nodes, options.Host(ipAddress))
+	}
+	return nodes
+}
+
+// FindCluster finds the nodes in the Vault ASG and returns them in a Cluster, without checking their status. The
+// first node is used as the Leader.
+func FindCluster(t testing.TestingT, options ClusterOptions) Cluster {
+	nodeIpAddresses := findClusterIpAddresses(t, options)
+
+	cluster := Cluster{Leader: options.Host(nodeIpAddresses[0])}
+	for _, ipAddress := range nodeIpAddresses[1:] {
+		cluster.Standbys = append(cluster.Standbys, options.Host(ipAddress))
+	}
+	return cluster
+}
+
+// Look up the IP addresses of the nodes in the Vault ASG and fail the test if there aren't as many as the cluster is
+// expected to have
+func findClusterIpAddresses(t testing.TestingT, options ClusterOptions) []string {
+	nodeIpAddresses := options.NodeIpAddresses(t)
+	if len(nodeIpAddresses) != options.clusterSize() {
+		t.Fatalf("Expected to get %d IP addresses for Vault cluster, but got %d: %v", options.clusterSize(), len(nodeIpAddresses), nodeIpAddresses)
+	}
+	return nodeIpAddresses
+}
+
+// InitializeAndUnsealCluster initializes the Vault cluster and unseals each of the nodes by connecting to them over
+// SSH and executing Vault commands. The reason we use SSH rather than using the Vault client remotely is we want to
+// verify that the TLS certificate is properly configured on each server so when you're on that server, you don't get
+// errors about the certificate being signed by an unknown party.
+func InitializeAndUnsealCluster(t testing.TestingT, options ClusterOptions) Cluster {
+	cluster := FindCluster(t, options)
+
+	EstablishConnectionToCluster(t, cluster)
+	WaitForVaultToBoot(t, cluster)
+	InitializeVault(t, &cluster)
+
+	AssertStatus(t, cluster.Leader, Sealed)
+	UnsealNode(t, cluster.Leader, cluster.UnsealKeys)
+	AssertStatus(t, cluster.Leader, Leader)
+
+	for _, standby := range cluster.Standbys {
+		AssertStatus(t, standby, Sealed)
+		UnsealNode(t, standby, cluster.UnsealKeys)
+		AssertStatus(t, standby, Standby)
+	}
+
+	logger.Logf(t, "Successfully initialized and unsealed Vault Cluster: %s", cluster)
+
+	return cluster
+}
+
+// GetInitializedAndUnsealedCluster finds the nodes of a Vault cluster that was already initialized and unsealed, and
+// returns them in a Cluster with the actual leader as the Leader. Fails the test if any node isn't the leader, a
+// standby or a performance standby (Vault Enterprise).
+func GetInitializedAndUnsealedCluster(t testing.TestingT, options ClusterOptions) Cluster {
+	nodeIpAddresses := findClusterIpAddresses(t, options)
+
+	// FindCluster does not guarantee that the first node is the Leader, so check each node's status instead
+	cluster := Cluster{Leader: options.Host("")}
+
+	for _, node := range nodeIpAddresses {
+		if node == "" {
+			continue
+		}
+
+		description := fmt.Sprintf("Trying to establish SSH connection to %s", node)
+		logger.Logf(t, description)
+
+		// Connecting to each of the Vault cluster nodes must already work, so only retry a few times
+		host := options.Host(node)
+		retry.DoWithRetry(t, description, 3, 10*time.Second, func() (string, error) {
+			return "", ssh.CheckSshConnectionE(t, host)
+		})
+
+		status, err := GetNodeStatusE(t, host)
+		require.NoError(t, err, "Failed to check if vault cluster is already initialized and unsealed")
+
+		switch status {
+		case Leader:
+			cluster.Leader.Hostname = node
+			AssertStatus(t, cluster.Leader, Leader)
+		// Managing Performance Standby Nodes status
+		// https://www.vaultproject.io/docs/enterprise/performance-standby#performance-standby-nodes
+		case Standby, PerformanceStandby:
+			AssertStatus(t, host, status)
+			cluster.Standbys = append(cluster.Standbys, host)
+		default:
+			require.NoError(t, fmt.Errorf("error: Unexpected vault cluster node status %d", status), "Failed to check if vault cluster is already initialized and unsealed")
+		}
+	}
+
+	logger.Logf(t, "Retrieved Vault Cluster: %s", cluster)
+
+	return cluster
+}
+
+// EstablishConnectionToCluster waits until we can SSH to each of the nodes in the given cluster
+func EstablishConnectionToCluster(t testing.TestingT, cluster Cluster) {
+	for _, node := range cluster.Nodes() {
+		if node.Hostname == "" {
+			continue
+		}
+
+		description := fmt.Sprintf("Trying to establish SSH connection to %s", node.Hostname)
+		logger.Logf(t, description)
+
+		retry.DoWithRetry(t, description, 30, 10*time.Second, func() (string, error) {
+			return "", ssh.CheckSshConnectionE(t, node)
+		})
+	}
+}
+
+// WaitForVaultToBoot waits until Vault has booted the very first time on each of the nodes in the given cluster,
+// which is when it reports that it's uninitialized
+func WaitForVaultToBoot(t testing.TestingT, cluster Cluster) {
+	for _, node := range cluster.Nodes() {
+		if node.Hostname == "" {
+			continue
+		}
+
+		logger.Logf(t, "Waiting for Vault to boot the first time on host %s. Expecting it to be in uninitialized status (%d).", node.Hostname, int(Uninitialized))
+		AssertStatus(t, node, Uninitialized)
+	}
+}
+
+// InitializeVault runs 'vault operator init' on the leader of the given cluster and fills in its unseal keys and root token
+func InitializeVault(t testing.TestingT, cluster *Cluster) {
+	output := retry.DoWithRetry(t, "Initializing the cluster", 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, cluster.Leader, "vault operator init")
+	})
+	cluster.UnsealKeys = ParseUnsealKeys(t, output)
+
+	response, err := ParseInitResponseE(output)
+	require.NoError(t, err, "Failed to parse the root token from the vault init stdout")
+	cluster.RootToken = response.RootToken
+}
+
+// InitResponse holds what 'vault operator init' prints: all the unseal keys and the initial root token
+type InitResponse struct {
+	UnsealKeys []string `json:"unseal_keys"`
+	RootToken  string   `json:"root_token"`
+}
+
+// InitializeNodeE runs 'vault operator init' on the given host once and returns all the unseal keys and the initial
+// root token
+func InitializeNodeE(t testing.TestingT, host ssh.Host) (InitResponse, error) {
+	output, err := ssh.CheckSshCommandE(t, host, "vault operator init")
+	if err != nil {
+		return InitResponse{}, err
+	}
+	return ParseInitResponseE(output)
+}
+
+// UnsealNode unseals the Vault server on the given host with the given unseal keys, retrying on errors. Fails the test
+// if it still can't.
+func UnsealNode(t testing.TestingT, host ssh.Host, unsealKeys []string) {
+	unsealCommands := []string{}
+	for _, unsealKey := range unsealKeys {
+		unsealCommands = append(unsealCommands, fmt.Sprintf("vault operator unseal %s", unsealKey))
+	}
+
+	unsealCommand := strings.Join(unsealCommands, " && ")
+	description := fmt.Sprintf("Unsealing Vault on host %s", host.Hostname)
+	retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, host, unsealCommand)
+	})
+}
+
+// StepDownE forces the Vault node on the given host to step down as the leader, using the given token. The token must
+// be allowed to update sys/step-down. The token is copied to a file only the SSH user can read, and deleted right
+// after, rather than put on the command line, where any user on the node could see it in the process list.
+func StepDownE(t testing.TestingT, host ssh.Host, token string) error {
+	tokenPath := fmt.Sprintf("/tmp/vault-step-down-token-%s", random.UniqueId())
+	if err := ssh.ScpFileToE(t, host, 0600, tokenPath, token); err != nil {
+		return err
+	}
+
+	command := fmt.Sprintf(`VAULT_TOKEN="$(cat %s)" vault operator step-down; exit_status=$?; rm -f %s; exit $exit_status`, tokenPath, tokenPath)
+	_, err := ssh.CheckSshCommandE(t, host, command)
+	return err
+}
+
+// RollingRestartOptions configure how RollingRestart restarts the nodes of a cluster
+type RollingRestartOptions struct {
+	ClusterOptions
+	// The keys to unseal each node with after it restarts. Leave empty if the cluster auto unseals.
+	UnsealKeys []string
+	// A token that can update sys/step-down. If set, the leader steps down before it's restarted, rather than losing
+	// leadership when Vault shuts down.
+	Token string
+}
+
+// RollingRestart restarts Vault on each node in the cluster, one at a time, standbys first and the leader last. Each
+// node must be unsealed again before the next one is restarted, so the cluster stays available throughout. Returns
+// the status of each node after the restart.
+func RollingRestart(t testing.TestingT, options RollingRestartOptions) map[string]Status {
+	var leader *ssh.Host
+	standbys := []ssh.Host{}
+
+	for _, node := range FindNodes(t, options.ClusterOptions) {
+		status, err := GetNodeStatusE(t, node)
+		require.NoError(t, err, "Failed to get the status of Vault node %s", node.Hostname)
+		require.True(t, status.IsUnsealed(), "Vault node %s is %s, so restarting the cluster would make it unavailable", node.Hostname, status)
+
+		if status == Leader {
+			leaderNode := node
+			leader = &leaderNode
+		} else {
+			standbys = append(standbys, node)
+		}
+	}
+
+	nodes := standbys
+	if leader != nil {
+		nodes = append(nodes, *leader)
+	}
+
+	statuses := map[string]Status{}
+	for _, node := range nodes {
+		if leader != nil && node.Hostname == leader.Hostname && options.Token != "" {
+			logger.Logf(t, "Stepping down the leader %s before restarting it", node.Hostname)
+			require.NoError(t, StepDownE(t, node, options.Token), "Failed to step down the leader %s", node.Hostname)
+		}
+
+		RestartVault(t, node)
+
+		if len(options.UnsealKeys) > 0 {
+			AssertStatus(t, node, Sealed)
+			UnsealNode(t, node, options.UnsealKeys)
+		}
+
+		statuses[node.Hostname] = AssertUnsealed(t, node)
+	}
+
+	return statuses
+}
+
+// RestartVault restarts the Vault service on the given host. Unless it's configured to auto unseal, Vault comes back
+// sealed.
+func RestartVault(t testing.TestingT, host ssh.Host) {
+	description := fmt.Sprintf("Restarting vault on host %s", host.Hostname)
+	retry.DoWithRetry(t, description, 10, 10*time.Second, func() (string, error) {
+		return ssh.CheckSshCommandE(t, host, "sudo systemctl restart vault.service")
+	})
+}
+
+// ParseUnsealKeys parses the unseal keys from the stdout of 'vault operator init', failing the test if it can't
+func ParseUnsealKeys(t testing.TestingT, vaultInitResponse string) []string {
+	unsealKeys, err := ParseUnsealKeysE(vaultInitResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unsealKeys
+}
+
+// ParseUnsealKeysE parses the unseal keys from the stdout of 'vault operator init'. The format we're expecting is:
+//
+// Unseal Key 1: Gi9xAX9rFfmHtSi68mYOh0H3H2eu8E77nvRm/0fsuwQB
+// Unseal Key 2: ecQjHmaXc79GtwJN/hYWd/N2skhoNgyCmgCfGqRMTPIC
+// Unseal Key 3: LEOa/DdZDgLHBqK0JoxbviKByUAgxfm2dwK4y1PX6qED
+// Unseal Key 4: ZY87ijsj9/f5fO7ufgr4yhPWU/2ZZM3BGuSQRDFZpwoE
+// Unseal Key 5: MAiCaGrtikp4zU4XppC1A8IhKPXRlzj19+a3lcbCAVkF
+//
+// By default, Vault requires 3 unseal keys out of 5, so only the first three are returned.
+func ParseUnsealKeysE(vaultInitResponse string) ([]string, error) {
+	lines := strings.Split(vaultInitResponse, "\n")
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("Did not find at least three lines of in the vault init stdout: %s", vaultInitResponse)
+	}
+
+	unsealKeys := []string{}
+	for _, line := range lines[:3] {
+		matches := unsealKeyRegex.FindStringSubmatch(line)
+		if len(matches) != 2 {
+			return nil, fmt.Errorf("Unexpected format for unseal key: %s", line)
+		}
+		unsealKeys = append(unsealKeys, matches[1])
+	}
+
+	return unsealKeys, nil
+}
+
+// ParseInitResponseE parses all the unseal keys and the initial root token from the stdout of 'vault operator init'
+func ParseInitResponseE(vaultInitResponse string) (InitResponse, error) {
+	response := InitResponse{UnsealKeys: []string{}}
+
+	for _, line := range strings.Split(vaultInitResponse, "\n") {
+		line = strings.TrimSpace(line)
+		if matches := unsealKeyRegex.FindStringSubmatch(line); len(matches) == 2 {
+			response.UnsealKeys = append(response.UnsealKeys, matches[1])
+		} else if matches := rootTokenRegex.FindStringSubmatch(line); len(matches) == 2 {
+			response.RootToken = matches[1]
+		}
+	}
+
+	if len(response.UnsealKeys) == 0 || response.RootToken == "" {
+		return response, fmt.Errorf("Did not find the unseal keys and root token in the vault init stdout: %s", vaultInitResponse)
+	}
+
+	return response, nil
+}
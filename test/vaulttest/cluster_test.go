@@ -0,0 +1,112 @@
+package vaulttest
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUnsealKeys(t *testing.T) {
+	t.Parallel()
+
+	vaultInitResponse := `Unseal Key 1: Gi9xAX9rFfmHtSi68mYOh0H3H2eu8E77nvRm/0fsuwQB
+Unseal Key 2: ecQjHmaXc79GtwJN/hYWd/N2skhoNgyCmgCfGqRMTPIC
+Unseal Key 3: LEOa/DdZDgLHBqK0JoxbviKByUAgxfm2dwK4y1PX6qED
+Unseal Key 4: ZY87ijsj9/f5fO7ufgr4yhPWU/2ZZM3BGuSQRDFZpwoE
+Unseal Key 5: MAiCaGrtikp4zU4XppC1A8IhKPXRlzj19+a3lcbCAVkF
+
+Initial Root Token: s.4mRcvCEFw5s5bsZTvcbwmVmN`
+
+	unsealKeys, err := ParseUnsealKeysE(vaultInitResponse)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Gi9xAX9rFfmHtSi68mYOh0H3H2eu8E77nvRm/0fsuwQB",
+		"ecQjHmaXc79GtwJN/hYWd/N2skhoNgyCmgCfGqRMTPIC",
+		"LEOa/DdZDgLHBqK0JoxbviKByUAgxfm2dwK4y1PX6qED",
+	}, unsealKeys)
+
+	_, err = ParseUnsealKeysE("Unseal Key 1: abc")
+	assert.Error(t, err)
+
+	_, err = ParseUnsealKeysE("Error initializing: Vault is already initialized\n\n\n")
+	assert.Error(t, err)
+}
+
+func TestParseInitResponse(t *testing.T) {
+	t.Parallel()
+
+	vaultInitResponse := `Unseal Key 1: Gi9xAX9rFfmHtSi68mYOh0H3H2eu8E77nvRm/0fsuwQB
+Unseal Key 2: ecQjHmaXc79GtwJN/hYWd/N2skhoNgyCmgCfGqRMTPIC
+Unseal Key 3: LEOa/DdZDgLHBqK0JoxbviKByUAgxfm2dwK4y1PX6qED
+Unseal Key 4: ZY87ijsj9/f5fO7ufgr4yhPWU/2ZZM3BGuSQRDFZpwoE
+Unseal Key 5: MAiCaGrtikp4zU4XppC1A8IhKPXRlzj19+a3lcbCAVkF
+
+Initial Root Token: s.4mRcvCEFw5s5bsZTvcbwmVmN
+
+Vault initialized with 5 key shares and a key threshold of 3.`
+
+	response, err := ParseInitResponseE(vaultInitResponse)
+	require.NoError(t, err)
+	assert.Len(t, response.UnsealKeys, 5)
+	assert.Equal(t, "MAiCaGrtikp4zU4XppC1A8IhKPXRlzj19+a3lcbCAVkF", response.UnsealKeys[4])
+	assert.Equal(t, "s.4mRcvCEFw5s5bsZTvcbwmVmN", response.RootToken)
+
+	_, err = ParseInitResponseE("Error initializing: Vault is already initialized")
+	assert.Error(t, err)
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "leader", Leader.String())
+	assert.Equal(t, "performance-standby", PerformanceStandby.String())
+	assert.Equal(t, "sealed", Sealed.String())
+	assert.Equal(t, "500", Status(500).String())
+
+	assert.True(t, Standby.IsUnsealed())
+	assert.True(t, PerformanceStandby.IsUnsealed())
+	assert.False(t, Sealed.IsUnsealed())
+	assert.False(t, Uninitialized.IsUnsealed())
+}
+
+func TestClusterOptions(t *testing.T) {
+	t.Parallel()
+
+	keyPair := &aws.Ec2Keypair{KeyPair: &ssh.KeyPair{PublicKey: "public", PrivateKey: "private"}}
+	options := ClusterOptions{SshUserName: "ubuntu", KeyPair: keyPair}
+
+	assert.Equal(t, DefaultAsgNameOutput, options.asgNameOutput())
+	assert.Equal(t, "/var/log/syslog", options.SyslogPath())
+	assert.Equal(t, ssh.Host{Hostname: "10.0.0.1", SshUserName: "ubuntu", SshKeyPair: keyPair.KeyPair}, options.Host("10.0.0.1"))
+	assert.Equal(t, "vault-asg", ClusterOptions{AsgName: "vault-asg"}.GetAsgName(t))
+	assert.Equal(t, ssh.Host{Hostname: "10.0.0.1", SshUserName: "ubuntu", SshAgent: true}, ClusterOptions{SshUserName: "ubuntu", SshAgent: true}.Host("10.0.0.1"))
+
+	options.AsgNameOutput = "vault_asg_name"
+	options.SshUserName = "ec2-user"
+	assert.Equal(t, "vault_asg_name", options.asgNameOutput())
+	assert.Equal(t, "/var/log/messages", options.SyslogPath())
+
+	assert.Equal(t, DefaultLogsDestDir, LogsOptions{}.destDir())
+	assert.Equal(t, "/var/tmp/logs", LogsOptions{DestDir: "/var/tmp/logs"}.destDir())
+
+	assert.Equal(t, DefaultClusterSize, options.clusterSize())
+	assert.Equal(t, 5, ClusterOptions{ClusterSize: 5}.clusterSize())
+}
+
+func TestCluster(t *testing.T) {
+	t.Parallel()
+
+	cluster := Cluster{
+		Leader:     ssh.Host{Hostname: "10.0.0.2"},
+		Standbys:   []ssh.Host{{Hostname: "10.0.0.1"}, {Hostname: "10.0.0.3"}},
+		UnsealKeys: []string{"unseal-key"},
+		RootToken:  "s.root",
+	}
+
+	assert.Equal(t, []ssh.Host{{Hostname: "10.0.0.2"}, {Hostname: "10.0.0.1"}, {Hostname: "10.0.0.3"}}, cluster.Nodes())
+	assert.Equal(t, "[Leader: 10.0.0.2, Standbys: 10.0.0.1, 10.0.0.3]", cluster.String())
+	assert.Equal(t, "[Leader: 10.0.0.1, Standbys: ]", Cluster{Leader: ssh.Host{Hostname: "10.0.0.1"}}.String())
+}
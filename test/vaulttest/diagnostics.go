@@ -0,0 +1,181 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultdiag"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// The file the diagnostics of the test run are written to, next to the logs
+const RunDiagnosticsFileName = "diagnostics-run.tar.gz"
+
+// The paths of the files run-vault and the AMI in the examples put on each node
+const (
+	vaultConfigPath      = "/opt/vault/config/default.hcl"
+	vaultSystemdUnitPath = "/etc/systemd/system/vault.service"
+	vaultTlsCertPath     = "/opt/vault/tls/vault.crt.pem"
+	vaultTlsCaCertPath   = "/opt/vault/tls/ca.crt.pem"
+	userDataLogPath      = "/var/log/user-data.log"
+	cloudInitLogPath     = "/var/log/cloud-init-output.log"
+)
+
+// A file of the diagnostics of a node, and the command that prints its contents
+type nodeDiagnostic struct {
+	name        string
+	description string
+	command     string
+}
+
+// What's collected from each node. The commands run on the node itself, where Vault listens on 127.0.0.1 with a
+// certificate signed by a CA the node trusts, and the Consul agent on 127.0.0.1 without TLS.
+var nodeDiagnostics = []nodeDiagnostic{
+	{"vault/default.hcl", "The Vault config run-vault generated", "sudo cat " + vaultConfigPath},
+	{"vault/vault.service", "The systemd unit run-vault generated", "sudo cat " + vaultSystemdUnitPath},
+	{"vault/systemctl-status.txt", "The status of the Vault systemd unit", "systemctl status vault.service --no-pager --full"},
+	{"vault/health.json", "The response of the health endpoint of Vault", "curl --silent --show-error https://127.0.0.1:8200/v1/sys/health"},
+	{"vault/status.txt", "The output of vault status", "vault status"},
+	{"consul/members.txt", "The members of the Consul cluster, as the local agent sees them", "consul members"},
+	{"consul/catalog-services.txt", "The services in the Consul catalog, with their tags", "consul catalog services -tags"},
+	{"consul/catalog-vault.json", "The Vault service in the Consul catalog", "curl --silent --show-error http://127.0.0.1:8500/v1/catalog/service/vault"},
+	{"logs/user-data.log", "The log of the User Data script", "sudo cat " + userDataLogPath},
+	{"logs/cloud-init-output.log", "The output of cloud-init, which runs the User Data script", "sudo cat " + cloudInitLogPath},
+	{"tls/vault.crt.txt", "The details of the TLS certificate of Vault", "sudo openssl x509 -in " + vaultTlsCertPath + " -noout -text"},
+	{"tls/ca.crt.txt", "The details of the CA certificate that signed the TLS certificate of Vault", "sudo openssl x509 -in " + vaultTlsCaCertPath + " -noout -text"},
+}
+
+// DiagnosticsOptions tell CollectDiagnostics which cluster and test run to collect the diagnostics of, and where to
+// write them
+type DiagnosticsOptions struct {
+	LogsOptions
+	// The folder the Terraform code was deployed from, whose .test-data folder has the state test_structure saved
+	// between the stages of the test. Leave empty to skip the test data.
+	TestFolder string
+	// The names of the test data that are nothing but secrets, such as a saved root token, which are left out of the
+	// run bundle rather than redacted. The EC2 Key Pair test_structure.SaveEc2KeyPair saves is always left out.
+	SecretTestData []string
+}
+
+// The name test_structure.SaveEc2KeyPair saves the EC2 Key Pair, with its private key, under
+const ec2KeyPairTestData = "Ec2KeyPair"
+
+// CollectDiagnostics writes a diagnostic bundle for the test run and one for each node in the cluster to
+// <DestDir>/<TestName>/<AmiId>/, next to the logs GetLogs writes. Each bundle is a gzipped tarball with the secrets in
+// its files redacted and an index of what's in it at the top. The run bundle has the Terraform outputs and the saved
+// test data, but for the secret test data. The bundle of a node has the config, systemd unit, status and health of Vault, the Consul members and
+// catalog, the User Data and cloud-init logs, and the details of the TLS certificates. Nothing that goes wrong
+// collecting them fails the test, as they're meant for tests that already failed; the errors are logged and recorded
+// in the index.
+func CollectDiagnostics(t testing.TestingT, options DiagnosticsOptions) {
+	localDestDir := filepath.Join(options.destDir(), options.TestName, options.AmiId)
+	if err := os.MkdirAll(localDestDir, 0755); err != nil {
+		logger.Logf(t, "Error creating diagnostics folder %s: %s", localDestDir, err.Error())
+		return
+	}
+
+	runBundle := RunDiagnostics(t, options.TerraformOptions, options.TestFolder, options.SecretTestData...)
+	writeDiagnostics(t, runBundle, filepath.Join(localDestDir, RunDiagnosticsFileName))
+
+	nodeIpAddresses, err := options.NodeIpAddressesE(t)
+	if err != nil {
+		logger.Logf(t, "Error finding the Vault nodes to collect diagnostics from: %s", err.Error())
+		return
+	}
+
+	for _, nodeIpAddress := range nodeIpAddresses {
+		bundle := NodeDiagnostics(t, options.Host(nodeIpAddress))
+		writeDiagnostics(t, bundle, filepath.Join(localDestDir, NodeDiagnosticsFileName(nodeIpAddress)))
+	}
+}
+
+// NodeDiagnosticsFileName returns the name of the file the diagnostics of the node with the given IP address are
+// written to
+func NodeDiagnosticsFileName(nodeIpAddress string) string {
+	return fmt.Sprintf("diagnostics-node-%s.tar.gz", nodeIpAddress)
+}
+
+// NodeDiagnostics SSHes to the given Vault node and collects its diagnostics in a bundle. A command that fails is
+// recorded in the index with whatever it printed, and the rest are still run.
+func NodeDiagnostics(t testing.TestingT, host ssh.Host) *vaultdiag.Bundle {
+	bundle := vaultdiag.NewBundle("node-"+host.Hostname, fmt.Sprintf("Diagnostics of the Vault node %s", host.Hostname))
+
+	for _, diagnostic := range nodeDiagnostics {
+		output, err := ssh.CheckSshCommandE(t, host, diagnostic.command)
+		bundle.Add(diagnostic.name, diagnostic.description, diagnostic.command, output, err)
+	}
+
+	return bundle
+}
+
+// RunDiagnostics collects the diagnostics of the test run in a bundle: the outputs of the Terraform code deployed with
+// the given options, and the test data test_structure saved in the given folder, but for the EC2 Key Pair and the
+// given secret test data. Either is skipped if it's nil or empty.
+func RunDiagnostics(t testing.TestingT, terraformOptions *terraform.Options, testFolder string, secretTestData ...string) *vaultdiag.Bundle {
+	bundle := vaultdiag.NewBundle("run", "Diagnostics of the test run")
+
+	if terraformOptions != nil {
+		outputs, err := terraform.OutputAllE(t, terraformOptions)
+		contents := ""
+		if err == nil {
+			contents, err = formatJson(outputs)
+		}
+		bundle.Add("terraform-outputs.json", "The outputs of the Terraform code", fmt.Sprintf("terraform output -json in %s", terraformOptions.TerraformDir), contents, err)
+	}
+
+	if testFolder != "" {
+		addTestData(bundle, testFolder, append([]string{ec2KeyPairTestData}, secretTestData...))
+	}
+
+	return bundle
+}
+
+// Add the JSON files test_structure saved in the .test-data folder of the given test folder to the bundle, but for the
+// ones saved under the given secret names, with or without the .json extension
+func addTestData(bundle *vaultdiag.Bundle, testFolder string, secretTestData []string) {
+	secretNames := map[string]bool{}
+	for _, name := range secretTestData {
+		secretNames[strings.TrimSuffix(name, ".json")] = true
+	}
+
+	testDataPaths, err := filepath.Glob(test_structure.FormatTestDataPath(testFolder, "*.json"))
+	if err != nil {
+		bundle.Add("test-data", "The test data saved between the stages of the test", test_structure.FormatTestDataPath(testFolder, ""), "", err)
+		return
+	}
+	sort.Strings(testDataPaths)
+
+	for _, testDataPath := range testDataPaths {
+		if secretNames[strings.TrimSuffix(filepath.Base(testDataPath), ".json")] {
+			continue
+		}
+		contents, err := ioutil.ReadFile(testDataPath)
+		bundle.Add(filepath.Join("test-data", filepath.Base(testDataPath)), "Test data saved between the stages of the test", testDataPath, string(contents), err)
+	}
+}
+
+func formatJson(value interface{}) (string, error) {
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// Write the bundle to the given path, only logging errors, as missing diagnostics shouldn't fail the test
+func writeDiagnostics(t testing.TestingT, bundle *vaultdiag.Bundle, destination string) {
+	if err := bundle.WriteFile(destination); err != nil {
+		logger.Logf(t, "Error writing diagnostics %s: %s", destination, err.Error())
+		return
+	}
+	logger.Logf(t, "Wrote diagnostics of %s to %s", bundle.Name, destination)
+}
@@ -0,0 +1,167 @@
+package vaulttest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terraform-aws-vault/test/vaultlog"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/require"
+)
+
+// The file on each node the Vault logs from journalctl are written to before they're downloaded
+const LogFilePath = "/opt/vault/log/vault-journalctl.log"
+
+// The local folder logs are written to if LogsOptions.DestDir isn't set
+const DefaultLogsDestDir = "/tmp/logs"
+
+// The file GetLogs writes the summary of what it found in the logs of a node to, next to the logs themselves
+const LogSummaryFileName = "vault-log-summary.txt"
+
+const syslogPathUbuntu = "/var/log/syslog"
+const syslogPathAmazonLinux = "/var/log/messages"
+
+// LogsOptions tell GetLogs which cluster to collect the logs of and where to write them
+type LogsOptions struct {
+	ClusterOptions
+	// The name of the test, used to keep the logs of each test in a separate folder
+	TestName string
+	// The ID of the AMI the cluster runs, used to keep the logs for each AMI in a separate folder
+	AmiId string
+	// The local folder to write the logs to. Defaults to DefaultLogsDestDir.
+	DestDir string
+	// The known-benign messages that aren't counted as problems in the summary of the logs. Defaults to
+	// vaultlog.DefaultAllowList.
+	AllowList []vaultlog.AllowRule
+}
+
+func (options LogsOptions) destDir() string {
+	if options.DestDir == "" {
+		return DefaultLogsDestDir
+	}
+	return options.DestDir
+}
+
+func (options LogsOptions) allowList() []vaultlog.AllowRule {
+	if options.AllowList == nil {
+		return vaultlog.DefaultAllowList
+	}
+	return options.AllowList
+}
+
+// SyslogPath returns the path of the syslog on the nodes, which depends on the OS of the AMI. We can tell Amazon
+// Linux apart from Ubuntu by its SSH user.
+func (options ClusterOptions) SyslogPath() string {
+	if options.SshUserName == "ec2-user" {
+		return syslogPathAmazonLinux
+	}
+	return syslogPathUbuntu
+}
+
+// GetLogs downloads the Vault logs from journalctl and the syslog of each node in the cluster, and writes them to
+// <DestDir>/<TestName>/<AmiId>/<instance ID>/ so they're available for debugging after the test. It also looks
+// through the Vault lines of each file for errors, panics, failures of the core and seal transitions, writes what it
+// found to LogSummaryFileName next to them and, if the test failed, logs it with the failure. A panic of Vault fails
+// the test, even if nothing else did.
+func GetLogs(t testing.TestingT, options LogsOptions) {
+	WriteOutVaultLogs(t, options.ClusterOptions)
+
+	instanceIdToIpAddress, err := options.NodeIpAddressesByInstanceIdE(t)
+	require.NoError(t, err, "Failed to look up the nodes in the Vault ASG")
+	require.Len(t, instanceIdToIpAddress, options.clusterSize())
+
+	// Go through the nodes in order, so the summaries are in the same order in each run
+	instanceIDs := []string{}
+	for instanceID := range instanceIdToIpAddress {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	sysLogPath := options.SyslogPath()
+	reports := []vaultlog.Report{}
+	for _, instanceID := range instanceIDs {
+		host := options.Host(instanceIdToIpAddress[instanceID])
+		filePathToContents := ssh.FetchContentsOfFiles(t, host, true, LogFilePath, sysLogPath)
+
+		localDestDir := filepath.Join(options.destDir(), options.TestName, options.AmiId, instanceID)
+		if err := os.MkdirAll(localDestDir, 0755); err != nil {
+			logger.Logf(t, "Error creating log folder %s: %s", localDestDir, err.Error())
+		}
+
+		WriteLogFile(t, filePathToContents[LogFilePath], filepath.Join(localDestDir, "vault-journalctl.log"))
+		WriteLogFile(t, filePathToContents[sysLogPath], filepath.Join(localDestDir, "syslog.log"))
+
+		nodeReports := []vaultlog.Report{
+			AnalyzeLogs(filepath.Join(instanceID, "vault-journalctl.log"), filePathToContents[LogFilePath], options.allowList()),
+			AnalyzeLogs(filepath.Join(instanceID, "syslog.log"), filePathToContents[sysLogPath], options.allowList()),
+		}
+		WriteLogFile(t, SummarizeLogs(nodeReports), filepath.Join(localDestDir, LogSummaryFileName))
+		reports = append(reports, nodeReports...)
+	}
+
+	if failed, canTell := t.(interface{ Failed() bool }); canTell && failed.Failed() {
+		logger.Logf(t, "Summary of the Vault logs of the failed test:\n%s", SummarizeLogs(reports))
+	}
+
+	for _, report := range reports {
+		for _, finding := range report.Problems() {
+			if finding.Kind == vaultlog.KindPanic {
+				t.Errorf("Vault panicked, according to line %d of %s: %s", finding.Entry.LineNumber, report.Source, finding.Entry.Message)
+			}
+		}
+	}
+}
+
+// AnalyzeLogs parses the given contents of a log file with Vault lines in it, such as the output of journalctl or the
+// syslog, and flags the lines worth a look, leaving the messages on the given allow-list out of the problems
+func AnalyzeLogs(source string, contents string, allowList []vaultlog.AllowRule) vaultlog.Report {
+	return vaultlog.Analyze(source, vaultlog.Parse(contents), allowList)
+}
+
+// SummarizeLogs returns the summaries of the given reports, one after the other
+func SummarizeLogs(reports []vaultlog.Report) string {
+	summaries := []string{}
+	for _, report := range reports {
+		summaries = append(summaries, report.String())
+	}
+	return strings.Join(summaries, "\n")
+}
+
+// WriteOutVaultLogs writes the Vault logs from journalctl to LogFilePath on each node in the cluster, so they can be
+// downloaded along with other files
+func WriteOutVaultLogs(t testing.TestingT, options ClusterOptions) {
+	cluster := FindCluster(t, options)
+
+	for _, node := range cluster.Nodes() {
+		output := retry.DoWithRetry(t, "Writing out Vault logs from journalctl to file", 1, 10*time.Second, func() (string, error) {
+			return ssh.CheckSshCommandE(t, node, fmt.Sprintf("sudo -u vault mkdir -p %s && journalctl -u vault.service | sudo -u vault tee %s > /dev/null", filepath.Dir(LogFilePath), LogFilePath))
+		})
+		logger.Logf(t, "Output from journalctl command on %s: %s", node.Hostname, output)
+	}
+}
+
+// WriteLogFile writes the given contents to a local file. Errors are only logged, as a missing log file shouldn't
+// fail the test.
+func WriteLogFile(t testing.TestingT, contents string, destination string) {
+	if err := ioutil.WriteFile(destination, []byte(contents), 0644); err != nil {
+		logger.Logf(t, "Error creating log file on disk: %s", err.Error())
+	}
+}
+
+// FetchVaultLogsE returns the last lines of the Vault logs from journalctl on the given host, or all of them if lines
+// is 0
+func FetchVaultLogsE(t testing.TestingT, host ssh.Host, lines int) (string, error) {
+	command := "journalctl -u vault.service --no-pager"
+	if lines > 0 {
+		command = fmt.Sprintf("%s -n %d", command, lines)
+	}
+	return ssh.CheckSshCommandE(t, host, command)
+}
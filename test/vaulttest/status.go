@@ -0,0 +1,112 @@
+package vaulttest
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/retry"
+	"github.com/gruntwork-io/terratest/modules/ssh"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// Status is the HTTP status code the health endpoint of a Vault node responds with.
+// From: https://www.vaultproject.io/api/system/health.html
+type Status int
+
+const (
+	Leader             Status = 200
+	Standby            Status = 429
+	PerformanceStandby Status = 473
+	Uninitialized      Status = 501
+	Sealed             Status = 503
+)
+
+// String returns the name of the status, e.g. "standby" for Standby, or the status code if it isn't one Vault uses
+func (status Status) String() string {
+	switch status {
+	case Leader:
+		return "leader"
+	case Standby:
+		return "standby"
+	case PerformanceStandby:
+		return "performance-standby"
+	case Uninitialized:
+		return "uninitialized"
+	case Sealed:
+		return "sealed"
+	default:
+		return strconv.Itoa(int(status))
+	}
+}
+
+// IsUnsealed returns true if the status is that of an initialized and unsealed node
+func (status Status) IsUnsealed() bool {
+	return status == Leader || status == Standby || status == PerformanceStandby
+}
+
+// AssertStatus checks that the Vault node on the given host has the given status, retrying for up to 5 minutes
+func AssertStatus(t testing.TestingT, host ssh.Host, expectedStatus Status) {
+	description := fmt.Sprintf("Check that the Vault node %s has status %d", host.Hostname, int(expectedStatus))
+	logger.Logf(t, description)
+
+	out := retry.DoWithRetry(t, description, 30, 10*time.Second, func() (string, error) {
+		return CheckStatusE(t, host, expectedStatus)
+	})
+
+	logger.Logf(t, out)
+}
+
+// AssertUnsealed checks that the Vault node on the given host is initialized and unsealed, whether it's the leader, a
+// standby or a performance standby, retrying for up to 5 minutes. Returns the status of the node.
+func AssertUnsealed(t testing.TestingT, host ssh.Host) Status {
+	description := fmt.Sprintf("Check that the Vault node %s is unsealed", host.Hostname)
+	logger.Logf(t, description)
+
+	var status Status
+	retry.DoWithRetry(t, description, 30, 10*time.Second, func() (string, error) {
+		var err error
+		status, err = GetNodeStatusE(t, host)
+		if err != nil {
+			return "", err
+		}
+		if !status.IsUnsealed() {
+			return "", fmt.Errorf("Expected host %s to be unsealed, but its status is %s", host.Hostname, status)
+		}
+		return "", nil
+	})
+
+	return status
+}
+
+// CheckStatusE checks the status of the Vault node on the given host once, returning an error if it doesn't match the
+// expected status
+func CheckStatusE(t testing.TestingT, host ssh.Host, expectedStatus Status) (string, error) {
+	status, err := GetNodeStatusE(t, host)
+	if err != nil {
+		return "", err
+	}
+
+	if status != expectedStatus {
+		return "", fmt.Errorf("Expected status code %d for host %s, but got %d", int(expectedStatus), host.Hostname, int(status))
+	}
+	return fmt.Sprintf("Got expected status code %d", int(status)), nil
+}
+
+// GetNodeStatusE gets the status of the Vault node on the given host. Note that we use curl on the node to do the
+// status check so we can ensure that TLS certificates work for curl (and not just the Vault client).
+func GetNodeStatusE(t testing.TestingT, host ssh.Host) (Status, error) {
+	curlCommand := "curl -s -o /dev/null -w '%{http_code}' https://127.0.0.1:8200/v1/sys/health"
+	logger.Logf(t, "Using curl to check status of Vault server %s: %s", host.Hostname, curlCommand)
+
+	output, err := ssh.CheckSshCommandE(t, host, curlCommand)
+	if err != nil {
+		return 0, err
+	}
+	status, err := strconv.Atoi(output)
+	if err != nil {
+		return 0, err
+	}
+	return Status(status), nil
+}